@@ -0,0 +1,218 @@
+// The clone tool will clone one or more images (and their corresponding features) from a source bucket to a target bucket
+// where they can be processed. Clone requests are read, as JSON Lines, from one or more files or STDIN and a manifest of the
+// outcome of each request is written as JSON Lines. If the manifest file already exists then requests it records as cloned
+// or skipped are not processed again.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	_ "gocloud.dev/blob/fileblob"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/operations/clone"
+	"github.com/sfomuseum/go-whosonfirst-media/transform"
+	"github.com/whosonfirst/go-reader/v2"
+	"gocloud.dev/blob"
+)
+
+func main() {
+
+	var source_uri string
+	var target_uri string
+	var feature_reader_uri string
+	var manifest_path string
+	var workers int
+	var force bool
+	var image_template string
+	var feature_template string
+	var cache_control string
+
+	var auto_orient bool
+	var max_dimension int
+	var jpeg_quality int
+	var strip_metadata bool
+
+	flag.StringVar(&source_uri, "source-bucket-uri", "", "A valid gocloud.dev/blob Bucket URI where images are read from.")
+	flag.StringVar(&target_uri, "target-bucket-uri", "", "A valid gocloud.dev/blob Bucket URI where images are written to.")
+	flag.StringVar(&feature_reader_uri, "feature-reader-uri", "", "An optional whosonfirst/go-reader.Reader URI where the features associated with images are read from.")
+	flag.StringVar(&manifest_path, "manifest", "", "The path to a manifest file. If it exists requests that have already been cloned are skipped. New manifest entries are appended to this file. If empty manifest entries are written to STDOUT.")
+	flag.IntVar(&workers, "workers", clone.DEFAULT_WORKERS, "The maximum number of images to clone concurrently.")
+	flag.BoolVar(&force, "force", false, "Clone images even if they already exist in the target location.")
+	flag.StringVar(&image_template, "image-template", "", "An optional naming template for image paths in the target location. Valid placeholders are {id}, {image_id}, {filename}, {basename}, {ext}, {fingerprint} and {id_path}. If empty \"{id}_{image_id}{ext}\" is used, or \"{id}_{filename}\" if the image ID is -1.")
+	flag.StringVar(&feature_template, "feature-template", clone.DEFAULT_FEATURE_TEMPLATE, "The naming template for feature paths in the target location. Valid placeholders are the same as -image-template, but features that will be processed by watch-reports should only use {id} and {id_path} and match its -feature-template flag.")
+
+	flag.StringVar(&cache_control, "cache-control", "", "An optional Cache-Control header to assign to images and features written to the target location.")
+
+	flag.BoolVar(&auto_orient, "auto-orient", false, "Rotate images so they are upright, using their EXIF Orientation tag.")
+	flag.IntVar(&max_dimension, "max-dimension", 0, "If greater than zero, downscale images so that neither their width nor height exceeds this value.")
+	flag.IntVar(&jpeg_quality, "jpeg-quality", 0, "If greater than zero, convert TIFF and PNG images to JPEG images with this quality.")
+	flag.BoolVar(&strip_metadata, "strip-metadata", false, "Strip EXIF metadata from (JPEG) images that have been transformed.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Clone one or more images, defined as JSON Lines encoded clone requests, from a source bucket to a target bucket.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options] [path(s)]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "If no paths are defined clone requests are read from STDIN.\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	ctx := context.Background()
+
+	source, err := blob.OpenBucket(ctx, source_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open source bucket, %v", err)
+	}
+
+	defer source.Close()
+
+	target, err := blob.OpenBucket(ctx, target_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open target bucket, %v", err)
+	}
+
+	defer target.Close()
+
+	transformations := make([]transform.Transformation, 0)
+
+	if auto_orient {
+		transformations = append(transformations, transform.NewAutoOrient())
+	}
+
+	if max_dimension > 0 {
+
+		t, err := transform.NewDownscale(max_dimension)
+
+		if err != nil {
+			log.Fatalf("Failed to create downscale transformation, %v", err)
+		}
+
+		transformations = append(transformations, t)
+	}
+
+	if jpeg_quality > 0 {
+
+		t, err := transform.NewConvertToJPEG(jpeg_quality)
+
+		if err != nil {
+			log.Fatalf("Failed to create JPEG conversion transformation, %v", err)
+		}
+
+		transformations = append(transformations, t)
+	}
+
+	if len(transformations) > 0 && strip_metadata {
+		transformations = append(transformations, transform.NewStripMetadata())
+	}
+
+	write_policy := common.NewDefaultWritePolicy()
+	write_policy.CacheControl = cache_control
+
+	opts := &clone.CloneImagesOptions{
+		Source:          source,
+		Target:          target,
+		Force:           force,
+		Workers:         workers,
+		Transformations: transformations,
+		ImageTemplate:   image_template,
+		FeatureTemplate: feature_template,
+		WritePolicy:     write_policy,
+		ManifestWriter:  os.Stdout,
+	}
+
+	if feature_reader_uri != "" {
+
+		r, err := reader.NewReader(ctx, feature_reader_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to create feature reader, %v", err)
+		}
+
+		opts.FeatureReader = r
+	}
+
+	if manifest_path != "" {
+
+		_, err := os.Stat(manifest_path)
+
+		if err == nil {
+
+			r, err := os.Open(manifest_path)
+
+			if err != nil {
+				log.Fatalf("Failed to open manifest for reading, %v", err)
+			}
+
+			m, err := clone.ReadManifest(r)
+
+			r.Close()
+
+			if err != nil {
+				log.Fatalf("Failed to read manifest, %v", err)
+			}
+
+			opts.Resume = m
+
+		} else if !os.IsNotExist(err) {
+			log.Fatalf("Failed to stat manifest, %v", err)
+		}
+
+		wr, err := os.OpenFile(manifest_path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+		if err != nil {
+			log.Fatalf("Failed to open manifest for writing, %v", err)
+		}
+
+		defer wr.Close()
+
+		opts.ManifestWriter = wr
+	}
+
+	readers := make([]io.Reader, 0)
+
+	for _, path := range flag.Args() {
+
+		r, err := os.Open(path)
+
+		if err != nil {
+			log.Fatalf("Failed to open %s, %v", path, err)
+		}
+
+		defer r.Close()
+
+		readers = append(readers, r)
+	}
+
+	if len(readers) == 0 {
+		readers = append(readers, os.Stdin)
+	}
+
+	requests := clone.ReadCloneRequests(io.MultiReader(readers...))
+
+	manifest, err := clone.CloneImages(ctx, opts, requests)
+
+	if err != nil {
+		log.Fatalf("Failed to clone images, %v", err)
+	}
+
+	cloned := manifest.Count(clone.MANIFEST_CLONED)
+	skipped := manifest.Count(clone.MANIFEST_SKIPPED)
+	failed := manifest.Count(clone.MANIFEST_FAILED)
+
+	log.Printf("Cloned %d images, skipped %d images, %d failures\n", cloned, skipped, failed)
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -7,18 +7,28 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"strings"
 
 	_ "gocloud.dev/blob/fileblob"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 
+	"github.com/sfomuseum/go-whosonfirst-media/common"
 	"github.com/sfomuseum/go-whosonfirst-media/operations/gather"
 	"gocloud.dev/blob"
 )
 
 func main() {
 
+	var palette bool
+	var palette_reference string
+	var palette_count int
+
+	flag.BoolVar(&palette, "palette", false, "Extract the colour palette of each image and include it in the response.")
+	flag.StringVar(&palette_reference, "palette-reference", common.DEFAULT_PALETTE_REFERENCE, fmt.Sprintf("The reference palette that colours are snapped to. Valid options are: %s. If empty colours are not snapped.", strings.Join(common.ReferencePaletteNames(), ", ")))
+	flag.IntVar(&palette_count, "palette-count", common.DEFAULT_PALETTE_COUNT, "The maximum number of colours to extract.")
+
 	flag.Parse()
 
 	ctx := context.Background()
@@ -43,7 +53,19 @@ func main() {
 			log.Fatal(err)
 		}
 
-		err = gather.GatherImages(ctx, bucket, cb)
+		opts := &gather.GatherImagesOptions{
+			Callback: cb,
+			Bucket:   bucket,
+		}
+
+		if palette {
+			opts.PaletteOptions = &common.PaletteOptions{
+				Count:     palette_count,
+				Reference: palette_reference,
+			}
+		}
+
+		err = gather.GatherImagesWithOptions(ctx, opts)
 
 		if err != nil {
 			log.Fatalf("Failed to gather images, %v", err)
@@ -0,0 +1,141 @@
+// The generate tool will produce the derivatives of a pending image, without go-iiif, and write a go-iiif "iiif-process"
+// style report describing them that can be processed by the watch-reports tool. The JSON-encoded report is also written
+// to STDOUT.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	_ "gocloud.dev/blob/fileblob"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/operations/process"
+	"gocloud.dev/blob"
+)
+
+func main() {
+
+	var pending_uri string
+	var media_uri string
+	var reports_uri string
+	var sizes string
+	var format string
+	var cache_control string
+	var workers int
+	var id int64
+	var origin string
+	var palette_reference string
+	var palette_count int
+	var palette bool
+
+	flag.StringVar(&pending_uri, "pending-bucket-uri", "", "A valid gocloud.dev/blob Bucket URI where pending images are stored.")
+	flag.StringVar(&media_uri, "media-bucket-uri", "", "A valid gocloud.dev/blob Bucket URI where derivatives are written.")
+	flag.StringVar(&reports_uri, "reports-bucket-uri", "", "An optional gocloud.dev/blob Bucket URI where the report describing the derivatives is written.")
+	flag.StringVar(&sizes, "sizes", common.DEFAULT_GENERATE_SIZES, "A comma-separated list of {LABEL}={SPEC} derivative sizes, where {SPEC} is one of: full, {N}, square or square:{N}.")
+	flag.StringVar(&format, "format", "", "An optional image format (jpg, png or gif) for derivatives. If empty the format of the pending image is used, or jpg if it is not one of those formats.")
+	flag.StringVar(&cache_control, "cache-control", "", "An optional Cache-Control header to assign to derivatives.")
+	flag.IntVar(&workers, "workers", common.DEFAULT_WORKERS, "The maximum number of derivatives to produce concurrently.")
+	flag.Int64Var(&id, "id", 0, "The WOF ID of the media feature associated with the pending image.")
+	flag.StringVar(&origin, "origin", "", "The key of the pending image in the pending bucket.")
+
+	flag.BoolVar(&palette, "palette", false, "Extract the colour palette of the pending image and include it in the report.")
+	flag.StringVar(&palette_reference, "palette-reference", common.DEFAULT_PALETTE_REFERENCE, fmt.Sprintf("The reference palette that colours are snapped to. Valid options are: %s. If empty colours are not snapped.", strings.Join(common.ReferencePaletteNames(), ", ")))
+	flag.IntVar(&palette_count, "palette-count", common.DEFAULT_PALETTE_COUNT, "The maximum number of colours to extract.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Produce the derivatives of a pending image and a report describing them.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	ctx := context.Background()
+
+	if id <= 0 {
+		log.Fatalf("Missing or invalid -id flag")
+	}
+
+	if origin == "" {
+		log.Fatalf("Missing -origin flag")
+	}
+
+	generate_sizes, err := common.ParseGenerateSizes(sizes)
+
+	if err != nil {
+		log.Fatalf("Failed to parse sizes, %v", err)
+	}
+
+	pending, err := blob.OpenBucket(ctx, pending_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open pending bucket, %v", err)
+	}
+
+	defer pending.Close()
+
+	media, err := blob.OpenBucket(ctx, media_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open media bucket, %v", err)
+	}
+
+	defer media.Close()
+
+	policy := common.NewDefaultWritePolicy()
+	policy.CacheControl = cache_control
+
+	opts := &process.GenerateOptions{
+		Pending:     pending,
+		Media:       media,
+		Sizes:       generate_sizes,
+		Format:      format,
+		WritePolicy: policy,
+		Workers:     workers,
+	}
+
+	if palette {
+		opts.PaletteOptions = &common.PaletteOptions{
+			Count:     palette_count,
+			Reference: palette_reference,
+		}
+	}
+
+	if reports_uri != "" {
+
+		reports, err := blob.OpenBucket(ctx, reports_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to open reports bucket, %v", err)
+		}
+
+		defer reports.Close()
+
+		opts.Reports = reports
+	}
+
+	req := &process.GenerateRequest{
+		Id:     id,
+		Origin: origin,
+	}
+
+	rsp, err := process.Generate(ctx, opts, req)
+
+	if err != nil {
+		log.Fatalf("Failed to generate derivatives, %v", err)
+	}
+
+	enc, err := json.Marshal(rsp.Report)
+
+	if err != nil {
+		log.Fatalf("Failed to marshal report, %v", err)
+	}
+
+	fmt.Println(string(enc))
+}
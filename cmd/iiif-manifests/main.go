@@ -0,0 +1,85 @@
+// The iiif-manifests tool will write a IIIF Presentation 3.0 manifest for each of the media features in a bucket, and a
+// IIIF collection for each of the features they depict, to a bucket.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	_ "gocloud.dev/blob/fileblob"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/iiif"
+	"gocloud.dev/blob"
+)
+
+func main() {
+
+	var features_uri string
+	var manifests_uri string
+	var image_template string
+	var base_url string
+	var image_label string
+	var depicts_reader_uri string
+
+	flag.StringVar(&features_uri, "features-bucket-uri", "", "A valid gocloud.dev/blob Bucket URI where media features are stored.")
+	flag.StringVar(&manifests_uri, "manifests-bucket-uri", "", "A valid gocloud.dev/blob Bucket URI where manifests and collections are written.")
+	flag.StringVar(&image_template, "image-uri-template", "", "A URI template for derivative images. Valid placeholders are: {id}, {id_path}, {secret}, {label}, {extension}, {filename}.")
+	flag.StringVar(&base_url, "base-url", "", "The base URL, an absolute http or https URL, where manifests and collections are published. Required.")
+	flag.StringVar(&image_label, "image-label", "o", "The size label of the derivative painted on each canvas.")
+	flag.StringVar(&depicts_reader_uri, "depicts-reader-uri", "", "An optional whosonfirst/go-reader URI for reading depicted features in order to label collections with their names.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Write IIIF Presentation 3.0 manifests and collections for media features.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	ctx := context.Background()
+
+	opts, err := iiif.NewManifestOptions(image_template, base_url)
+
+	if err != nil {
+		log.Fatalf("Failed to create manifest options, %v", err)
+	}
+
+	opts.ImageLabel = image_label
+
+	if depicts_reader_uri != "" {
+
+		r, err := common.NewReader(ctx, depicts_reader_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to create depicts reader, %v", err)
+		}
+
+		opts.DepictsReader = r
+	}
+
+	features, err := blob.OpenBucket(ctx, features_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open features bucket, %v", err)
+	}
+
+	defer features.Close()
+
+	manifests, err := blob.OpenBucket(ctx, manifests_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open manifests bucket, %v", err)
+	}
+
+	defer manifests.Close()
+
+	err = iiif.WriteManifests(ctx, manifests, iiif.BucketFeatures(ctx, features), opts)
+
+	if err != nil {
+		log.Fatalf("Failed to write manifests, %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+// The watch-reports tool will watch a bucket of go-iiif/go-iiif "iiif-process" reports and process each new report,
+// updating the (pending) feature associated with the report and writing it to a whosonfirst/go-writer Writer. Processed
+// reports are recorded as markers in a bucket so that they are not processed again if the tool is restarted.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	_ "gocloud.dev/blob/fileblob"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/operations/depicts"
+	"github.com/sfomuseum/go-whosonfirst-media/operations/process"
+	"github.com/whosonfirst/go-whosonfirst-export/v3"
+	"gocloud.dev/blob"
+)
+
+func main() {
+
+	var reports_uri string
+	var pending_uri string
+	var writer_uri string
+	var exporter_uri string
+	var source_uri string
+	var markers_uri string
+	var markers_prefix string
+	var workers int
+	var prune bool
+	var dryrun bool
+	var fingerprint_policy string
+	var journal_uri string
+	var notify_url string
+	var index_writer_uri string
+	var depicts_reader_uri string
+	var depicts_writer_uri string
+	var primary_policy string
+	var feature_template string
+
+	flag.StringVar(&reports_uri, "reports-bucket-uri", "", "A valid gocloud.dev/blob Bucket URI where reports are stored.")
+	flag.StringVar(&pending_uri, "pending-bucket-uri", "", "A valid gocloud.dev/blob Bucket URI where pending images and features are stored.")
+	flag.StringVar(&writer_uri, "writer-uri", "", "A valid whosonfirst/go-writer URI for publishing updated features. If the URI contains the string \"{repo}\" it will be replaced by the feature's wof:repo property.")
+	flag.StringVar(&exporter_uri, "exporter-uri", "whosonfirst://", "A valid whosonfirst/go-whosonfirst-export URI.")
+	flag.StringVar(&source_uri, "source-uri", "poll://", fmt.Sprintf("A valid report source URI. Supported schemes are: %s", strings.Join(process.ReportSourceSchemes(), ", ")))
+	flag.StringVar(&markers_uri, "markers-bucket-uri", "", "A valid gocloud.dev/blob Bucket URI where processed-report markers are stored. This should not be the same as -reports-bucket-uri.")
+	flag.StringVar(&markers_prefix, "markers-prefix", "", "An optional prefix for processed-report marker keys.")
+	flag.IntVar(&workers, "workers", common.DEFAULT_WORKERS, "The maximum number of reports to process concurrently.")
+	flag.BoolVar(&dryrun, "dryrun", false, "Apply reports to features without writing or pruning anything, and write a JSON diff of each feature's properties to STDOUT. Reports are not marked as processed.")
+	flag.StringVar(&fingerprint_policy, "fingerprint-policy", string(process.FINGERPRINT_WARN), "What to do when a report's origin fingerprint does not match the fingerprint recorded when the image was gathered. Valid options are: error, warn, accept.")
+	flag.StringVar(&journal_uri, "journal-bucket-uri", "", "An optional gocloud.dev/blob Bucket URI where a write-ahead journal of report processing is stored. If present, reports interrupted by a crash or restart are finished, or rolled back, when the tool starts.")
+	flag.StringVar(&notify_url, "notify-url", "", "An optional URL to send a JSON-encoded notification to, using an HTTP POST request, after each feature is written.")
+	flag.StringVar(&index_writer_uri, "index-writer-uri", "", "An optional whosonfirst/go-writer URI to also write each updated feature to, for example to refresh a search index. If the URI contains the string \"{repo}\" it will be replaced by the feature's wof:repo property.")
+	flag.StringVar(&depicts_reader_uri, "depicts-reader-uri", "", "An optional whosonfirst/go-reader URI for reading the features depicted by media features. If present (along with -depicts-writer-uri) depicted features are updated to reference their media files.")
+	flag.StringVar(&depicts_writer_uri, "depicts-writer-uri", "", "An optional whosonfirst/go-writer URI for writing the features depicted by media features.")
+	flag.StringVar(&feature_template, "feature-template", process.DEFAULT_FEATURE_KEY_TEMPLATE, "The template used to derive the key of the feature associated with a processed image in the pending bucket. This should match the -feature-template flag used to clone images. Valid placeholders are {id} and {id_path}.")
+	flag.StringVar(&primary_policy, "primary-policy", string(depicts.PRIMARY_NEWEST), "How the primary media file of a depicted feature is chosen. Valid options are: newest, first, explicit.")
+	flag.BoolVar(&prune, "prune", false, "Remove reports, pending images and pending features once a report has been processed.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Watch a bucket of go-iiif \"iiif-process\" reports and process each new report.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if markers_uri == "" {
+		log.Fatalf("Missing -markers-bucket-uri flag")
+	}
+
+	reports, err := blob.OpenBucket(ctx, reports_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open reports bucket, %v", err)
+	}
+
+	defer reports.Close()
+
+	pending, err := blob.OpenBucket(ctx, pending_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open pending bucket, %v", err)
+	}
+
+	defer pending.Close()
+
+	markers_bucket, err := blob.OpenBucket(ctx, markers_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open markers bucket, %v", err)
+	}
+
+	defer markers_bucket.Close()
+
+	ex, err := export.NewExporter(ctx, exporter_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to create exporter, %v", err)
+	}
+
+	markers, err := process.NewBlobMarkerStore(markers_bucket, markers_prefix)
+
+	if err != nil {
+		log.Fatalf("Failed to create marker store, %v", err)
+	}
+
+	source, err := process.NewReportSource(ctx, source_uri, reports)
+
+	if err != nil {
+		log.Fatalf("Failed to create report source, %v", err)
+	}
+
+	defer source.Close()
+
+	fp_policy, err := process.ParseFingerprintPolicy(fingerprint_policy)
+
+	if err != nil {
+		log.Fatalf("Invalid -fingerprint-policy flag, %v", err)
+	}
+
+	p := &process.ReportProcessor{
+		Reports:   reports,
+		Pending:   pending,
+		WriterURI: writer_uri,
+		Exporter:  ex,
+		Prune:     prune,
+
+		FingerprintPolicy: fp_policy,
+		FeatureTemplate:   feature_template,
+	}
+
+	_, err = process.FeatureKey(feature_template, 1)
+
+	if err != nil {
+		log.Fatalf("Invalid -feature-template flag, %v", err)
+	}
+
+	// The policy is validated even if the depicts hook is not enabled so that typos are caught early
+
+	depicts_policy, err := depicts.ParsePrimaryPolicy(primary_policy)
+
+	if err != nil {
+		log.Fatalf("Invalid -primary-policy flag, %v", err)
+	}
+
+	if depicts_reader_uri != "" || depicts_writer_uri != "" {
+
+		if depicts_reader_uri == "" || depicts_writer_uri == "" {
+			log.Fatalf("-depicts-reader-uri and -depicts-writer-uri must be used together")
+		}
+
+		depicts_r, err := common.NewReader(ctx, depicts_reader_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to create depicts reader, %v", err)
+		}
+
+		depicts_wr, err := common.NewWriter(ctx, depicts_writer_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to create depicts writer, %v", err)
+		}
+
+		u, err := depicts.NewUpdater(depicts_r, depicts_wr, ex)
+
+		if err != nil {
+			log.Fatalf("Failed to create depicts updater, %v", err)
+		}
+
+		u.Policy = depicts_policy
+
+		p.PostWriteHooks = append(p.PostWriteHooks, u.Hook("depicts"))
+	}
+
+	if index_writer_uri != "" {
+		p.PostWriteHooks = append(p.PostWriteHooks, process.NewWriterHook("index", index_writer_uri))
+	}
+
+	if notify_url != "" {
+		p.PostWriteHooks = append(p.PostWriteHooks, process.NewWebhookHook("notify", notify_url, nil))
+	}
+
+	if journal_uri != "" {
+
+		journal_bucket, err := blob.OpenBucket(ctx, journal_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to open journal bucket, %v", err)
+		}
+
+		defer journal_bucket.Close()
+
+		journal, err := process.NewBlobJournal(journal_bucket, "")
+
+		if err != nil {
+			log.Fatalf("Failed to create journal, %v", err)
+		}
+
+		p.Journal = journal
+	}
+
+	if dryrun {
+		p.Dryrun = true
+		p.DiffWriter = os.Stdout
+	}
+
+	opts := &process.WatchOptions{
+		Processor: p,
+		Source:    source,
+		Markers:   markers,
+		Workers:   workers,
+	}
+
+	err = process.Watch(ctx, opts)
+
+	if err != nil {
+		log.Fatalf("Failed to watch reports, %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gocloud.dev/blob"
+)
+
+// ACL_PRIVATE is the canned ACL granting access to the owner of an object only.
+const ACL_PRIVATE string = "private"
+
+// ACL_PUBLIC_READ is the canned ACL granting read access to everyone.
+const ACL_PUBLIC_READ string = "public-read"
+
+// ACLDriver is an interface for assigning a canned ACL (using S3-style names like "public-read") to objects using the
+// driver-specific types exposed by the "As" functions of gocloud.dev/blob.WriterOptions.BeforeWrite and
+// gocloud.dev/blob.CopyOptions.BeforeCopy. The "file" driver is always registered. Drivers for other buckets are
+// registered by importing their package, in the same way that gocloud.dev/blob drivers are, so that applications only
+// link the SDKs they need. For example:
+//
+//	import (
+//		_ "github.com/sfomuseum/go-whosonfirst-media/common/acl/s3"
+//		_ "gocloud.dev/blob/s3blob"
+//	)
+type ACLDriver interface {
+	// BeforeWrite assigns an ACL to an object being written. It returns false if 'asFunc' does not expose the types the
+	// driver knows about (for example because the object is being written to a different kind of bucket).
+	BeforeWrite(acl string, asFunc func(interface{}) bool) (bool, error)
+	// BeforeCopy assigns an ACL to an object being copied. It returns false if 'asFunc' does not expose the types the
+	// driver knows about.
+	BeforeCopy(acl string, asFunc func(interface{}) bool) (bool, error)
+}
+
+var acl_drivers = make(map[string]ACLDriver)
+var acl_drivers_mu = new(sync.RWMutex)
+
+func init() {
+
+	ctx := context.Background()
+
+	err := RegisterACLDriver(ctx, "file", &fileACLDriver{})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegisterACLDriver will register 'driver' as the ACLDriver 'name'. It returns an error if an ACLDriver has already been
+// registered for 'name'.
+func RegisterACLDriver(ctx context.Context, name string, driver ACLDriver) error {
+
+	acl_drivers_mu.Lock()
+	defer acl_drivers_mu.Unlock()
+
+	name = strings.ToLower(name)
+
+	_, exists := acl_drivers[name]
+
+	if exists {
+		return fmt.Errorf("ACL driver '%s' already registered", name)
+	}
+
+	acl_drivers[name] = driver
+	return nil
+}
+
+// ACLDriverNames returns the list of registered ACL drivers.
+func ACLDriverNames() []string {
+
+	acl_drivers_mu.RLock()
+	defer acl_drivers_mu.RUnlock()
+
+	names := make([]string, 0)
+
+	for n := range acl_drivers {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// ACLWritePolicy is a WritePolicy implementation that extends DefaultWritePolicy to assign a canned ACL to objects using
+// the registered ACLDrivers. Buckets whose driver-specific types are not handled by any ACLDriver (for example
+// gocloud.dev/blob/memblob) are written without an ACL.
+type ACLWritePolicy struct {
+	*DefaultWritePolicy
+	// The canned ACL to assign to objects, for example "public-read". If "" then no ACL is assigned.
+	ACL string
+	// The names of the ACLDrivers to use. If empty then all the registered ACLDrivers are used. Names that have not been
+	// registered (because the package providing them has not been imported) are ignored.
+	Drivers []string
+}
+
+// NewACLWritePolicy returns a new ACLWritePolicy instance that assigns 'acl' to objects using all the registered ACLDrivers.
+func NewACLWritePolicy(acl string) *ACLWritePolicy {
+
+	p := &ACLWritePolicy{
+		DefaultWritePolicy: NewDefaultWritePolicy(),
+		ACL:                acl,
+	}
+
+	return p
+}
+
+// WriterOptions returns the blob.WriterOptions to use when writing the object described by 'attrs'.
+func (p *ACLWritePolicy) WriterOptions(ctx context.Context, attrs *WriteAttributes) (*blob.WriterOptions, error) {
+
+	opts, err := p.DefaultWritePolicy.WriterOptions(ctx, attrs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	drivers, err := p.drivers()
+
+	if err != nil {
+		return nil, err
+	}
+
+	before_write := opts.BeforeWrite
+
+	opts.BeforeWrite = func(asFunc func(interface{}) bool) error {
+
+		if before_write != nil {
+
+			err := before_write(asFunc)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if p.ACL == "" {
+			return nil
+		}
+
+		for name, d := range drivers {
+
+			_, err := d.BeforeWrite(p.ACL, asFunc)
+
+			if err != nil {
+				return fmt.Errorf("Failed to assign ACL using '%s' driver, %w", name, err)
+			}
+		}
+
+		return nil
+	}
+
+	return opts, nil
+}
+
+// CopyOptions returns the blob.CopyOptions to use when copying the object described by 'attrs'.
+func (p *ACLWritePolicy) CopyOptions(ctx context.Context, attrs *WriteAttributes) (*blob.CopyOptions, error) {
+
+	opts, err := p.DefaultWritePolicy.CopyOptions(ctx, attrs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	drivers, err := p.drivers()
+
+	if err != nil {
+		return nil, err
+	}
+
+	before_copy := opts.BeforeCopy
+
+	opts.BeforeCopy = func(asFunc func(interface{}) bool) error {
+
+		if before_copy != nil {
+
+			err := before_copy(asFunc)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if p.ACL == "" {
+			return nil
+		}
+
+		for name, d := range drivers {
+
+			_, err := d.BeforeCopy(p.ACL, asFunc)
+
+			if err != nil {
+				return fmt.Errorf("Failed to assign ACL using '%s' driver, %w", name, err)
+			}
+		}
+
+		return nil
+	}
+
+	return opts, nil
+}
+
+// drivers returns the ACLDrivers, keyed by name, used by 'p'.
+func (p *ACLWritePolicy) drivers() (map[string]ACLDriver, error) {
+
+	acl_drivers_mu.RLock()
+	defer acl_drivers_mu.RUnlock()
+
+	drivers := make(map[string]ACLDriver)
+
+	if len(p.Drivers) == 0 {
+
+		for name, d := range acl_drivers {
+			drivers[name] = d
+		}
+
+		return drivers, nil
+	}
+
+	for _, name := range p.Drivers {
+
+		name = strings.ToLower(name)
+		d, exists := acl_drivers[name]
+
+		if !exists {
+			slog.Debug("ACL driver has not been registered, skipping", "driver", name)
+			continue
+		}
+
+		drivers[name] = d
+	}
+
+	return drivers, nil
+}
+
+// fileACLDriver assigns ACLs to objects in gocloud.dev/blob/fileblob buckets by setting their file permissions.
+type fileACLDriver struct{}
+
+func (d *fileACLDriver) BeforeWrite(acl string, asFunc func(interface{}) bool) (bool, error) {
+	return d.chmod(acl, asFunc)
+}
+
+func (d *fileACLDriver) BeforeCopy(acl string, asFunc func(interface{}) bool) (bool, error) {
+	return d.chmod(acl, asFunc)
+}
+
+func (d *fileACLDriver) chmod(acl string, asFunc func(interface{}) bool) (bool, error) {
+
+	var fh *os.File
+
+	if !asFunc(&fh) {
+		return false, nil
+	}
+
+	var mode os.FileMode
+
+	switch acl {
+	case ACL_PRIVATE:
+		mode = 0600
+	case ACL_PUBLIC_READ:
+		mode = 0644
+	case "public-read-write":
+		mode = 0666
+	default:
+		return true, fmt.Errorf("Unsupported file ACL '%s'", acl)
+	}
+
+	err := fh.Chmod(mode)
+
+	if err != nil {
+		return true, fmt.Errorf("Failed to set permissions for %s, %w", fh.Name(), err)
+	}
+
+	return true, nil
+}
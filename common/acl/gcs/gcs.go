@@ -0,0 +1,82 @@
+// package gcs provides a common.ACLDriver implementation for gocloud.dev/blob/gcsblob buckets, using predefined ACLs. It
+// is registered as the "gcs" ACL driver when the package is imported.
+package gcs
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+)
+
+func init() {
+
+	ctx := context.Background()
+
+	err := common.RegisterACLDriver(ctx, "gcs", &aclDriver{})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// aclDriver assigns ACLs to objects in gocloud.dev/blob/gcsblob buckets using predefined ACLs.
+type aclDriver struct{}
+
+func (d *aclDriver) BeforeWrite(acl string, asFunc func(interface{}) bool) (bool, error) {
+
+	var wr *storage.Writer
+
+	if !asFunc(&wr) {
+		return false, nil
+	}
+
+	predefined, err := predefinedACL(acl)
+
+	if err != nil {
+		return true, err
+	}
+
+	wr.PredefinedACL = predefined
+	return true, nil
+}
+
+func (d *aclDriver) BeforeCopy(acl string, asFunc func(interface{}) bool) (bool, error) {
+
+	var copier *storage.Copier
+
+	if !asFunc(&copier) {
+		return false, nil
+	}
+
+	predefined, err := predefinedACL(acl)
+
+	if err != nil {
+		return true, err
+	}
+
+	copier.PredefinedACL = predefined
+	return true, nil
+}
+
+// predefinedACL returns the Google Cloud Storage predefined ACL equivalent to the S3-style canned ACL 'acl'.
+func predefinedACL(acl string) (string, error) {
+
+	switch acl {
+	case common.ACL_PRIVATE:
+		return "private", nil
+	case common.ACL_PUBLIC_READ:
+		return "publicRead", nil
+	case "public-read-write":
+		return "publicReadWrite", nil
+	case "authenticated-read":
+		return "authenticatedRead", nil
+	case "bucket-owner-read":
+		return "bucketOwnerRead", nil
+	case "bucket-owner-full-control":
+		return "bucketOwnerFullControl", nil
+	default:
+		return "", fmt.Errorf("Unsupported GCS ACL '%s'", acl)
+	}
+}
@@ -0,0 +1,75 @@
+// package s3 provides a common.ACLDriver implementation for gocloud.dev/blob/s3blob buckets, using the aws-sdk-go-v2 SDK.
+// It is registered as the "s3" ACL driver when the package is imported.
+package s3
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+)
+
+func init() {
+
+	ctx := context.Background()
+
+	err := common.RegisterACLDriver(ctx, "s3", &aclDriver{})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// aclDriver assigns ACLs to objects in gocloud.dev/blob/s3blob buckets using the aws-sdk-go-v2 SDK.
+type aclDriver struct{}
+
+func (d *aclDriver) BeforeWrite(acl string, asFunc func(interface{}) bool) (bool, error) {
+
+	var req *s3.PutObjectInput
+
+	if !asFunc(&req) {
+		return false, nil
+	}
+
+	canned, err := cannedACL(acl)
+
+	if err != nil {
+		return true, err
+	}
+
+	req.ACL = canned
+	return true, nil
+}
+
+func (d *aclDriver) BeforeCopy(acl string, asFunc func(interface{}) bool) (bool, error) {
+
+	var req *s3.CopyObjectInput
+
+	if !asFunc(&req) {
+		return false, nil
+	}
+
+	canned, err := cannedACL(acl)
+
+	if err != nil {
+		return true, err
+	}
+
+	req.ACL = canned
+	return true, nil
+}
+
+// cannedACL returns the types.ObjectCannedACL for 'acl'.
+func cannedACL(acl string) (types.ObjectCannedACL, error) {
+
+	canned := types.ObjectCannedACL(acl)
+
+	if !slices.Contains(canned.Values(), canned) {
+		return "", fmt.Errorf("Unsupported S3 ACL '%s'", acl)
+	}
+
+	return canned, nil
+}
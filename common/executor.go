@@ -0,0 +1,99 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DEFAULT_WORKERS is the default number of functions that an Executor will run concurrently.
+const DEFAULT_WORKERS int = 10
+
+// ExecuteFunc is a function run by an Executor for the item at index 'idx'.
+type ExecuteFunc func(ctx context.Context, idx int) error
+
+// ExecutorOptions is a struct containing configuration details for an Executor.
+type ExecutorOptions struct {
+	// The maximum number of functions to run concurrently. If 0 then DEFAULT_WORKERS is used.
+	Workers int
+	// Boolean flag to signal that remaining items should be cancelled as soon as any function returns an error.
+	FailFast bool
+}
+
+// Executor is a struct for running functions with a bounded number of concurrent workers. Unlike a goroutine-per-item
+// approach waiting on results is blocking so idle executors do not consume CPU.
+type Executor struct {
+	workers   int
+	fail_fast bool
+}
+
+// NewExecutor returns a new Executor instance configured by 'opts'.
+func NewExecutor(opts *ExecutorOptions) *Executor {
+
+	workers := opts.Workers
+
+	if workers <= 0 {
+		workers = DEFAULT_WORKERS
+	}
+
+	e := &Executor{
+		workers:   workers,
+		fail_fast: opts.FailFast,
+	}
+
+	return e
+}
+
+// Execute calls 'fn' for each index in the range [0, count), with at most the configured number of workers running
+// concurrently, and blocks until all the calls have completed. If 'ctx' is cancelled (or the Executor is configured to
+// fail fast and a call returns an error) then items which have not yet started are skipped. The return value is the
+// errors.Join of all the errors returned by 'fn', in index order.
+func (e *Executor) Execute(ctx context.Context, count int, fn ExecuteFunc) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	throttle := make(chan bool, e.workers)
+	wg := new(sync.WaitGroup)
+
+	errs := make([]error, count)
+
+	for idx := 0; idx < count; idx++ {
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			// The check at the top of the loop will stop iterating
+			continue
+		case throttle <- true:
+
+			wg.Add(1)
+
+			go func(idx int) {
+
+				defer func() {
+					<-throttle
+					wg.Done()
+				}()
+
+				err := fn(ctx, idx)
+
+				if err != nil {
+
+					errs[idx] = err
+
+					if e.fail_fast {
+						cancel()
+					}
+				}
+			}(idx)
+		}
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
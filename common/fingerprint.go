@@ -34,3 +34,12 @@ func FingerprintFile(ctx context.Context, bucket *blob.Bucket, path string) (str
 
 	return str, nil
 }
+
+// Generate a SHA-1 hash of a byte slice.
+func FingerprintBytes(body []byte) string {
+
+	hash := sha1.Sum(body)
+	str := hex.EncodeToString(hash[:])
+
+	return str
+}
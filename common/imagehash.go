@@ -145,3 +145,28 @@ func imageHash(ctx context.Context, im image.Image, approach string) (*ImageHash
 
 	return nil, fmt.Errorf("Impossible condition")
 }
+
+// ImageHashDistance returns the Hamming distance between two string-encoded image hashes (as produced by ImageHashes).
+// Both hashes must have been derived using the same approach.
+func ImageHashDistance(a string, b string) (int, error) {
+
+	h_a, err := goimagehash.ImageHashFromString(a)
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse image hash '%s', %w", a, err)
+	}
+
+	h_b, err := goimagehash.ImageHashFromString(b)
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse image hash '%s', %w", b, err)
+	}
+
+	d, err := h_a.Distance(h_b)
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to derive distance between '%s' and '%s', %w", a, b, err)
+	}
+
+	return d, nil
+}
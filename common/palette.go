@@ -0,0 +1,409 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nfnt/resize"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"gocloud.dev/blob"
+)
+
+// DEFAULT_PALETTE_COUNT is the default maximum number of colours returned by ExtractPalette.
+const DEFAULT_PALETTE_COUNT int = 5
+
+// DEFAULT_PALETTE_REFERENCE is the default reference palette that colours are snapped to by ExtractPalette.
+const DEFAULT_PALETTE_REFERENCE string = "crayola"
+
+// palette_sample_size is the maximum pixel dimension that images are downscaled to before their palette is extracted.
+const palette_sample_size uint = 128
+
+// ReferenceColour is a struct defining a named colour in a reference palette.
+type ReferenceColour struct {
+	// The name of the colour.
+	Name string
+	// The hexidecimal value of the colour, including a leading "#".
+	Hex string
+}
+
+// PaletteOptions is a struct containing configuration details for extracting the colour palette of an image.
+type PaletteOptions struct {
+	// The maximum number of colours to return. If 0 then DEFAULT_PALETTE_COUNT is used.
+	Count int
+	// The name of a reference palette, registered using RegisterReferencePalette, that colours are snapped to. If ""
+	// then colours are not snapped and are named by their hexidecimal value.
+	Reference string
+}
+
+// NewPaletteOptions returns a new PaletteOptions instance using DEFAULT_PALETTE_COUNT and DEFAULT_PALETTE_REFERENCE.
+func NewPaletteOptions() *PaletteOptions {
+
+	opts := &PaletteOptions{
+		Count:     DEFAULT_PALETTE_COUNT,
+		Reference: DEFAULT_PALETTE_REFERENCE,
+	}
+
+	return opts
+}
+
+var reference_palettes = make(map[string][]*ReferenceColour)
+var reference_palettes_mu = new(sync.RWMutex)
+
+func init() {
+
+	ctx := context.Background()
+
+	err := RegisterReferencePalette(ctx, "css4", css4_colours)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = RegisterReferencePalette(ctx, "crayola", crayola_colours)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegisterReferencePalette will register 'colours' as the reference palette 'name'. It returns an error if a reference
+// palette has already been registered for 'name' or if any of the colours have an invalid hexidecimal value.
+func RegisterReferencePalette(ctx context.Context, name string, colours []*ReferenceColour) error {
+
+	reference_palettes_mu.Lock()
+	defer reference_palettes_mu.Unlock()
+
+	name = strings.ToLower(name)
+
+	_, exists := reference_palettes[name]
+
+	if exists {
+		return fmt.Errorf("Reference palette '%s' already registered", name)
+	}
+
+	for _, c := range colours {
+
+		_, err := parseHex(c.Hex)
+
+		if err != nil {
+			return fmt.Errorf("Reference palette '%s' has an invalid colour '%s', %w", name, c.Name, err)
+		}
+	}
+
+	reference_palettes[name] = colours
+	return nil
+}
+
+// ReferencePaletteNames returns the list of registered reference palettes.
+func ReferencePaletteNames() []string {
+
+	reference_palettes_mu.RLock()
+	defer reference_palettes_mu.RUnlock()
+
+	names := make([]string, 0)
+
+	for n := range reference_palettes {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// PaletteFile will derive the colour palette for an image file stored in a blob.Bucket instance.
+func PaletteFile(ctx context.Context, bucket *blob.Bucket, im_path string, opts *PaletteOptions) ([]properties.Colour, error) {
+
+	r, err := bucket.NewReader(ctx, im_path, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create reader for %s, %w", im_path, err)
+	}
+
+	defer r.Close()
+
+	im, _, err := image.Decode(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode image from %s, %w", im_path, err)
+	}
+
+	return ExtractPalette(ctx, im, opts)
+}
+
+// ExtractPalette will derive the colour palette for 'im' using median-cut quantisation. Colours are ordered by the number
+// of pixels they represent, most common first. If opts.Reference is defined each colour is snapped to the closest colour
+// in that reference palette and duplicate (snapped) colours are merged.
+func ExtractPalette(ctx context.Context, im image.Image, opts *PaletteOptions) ([]properties.Colour, error) {
+
+	count := opts.Count
+
+	if count <= 0 {
+		count = DEFAULT_PALETTE_COUNT
+	}
+
+	var reference []*ReferenceColour
+
+	if opts.Reference != "" {
+
+		reference_palettes_mu.RLock()
+		r, ok := reference_palettes[strings.ToLower(opts.Reference)]
+		reference_palettes_mu.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("Unknown reference palette '%s'", opts.Reference)
+		}
+
+		reference = r
+	}
+
+	pixels := samplePixels(im)
+
+	if len(pixels) == 0 {
+		return nil, fmt.Errorf("Image has no opaque pixels")
+	}
+
+	// Oversample so that there are still enough distinct colours after snapping
+
+	boxes := medianCut(pixels, count*2)
+
+	sort.SliceStable(boxes, func(i, j int) bool {
+		return len(boxes[i]) > len(boxes[j])
+	})
+
+	palette := make([]properties.Colour, 0)
+	seen := make(map[string]bool)
+
+	for _, box := range boxes {
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			// pass
+		}
+
+		avg := averageColour(box)
+		hex := formatHex(avg)
+
+		c := properties.Colour{
+			Name: hex,
+			Hex:  hex,
+		}
+
+		if reference != nil {
+
+			ref := closestColour(avg, reference)
+
+			c = properties.Colour{
+				Name:      ref.Name,
+				Hex:       ref.Hex,
+				Reference: strings.ToLower(opts.Reference),
+			}
+		}
+
+		if seen[c.Hex] {
+			continue
+		}
+
+		seen[c.Hex] = true
+		palette = append(palette, c)
+
+		if len(palette) == count {
+			break
+		}
+	}
+
+	return palette, nil
+}
+
+// samplePixels returns the RGB values of the (mostly) opaque pixels in a downscaled copy of 'im'.
+func samplePixels(im image.Image) [][3]uint8 {
+
+	im = resize.Thumbnail(palette_sample_size, palette_sample_size, im, resize.Bilinear)
+
+	bounds := im.Bounds()
+	pixels := make([][3]uint8, 0, bounds.Dx()*bounds.Dy())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+
+			r, g, b, a := im.At(x, y).RGBA()
+
+			if a < 0x8000 {
+				continue
+			}
+
+			pixels = append(pixels, [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
+		}
+	}
+
+	return pixels
+}
+
+// medianCut partitions 'pixels' into (at most) 'count' boxes by repeatedly splitting the box with the widest channel
+// range at the median of that channel.
+func medianCut(pixels [][3]uint8, count int) [][][3]uint8 {
+
+	boxes := [][][3]uint8{pixels}
+
+	for len(boxes) < count {
+
+		idx := -1
+		channel := 0
+		widest := 0
+
+		for i, box := range boxes {
+
+			if len(box) < 2 {
+				continue
+			}
+
+			ch, rng := widestChannel(box)
+
+			if rng > widest {
+				idx = i
+				channel = ch
+				widest = rng
+			}
+		}
+
+		if idx == -1 {
+			break
+		}
+
+		box := boxes[idx]
+
+		sort.Slice(box, func(i, j int) bool {
+			return box[i][channel] < box[j][channel]
+		})
+
+		mid := len(box) / 2
+
+		boxes[idx] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	return boxes
+}
+
+// widestChannel returns the channel (0, 1 or 2 for red, green or blue) with the widest range of values in 'box' and that range.
+func widestChannel(box [][3]uint8) (int, int) {
+
+	min := [3]int{255, 255, 255}
+	max := [3]int{0, 0, 0}
+
+	for _, p := range box {
+
+		for ch := 0; ch < 3; ch++ {
+
+			v := int(p[ch])
+
+			if v < min[ch] {
+				min[ch] = v
+			}
+
+			if v > max[ch] {
+				max[ch] = v
+			}
+		}
+	}
+
+	channel := 0
+	widest := -1
+
+	for ch := 0; ch < 3; ch++ {
+
+		rng := max[ch] - min[ch]
+
+		if rng > widest {
+			channel = ch
+			widest = rng
+		}
+	}
+
+	return channel, widest
+}
+
+// averageColour returns the average RGB value of the pixels in 'box'.
+func averageColour(box [][3]uint8) [3]uint8 {
+
+	var sum [3]int
+
+	for _, p := range box {
+		sum[0] += int(p[0])
+		sum[1] += int(p[1])
+		sum[2] += int(p[2])
+	}
+
+	n := len(box)
+
+	return [3]uint8{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n)}
+}
+
+// closestColour returns the colour in 'reference' closest to 'c', using the "redmean" approximation of perceived colour distance.
+func closestColour(c [3]uint8, reference []*ReferenceColour) *ReferenceColour {
+
+	var closest *ReferenceColour
+	closest_d := -1
+
+	for _, ref := range reference {
+
+		ref_c, _ := parseHex(ref.Hex) // validated by RegisterReferencePalette
+
+		d := colourDistance(c, ref_c)
+
+		if closest_d == -1 || d < closest_d {
+			closest = ref
+			closest_d = d
+		}
+	}
+
+	return closest
+}
+
+// colourDistance returns the (squared, scaled) "redmean" distance between 'a' and 'b'.
+func colourDistance(a [3]uint8, b [3]uint8) int {
+
+	rmean := (int(a[0]) + int(b[0])) / 2
+
+	dr := int(a[0]) - int(b[0])
+	dg := int(a[1]) - int(b[1])
+	db := int(a[2]) - int(b[2])
+
+	return (((512 + rmean) * dr * dr) >> 8) + 4*dg*dg + (((767 - rmean) * db * db) >> 8)
+}
+
+// parseHex returns the RGB value of the "#rrggbb" string 'hex'.
+func parseHex(hex string) ([3]uint8, error) {
+
+	var c [3]uint8
+
+	str := strings.TrimPrefix(hex, "#")
+
+	if len(str) != 6 {
+		return c, fmt.Errorf("Invalid hex colour '%s'", hex)
+	}
+
+	v, err := strconv.ParseUint(str, 16, 32)
+
+	if err != nil {
+		return c, fmt.Errorf("Invalid hex colour '%s', %w", hex, err)
+	}
+
+	c[0] = uint8(v >> 16)
+	c[1] = uint8(v >> 8)
+	c[2] = uint8(v)
+
+	return c, nil
+}
+
+// formatHex returns the "#rrggbb" string for 'c'.
+func formatHex(c [3]uint8) string {
+	return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+}
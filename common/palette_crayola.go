@@ -0,0 +1,161 @@
+package common
+
+// crayola_colours are the standard Crayola crayon colours.
+var crayola_colours = []*ReferenceColour{
+	{Name: "Red", Hex: "#ed0a3f"},
+	{Name: "Maroon", Hex: "#c32148"},
+	{Name: "Scarlet", Hex: "#fd0e35"},
+	{Name: "Brick Red", Hex: "#c62d42"},
+	{Name: "English Vermilion", Hex: "#cc474b"},
+	{Name: "Madder Lake", Hex: "#cc3336"},
+	{Name: "Permanent Geranium Lake", Hex: "#e12c2c"},
+	{Name: "Maximum Red", Hex: "#d92121"},
+	{Name: "Indian Red", Hex: "#b94e48"},
+	{Name: "Orange-Red", Hex: "#ff5349"},
+	{Name: "Sunset Orange", Hex: "#fe4c40"},
+	{Name: "Bittersweet", Hex: "#fe6f5e"},
+	{Name: "Dark Venetian Red", Hex: "#b33b24"},
+	{Name: "Venetian Red", Hex: "#cc553d"},
+	{Name: "Light Venetian Red", Hex: "#e6735c"},
+	{Name: "Vivid Tangerine", Hex: "#ff9980"},
+	{Name: "Middle Red", Hex: "#e58e73"},
+	{Name: "Burnt Orange", Hex: "#ff7f49"},
+	{Name: "Red-Orange", Hex: "#ff681f"},
+	{Name: "Orange", Hex: "#ff8833"},
+	{Name: "Macaroni and Cheese", Hex: "#ffb97b"},
+	{Name: "Middle Yellow Red", Hex: "#ecac76"},
+	{Name: "Mango Tango", Hex: "#e77200"},
+	{Name: "Yellow-Orange", Hex: "#ffae42"},
+	{Name: "Maximum Yellow Red", Hex: "#f2ba49"},
+	{Name: "Banana Mania", Hex: "#fbe7b2"},
+	{Name: "Maize", Hex: "#f2c649"},
+	{Name: "Orange-Yellow", Hex: "#f8d568"},
+	{Name: "Goldenrod", Hex: "#fcd667"},
+	{Name: "Dandelion", Hex: "#fed85d"},
+	{Name: "Yellow", Hex: "#fbe870"},
+	{Name: "Green-Yellow", Hex: "#f1e788"},
+	{Name: "Middle Yellow", Hex: "#ffeb00"},
+	{Name: "Olive Green", Hex: "#b5b35c"},
+	{Name: "Spring Green", Hex: "#ecebbd"},
+	{Name: "Maximum Yellow", Hex: "#fafa37"},
+	{Name: "Canary", Hex: "#ffff99"},
+	{Name: "Lemon Yellow", Hex: "#ffff9f"},
+	{Name: "Maximum Green Yellow", Hex: "#d9e650"},
+	{Name: "Middle Green Yellow", Hex: "#acbf60"},
+	{Name: "Inchworm", Hex: "#afe313"},
+	{Name: "Light Chrome Green", Hex: "#bee64b"},
+	{Name: "Yellow-Green", Hex: "#c5e17a"},
+	{Name: "Maximum Green", Hex: "#5e8c31"},
+	{Name: "Asparagus", Hex: "#7ba05b"},
+	{Name: "Granny Smith Apple", Hex: "#9de093"},
+	{Name: "Fern", Hex: "#63b76c"},
+	{Name: "Middle Green", Hex: "#4d8c57"},
+	{Name: "Green", Hex: "#3aa655"},
+	{Name: "Medium Chrome Green", Hex: "#6ca67c"},
+	{Name: "Forest Green", Hex: "#5fa777"},
+	{Name: "Sea Green", Hex: "#93dfb8"},
+	{Name: "Shamrock", Hex: "#33cc99"},
+	{Name: "Mountain Meadow", Hex: "#1ab385"},
+	{Name: "Jungle Green", Hex: "#29ab87"},
+	{Name: "Caribbean Green", Hex: "#00cc99"},
+	{Name: "Tropical Rain Forest", Hex: "#00755e"},
+	{Name: "Pine Green", Hex: "#01786f"},
+	{Name: "Maximum Blue Green", Hex: "#30bfbf"},
+	{Name: "Robin's Egg Blue", Hex: "#00cccc"},
+	{Name: "Teal Blue", Hex: "#008080"},
+	{Name: "Light Blue", Hex: "#8fd8d8"},
+	{Name: "Aquamarine", Hex: "#95e0e8"},
+	{Name: "Turquoise Blue", Hex: "#6cdae7"},
+	{Name: "Outer Space", Hex: "#2d383a"},
+	{Name: "Sky Blue", Hex: "#76d7ea"},
+	{Name: "Middle Blue", Hex: "#7ed4e6"},
+	{Name: "Blue-Green", Hex: "#0095b7"},
+	{Name: "Pacific Blue", Hex: "#009dc4"},
+	{Name: "Cerulean", Hex: "#02a4d3"},
+	{Name: "Maximum Blue", Hex: "#47abcc"},
+	{Name: "Cerulean Blue", Hex: "#339acc"},
+	{Name: "Cornflower", Hex: "#93ccea"},
+	{Name: "Green-Blue", Hex: "#2887c8"},
+	{Name: "Midnight Blue", Hex: "#00468c"},
+	{Name: "Navy Blue", Hex: "#0066cc"},
+	{Name: "Denim", Hex: "#1560bd"},
+	{Name: "Blue", Hex: "#0066ff"},
+	{Name: "Cadet Blue", Hex: "#a9b2c3"},
+	{Name: "Periwinkle", Hex: "#c3cde6"},
+	{Name: "Wild Blue Yonder", Hex: "#7a89b8"},
+	{Name: "Indigo", Hex: "#4f69c6"},
+	{Name: "Manatee", Hex: "#8d90a1"},
+	{Name: "Cobalt Blue", Hex: "#8c90c8"},
+	{Name: "Celestial Blue", Hex: "#7070cc"},
+	{Name: "Blue Bell", Hex: "#9999cc"},
+	{Name: "Maximum Blue Purple", Hex: "#acace6"},
+	{Name: "Violet-Blue", Hex: "#766ec8"},
+	{Name: "Blue-Violet", Hex: "#6456b7"},
+	{Name: "Ultramarine Blue", Hex: "#3f26bf"},
+	{Name: "Middle Blue Purple", Hex: "#8b72be"},
+	{Name: "Purple Heart", Hex: "#652dc1"},
+	{Name: "Royal Purple", Hex: "#6b3fa0"},
+	{Name: "Violet", Hex: "#8359a3"},
+	{Name: "Medium Violet", Hex: "#8f47b3"},
+	{Name: "Wisteria", Hex: "#c9a0dc"},
+	{Name: "Lavender", Hex: "#bf8fcc"},
+	{Name: "Vivid Violet", Hex: "#803790"},
+	{Name: "Maximum Purple", Hex: "#733380"},
+	{Name: "Purple Mountains' Majesty", Hex: "#d6aedd"},
+	{Name: "Fuchsia", Hex: "#c154c1"},
+	{Name: "Pink Flamingo", Hex: "#fc74fd"},
+	{Name: "Brilliant Rose", Hex: "#e667ce"},
+	{Name: "Orchid", Hex: "#e29cd2"},
+	{Name: "Plum", Hex: "#8e3179"},
+	{Name: "Medium Rose", Hex: "#d96cbe"},
+	{Name: "Thistle", Hex: "#ebb0d7"},
+	{Name: "Mulberry", Hex: "#c8509b"},
+	{Name: "Red-Violet", Hex: "#bb3385"},
+	{Name: "Middle Purple", Hex: "#d982b5"},
+	{Name: "Maximum Red Purple", Hex: "#a63a79"},
+	{Name: "Jazzberry Jam", Hex: "#a50b5e"},
+	{Name: "Eggplant", Hex: "#614051"},
+	{Name: "Magenta", Hex: "#f653a6"},
+	{Name: "Cerise", Hex: "#da3287"},
+	{Name: "Wild Strawberry", Hex: "#ff3399"},
+	{Name: "Cotton Candy", Hex: "#ffb7d5"},
+	{Name: "Carnation Pink", Hex: "#ffa6c9"},
+	{Name: "Violet-Red", Hex: "#f7468a"},
+	{Name: "Razzmatazz", Hex: "#e30b5c"},
+	{Name: "Pig Pink", Hex: "#fdd7e4"},
+	{Name: "Carmine", Hex: "#e62e6b"},
+	{Name: "Blush", Hex: "#db5079"},
+	{Name: "Tickle Me Pink", Hex: "#fc80a5"},
+	{Name: "Mauvelous", Hex: "#f091a9"},
+	{Name: "Salmon", Hex: "#ff91a4"},
+	{Name: "Middle Red Purple", Hex: "#a55353"},
+	{Name: "Mahogany", Hex: "#ca3435"},
+	{Name: "Melon", Hex: "#febaad"},
+	{Name: "Pink Sherbert", Hex: "#f7a38e"},
+	{Name: "Burnt Sienna", Hex: "#e97451"},
+	{Name: "Brown", Hex: "#af593e"},
+	{Name: "Sepia", Hex: "#9e5b40"},
+	{Name: "Fuzzy Wuzzy", Hex: "#87421f"},
+	{Name: "Beaver", Hex: "#926f5b"},
+	{Name: "Tumbleweed", Hex: "#dea681"},
+	{Name: "Raw Sienna", Hex: "#d27d46"},
+	{Name: "Van Dyke Brown", Hex: "#664228"},
+	{Name: "Tan", Hex: "#d99a6c"},
+	{Name: "Desert Sand", Hex: "#edc9af"},
+	{Name: "Peach", Hex: "#ffcba4"},
+	{Name: "Burnt Umber", Hex: "#805533"},
+	{Name: "Apricot", Hex: "#fdd5b1"},
+	{Name: "Almond", Hex: "#eed9c4"},
+	{Name: "Raw Umber", Hex: "#665233"},
+	{Name: "Shadow", Hex: "#837050"},
+	{Name: "Gold", Hex: "#e6be8a"},
+	{Name: "Silver", Hex: "#c9c0bb"},
+	{Name: "Copper", Hex: "#da8a67"},
+	{Name: "Antique Brass", Hex: "#c88a65"},
+	{Name: "Black", Hex: "#000000"},
+	{Name: "Charcoal Gray", Hex: "#736a62"},
+	{Name: "Gray", Hex: "#8b8680"},
+	{Name: "Blue-Gray", Hex: "#c8c8cd"},
+	{Name: "Timberwolf", Hex: "#d9d6cf"},
+	{Name: "White", Hex: "#ffffff"},
+}
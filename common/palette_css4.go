@@ -0,0 +1,144 @@
+package common
+
+// css4_colours are the CSS Color Module Level 4 named colours (excluding alternate spellings).
+var css4_colours = []*ReferenceColour{
+	{Name: "aliceblue", Hex: "#f0f8ff"},
+	{Name: "antiquewhite", Hex: "#faebd7"},
+	{Name: "aqua", Hex: "#00ffff"},
+	{Name: "aquamarine", Hex: "#7fffd4"},
+	{Name: "azure", Hex: "#f0ffff"},
+	{Name: "beige", Hex: "#f5f5dc"},
+	{Name: "bisque", Hex: "#ffe4c4"},
+	{Name: "black", Hex: "#000000"},
+	{Name: "blanchedalmond", Hex: "#ffebcd"},
+	{Name: "blue", Hex: "#0000ff"},
+	{Name: "blueviolet", Hex: "#8a2be2"},
+	{Name: "brown", Hex: "#a52a2a"},
+	{Name: "burlywood", Hex: "#deb887"},
+	{Name: "cadetblue", Hex: "#5f9ea0"},
+	{Name: "chartreuse", Hex: "#7fff00"},
+	{Name: "chocolate", Hex: "#d2691e"},
+	{Name: "coral", Hex: "#ff7f50"},
+	{Name: "cornflowerblue", Hex: "#6495ed"},
+	{Name: "cornsilk", Hex: "#fff8dc"},
+	{Name: "crimson", Hex: "#dc143c"},
+	{Name: "darkblue", Hex: "#00008b"},
+	{Name: "darkcyan", Hex: "#008b8b"},
+	{Name: "darkgoldenrod", Hex: "#b8860b"},
+	{Name: "darkgray", Hex: "#a9a9a9"},
+	{Name: "darkgreen", Hex: "#006400"},
+	{Name: "darkkhaki", Hex: "#bdb76b"},
+	{Name: "darkmagenta", Hex: "#8b008b"},
+	{Name: "darkolivegreen", Hex: "#556b2f"},
+	{Name: "darkorange", Hex: "#ff8c00"},
+	{Name: "darkorchid", Hex: "#9932cc"},
+	{Name: "darkred", Hex: "#8b0000"},
+	{Name: "darksalmon", Hex: "#e9967a"},
+	{Name: "darkseagreen", Hex: "#8fbc8f"},
+	{Name: "darkslateblue", Hex: "#483d8b"},
+	{Name: "darkslategray", Hex: "#2f4f4f"},
+	{Name: "darkturquoise", Hex: "#00ced1"},
+	{Name: "darkviolet", Hex: "#9400d3"},
+	{Name: "deeppink", Hex: "#ff1493"},
+	{Name: "deepskyblue", Hex: "#00bfff"},
+	{Name: "dimgray", Hex: "#696969"},
+	{Name: "dodgerblue", Hex: "#1e90ff"},
+	{Name: "firebrick", Hex: "#b22222"},
+	{Name: "floralwhite", Hex: "#fffaf0"},
+	{Name: "forestgreen", Hex: "#228b22"},
+	{Name: "fuchsia", Hex: "#ff00ff"},
+	{Name: "gainsboro", Hex: "#dcdcdc"},
+	{Name: "ghostwhite", Hex: "#f8f8ff"},
+	{Name: "gold", Hex: "#ffd700"},
+	{Name: "goldenrod", Hex: "#daa520"},
+	{Name: "gray", Hex: "#808080"},
+	{Name: "green", Hex: "#008000"},
+	{Name: "greenyellow", Hex: "#adff2f"},
+	{Name: "honeydew", Hex: "#f0fff0"},
+	{Name: "hotpink", Hex: "#ff69b4"},
+	{Name: "indianred", Hex: "#cd5c5c"},
+	{Name: "indigo", Hex: "#4b0082"},
+	{Name: "ivory", Hex: "#fffff0"},
+	{Name: "khaki", Hex: "#f0e68c"},
+	{Name: "lavender", Hex: "#e6e6fa"},
+	{Name: "lavenderblush", Hex: "#fff0f5"},
+	{Name: "lawngreen", Hex: "#7cfc00"},
+	{Name: "lemonchiffon", Hex: "#fffacd"},
+	{Name: "lightblue", Hex: "#add8e6"},
+	{Name: "lightcoral", Hex: "#f08080"},
+	{Name: "lightcyan", Hex: "#e0ffff"},
+	{Name: "lightgoldenrodyellow", Hex: "#fafad2"},
+	{Name: "lightgray", Hex: "#d3d3d3"},
+	{Name: "lightgreen", Hex: "#90ee90"},
+	{Name: "lightpink", Hex: "#ffb6c1"},
+	{Name: "lightsalmon", Hex: "#ffa07a"},
+	{Name: "lightseagreen", Hex: "#20b2aa"},
+	{Name: "lightskyblue", Hex: "#87cefa"},
+	{Name: "lightslategray", Hex: "#778899"},
+	{Name: "lightsteelblue", Hex: "#b0c4de"},
+	{Name: "lightyellow", Hex: "#ffffe0"},
+	{Name: "lime", Hex: "#00ff00"},
+	{Name: "limegreen", Hex: "#32cd32"},
+	{Name: "linen", Hex: "#faf0e6"},
+	{Name: "maroon", Hex: "#800000"},
+	{Name: "mediumaquamarine", Hex: "#66cdaa"},
+	{Name: "mediumblue", Hex: "#0000cd"},
+	{Name: "mediumorchid", Hex: "#ba55d3"},
+	{Name: "mediumpurple", Hex: "#9370db"},
+	{Name: "mediumseagreen", Hex: "#3cb371"},
+	{Name: "mediumslateblue", Hex: "#7b68ee"},
+	{Name: "mediumspringgreen", Hex: "#00fa9a"},
+	{Name: "mediumturquoise", Hex: "#48d1cc"},
+	{Name: "mediumvioletred", Hex: "#c71585"},
+	{Name: "midnightblue", Hex: "#191970"},
+	{Name: "mintcream", Hex: "#f5fffa"},
+	{Name: "mistyrose", Hex: "#ffe4e1"},
+	{Name: "moccasin", Hex: "#ffe4b5"},
+	{Name: "navajowhite", Hex: "#ffdead"},
+	{Name: "navy", Hex: "#000080"},
+	{Name: "oldlace", Hex: "#fdf5e6"},
+	{Name: "olive", Hex: "#808000"},
+	{Name: "olivedrab", Hex: "#6b8e23"},
+	{Name: "orange", Hex: "#ffa500"},
+	{Name: "orangered", Hex: "#ff4500"},
+	{Name: "orchid", Hex: "#da70d6"},
+	{Name: "palegoldenrod", Hex: "#eee8aa"},
+	{Name: "palegreen", Hex: "#98fb98"},
+	{Name: "paleturquoise", Hex: "#afeeee"},
+	{Name: "palevioletred", Hex: "#db7093"},
+	{Name: "papayawhip", Hex: "#ffefd5"},
+	{Name: "peachpuff", Hex: "#ffdab9"},
+	{Name: "peru", Hex: "#cd853f"},
+	{Name: "pink", Hex: "#ffc0cb"},
+	{Name: "plum", Hex: "#dda0dd"},
+	{Name: "powderblue", Hex: "#b0e0e6"},
+	{Name: "purple", Hex: "#800080"},
+	{Name: "rebeccapurple", Hex: "#663399"},
+	{Name: "red", Hex: "#ff0000"},
+	{Name: "rosybrown", Hex: "#bc8f8f"},
+	{Name: "royalblue", Hex: "#4169e1"},
+	{Name: "saddlebrown", Hex: "#8b4513"},
+	{Name: "salmon", Hex: "#fa8072"},
+	{Name: "sandybrown", Hex: "#f4a460"},
+	{Name: "seagreen", Hex: "#2e8b57"},
+	{Name: "seashell", Hex: "#fff5ee"},
+	{Name: "sienna", Hex: "#a0522d"},
+	{Name: "silver", Hex: "#c0c0c0"},
+	{Name: "skyblue", Hex: "#87ceeb"},
+	{Name: "slateblue", Hex: "#6a5acd"},
+	{Name: "slategray", Hex: "#708090"},
+	{Name: "snow", Hex: "#fffafa"},
+	{Name: "springgreen", Hex: "#00ff7f"},
+	{Name: "steelblue", Hex: "#4682b4"},
+	{Name: "tan", Hex: "#d2b48c"},
+	{Name: "teal", Hex: "#008080"},
+	{Name: "thistle", Hex: "#d8bfd8"},
+	{Name: "tomato", Hex: "#ff6347"},
+	{Name: "turquoise", Hex: "#40e0d0"},
+	{Name: "violet", Hex: "#ee82ee"},
+	{Name: "wheat", Hex: "#f5deb3"},
+	{Name: "white", Hex: "#ffffff"},
+	{Name: "whitesmoke", Hex: "#f5f5f5"},
+	{Name: "yellow", Hex: "#ffff00"},
+	{Name: "yellowgreen", Hex: "#9acd32"},
+}
@@ -0,0 +1,224 @@
+package common
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+)
+
+// testPaletteImage returns a 64x64 image where the leftmost 'split' columns are 'a' and the remaining columns are 'b'. The
+// image is smaller than palette_sample_size so it is not resampled, and no blended colours are introduced, by ExtractPalette.
+func testPaletteImage(a color.Color, b color.Color, split int) image.Image {
+
+	im := image.NewRGBA(image.Rect(0, 0, 64, 64))
+
+	for x := 0; x < 64; x++ {
+
+		c := a
+
+		if x >= split {
+			c = b
+		}
+
+		for y := 0; y < 64; y++ {
+			im.Set(x, y, c)
+		}
+	}
+
+	return im
+}
+
+func TestExtractPalette(t *testing.T) {
+
+	ctx := context.Background()
+
+	css4_blue := color.RGBA{0x00, 0x00, 0xff, 0xff}
+	css4_red := color.RGBA{0xff, 0x00, 0x00, 0xff}
+	crayola_red := color.RGBA{0xed, 0x0a, 0x3f, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	tests := []struct {
+		Name      string
+		Image     image.Image
+		Reference string
+		Expected  []properties.Colour
+	}{
+		{
+			"solid unsnapped",
+			testPaletteImage(crayola_red, crayola_red, 64),
+			"",
+			[]properties.Colour{
+				{Name: "#ed0a3f", Hex: "#ed0a3f"},
+			},
+		},
+		{
+			"solid css4",
+			testPaletteImage(css4_red, css4_red, 64),
+			"css4",
+			[]properties.Colour{
+				{Name: "red", Hex: "#ff0000", Reference: "css4"},
+			},
+		},
+		{
+			// Close to, but not exactly, css4 red
+			"solid css4 snapped",
+			testPaletteImage(color.RGBA{0xf4, 0x08, 0x04, 0xff}, color.RGBA{0xf4, 0x08, 0x04, 0xff}, 64),
+			"css4",
+			[]properties.Colour{
+				{Name: "red", Hex: "#ff0000", Reference: "css4"},
+			},
+		},
+		{
+			"solid crayola",
+			testPaletteImage(crayola_red, crayola_red, 64),
+			"crayola",
+			[]properties.Colour{
+				{Name: "Red", Hex: "#ed0a3f", Reference: "crayola"},
+			},
+		},
+		{
+			"two colours unsnapped",
+			testPaletteImage(css4_blue, white, 48),
+			"",
+			[]properties.Colour{
+				{Name: "#0000ff", Hex: "#0000ff"},
+				{Name: "#ffffff", Hex: "#ffffff"},
+			},
+		},
+		{
+			"two colours css4",
+			testPaletteImage(css4_blue, white, 48),
+			"css4",
+			[]properties.Colour{
+				{Name: "blue", Hex: "#0000ff", Reference: "css4"},
+				{Name: "white", Hex: "#ffffff", Reference: "css4"},
+			},
+		},
+		{
+			// The less common colour is listed second
+			"two colours crayola",
+			testPaletteImage(white, crayola_red, 16),
+			"crayola",
+			[]properties.Colour{
+				{Name: "Red", Hex: "#ed0a3f", Reference: "crayola"},
+				{Name: "White", Hex: "#ffffff", Reference: "crayola"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			opts := NewPaletteOptions()
+			opts.Reference = test.Reference
+
+			palette, err := ExtractPalette(ctx, test.Image, opts)
+
+			if err != nil {
+				t.Fatalf("Failed to extract palette, %v", err)
+			}
+
+			if len(palette) != len(test.Expected) {
+				t.Fatalf("Expected %d colours, got %d (%v)", len(test.Expected), len(palette), palette)
+			}
+
+			for i, c := range palette {
+
+				if c != test.Expected[i] {
+					t.Fatalf("Unexpected colour at position %d, %v (expected %v)", i, c, test.Expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractPaletteErrors(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := NewPaletteOptions()
+	opts.Reference = "pantone"
+
+	_, err := ExtractPalette(ctx, testPaletteImage(color.White, color.White, 64), opts)
+
+	if err == nil {
+		t.Fatalf("Expected unknown reference palette to fail")
+	}
+
+	opts = NewPaletteOptions()
+
+	_, err = ExtractPalette(ctx, testPaletteImage(color.Transparent, color.Transparent, 64), opts)
+
+	if err == nil {
+		t.Fatalf("Expected image without opaque pixels to fail")
+	}
+}
+
+func TestMedianCut(t *testing.T) {
+
+	blue := [3]uint8{0x00, 0x00, 0xff}
+	white := [3]uint8{0xff, 0xff, 0xff}
+
+	pixels := make([][3]uint8, 0)
+
+	for i := 0; i < 30; i++ {
+		pixels = append(pixels, blue)
+	}
+
+	for i := 0; i < 10; i++ {
+		pixels = append(pixels, white)
+	}
+
+	// Boxes are only split while they contain more than one colour so asking for more boxes than there are
+	// colours is allowed
+
+	for _, count := range []int{1, 2, 4, 10} {
+
+		input := make([][3]uint8, len(pixels))
+		copy(input, pixels)
+
+		boxes := medianCut(input, count)
+
+		if len(boxes) > count {
+			t.Fatalf("Expected at most %d boxes, got %d", count, len(boxes))
+		}
+
+		total := 0
+
+		for _, box := range boxes {
+			total += len(box)
+		}
+
+		if total != len(pixels) {
+			t.Fatalf("Expected boxes to contain %d pixels, got %d", len(pixels), total)
+		}
+
+		// Boxes are split at the median so when two boxes are requested each contains 20 pixels and the second mixes
+		// both colours
+
+		if count < 3 {
+			continue
+		}
+
+		counts := make(map[[3]uint8]int)
+
+		for _, box := range boxes {
+
+			_, rng := widestChannel(box)
+
+			if rng != 0 {
+				t.Fatalf("Expected every box to contain a single colour when %d boxes are requested", count)
+			}
+
+			counts[box[0]] += len(box)
+		}
+
+		if counts[blue] != 30 || counts[white] != 10 {
+			t.Fatalf("Unexpected pixel counts, %v", counts)
+		}
+	}
+}
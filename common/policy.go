@@ -0,0 +1,133 @@
+package common
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"gocloud.dev/blob"
+)
+
+// WriteAttributes is a struct containing details about an object being written to a blob.Bucket, used by a WritePolicy to
+// derive the options for the write.
+type WriteAttributes struct {
+	// The key of the object being written.
+	Key string
+	// The content type of the object, typically derived using SniffContentType.
+	ContentType string
+	// The WOF ID the object is associated with (or 0).
+	ID int64
+	// The SHA-1 fingerprint of the object (or "").
+	Fingerprint string
+}
+
+// WritePolicy is an interface for deriving the options used when writing, or copying, objects to a blob.Bucket.
+type WritePolicy interface {
+	// WriterOptions returns the blob.WriterOptions to use when writing the object described by WriteAttributes.
+	WriterOptions(context.Context, *WriteAttributes) (*blob.WriterOptions, error)
+	// CopyOptions returns the blob.CopyOptions to use when copying the object described by WriteAttributes to its key.
+	CopyOptions(context.Context, *WriteAttributes) (*blob.CopyOptions, error)
+}
+
+// DefaultWritePolicy is a WritePolicy implementation that sets the content type of objects, an optional Cache-Control
+// header, custom metadata and optional driver-specific options.
+type DefaultWritePolicy struct {
+	// An optional Cache-Control header to assign to objects.
+	CacheControl string
+	// Optional custom metadata to assign to objects. The "wof-id" and "fingerprint" keys are always assigned if the
+	// corresponding WriteAttributes are present.
+	Metadata map[string]string
+	// An optional function for assigning driver-specific options (for example an S3 ACL) before an object is written.
+	// See blob.WriterOptions.BeforeWrite for details.
+	BeforeWrite func(asFunc func(interface{}) bool) error
+	// An optional function for assigning driver-specific options before an object is copied.
+	// See blob.CopyOptions.BeforeCopy for details.
+	BeforeCopy func(asFunc func(interface{}) bool) error
+}
+
+// NewDefaultWritePolicy returns a new DefaultWritePolicy instance with no Cache-Control header, custom metadata or driver-specific options.
+func NewDefaultWritePolicy() *DefaultWritePolicy {
+
+	p := &DefaultWritePolicy{
+		Metadata: make(map[string]string),
+	}
+
+	return p
+}
+
+// WriterOptions returns the blob.WriterOptions to use when writing the object described by 'attrs'.
+func (p *DefaultWritePolicy) WriterOptions(ctx context.Context, attrs *WriteAttributes) (*blob.WriterOptions, error) {
+
+	metadata := make(map[string]string)
+
+	for k, v := range p.Metadata {
+		metadata[k] = v
+	}
+
+	if attrs.ID != 0 {
+		metadata["wof-id"] = strconv.FormatInt(attrs.ID, 10)
+	}
+
+	if attrs.Fingerprint != "" {
+		metadata["fingerprint"] = attrs.Fingerprint
+	}
+
+	opts := &blob.WriterOptions{
+		ContentType:  attrs.ContentType,
+		CacheControl: p.CacheControl,
+		BeforeWrite:  p.BeforeWrite,
+	}
+
+	if len(metadata) > 0 {
+		opts.Metadata = metadata
+	}
+
+	return opts, nil
+}
+
+// CopyOptions returns the blob.CopyOptions to use when copying the object described by 'attrs'.
+func (p *DefaultWritePolicy) CopyOptions(ctx context.Context, attrs *WriteAttributes) (*blob.CopyOptions, error) {
+
+	opts := &blob.CopyOptions{
+		BeforeCopy: p.BeforeCopy,
+	}
+
+	return opts, nil
+}
+
+// SniffContentType returns the content type for an object with key 'key' and body 'body'. The content type is sniffed from
+// 'body' and, if that is inconclusive, derived from the filename extension of 'key'.
+func SniffContentType(key string, body []byte) string {
+
+	ext := strings.ToLower(filepath.Ext(key))
+
+	if ext == ".geojson" {
+		return "application/geo+json"
+	}
+
+	content_type := http.DetectContentType(body)
+
+	if content_type != "application/octet-stream" && !strings.HasPrefix(content_type, "text/plain") {
+		return content_type
+	}
+
+	// Image extensions are resolved using the same table that derivative mimetypes are validated against
+
+	by_ext, ok := properties.MimetypeForExtension(ext)
+
+	if ok {
+		return by_ext
+	}
+
+	by_ext = mime.TypeByExtension(ext)
+
+	if by_ext != "" {
+		return by_ext
+	}
+
+	return content_type
+}
@@ -0,0 +1,118 @@
+package common
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/aaronland/go-image-tools/imaging"
+	"github.com/nfnt/resize"
+)
+
+// DEFAULT_GENERATE_SIZES is the default set of derivative sizes produced by process.Generate, expressed as a string that
+// can be parsed by ParseGenerateSizes. These mirror the default go-iiif "iiif-process" configuration.
+const DEFAULT_GENERATE_SIZES string = "o=full,b=1024,z=640,n=320,sq=square:300"
+
+// GenerateSize is a struct describing a derivative size produced by process.Generate or regenerated by rotate.Rotation.
+type GenerateSize struct {
+	// The label for the size, for example "o" or "b". The label filename.ORIGINAL_LABEL is assigned its own secret.
+	Label string
+	// The maximum pixel dimension (width or height) of the derivative. If 0 the derivative is not resized.
+	MaxDimension int
+	// A boolean flag indicating whether the derivative should be cropped to a (centered) square before it is resized.
+	Square bool
+}
+
+// ParseGenerateSizes returns the list of GenerateSize instances for 'str', which is a comma-separated list of
+// "{LABEL}={SPEC}" pairs where {SPEC} is one of:
+// * `full` – The derivative is not resized.
+// * `{N}` – The derivative is resized so that neither its width nor its height exceeds N pixels.
+// * `square` – The derivative is cropped to a square but not resized.
+// * `square:{N}` – The derivative is cropped to a square and resized to N x N pixels.
+func ParseGenerateSizes(str string) ([]*GenerateSize, error) {
+
+	sizes := make([]*GenerateSize, 0)
+	seen := make(map[string]bool)
+
+	for _, pair := range strings.Split(str, ",") {
+
+		pair = strings.TrimSpace(pair)
+
+		if pair == "" {
+			continue
+		}
+
+		label, spec, ok := strings.Cut(pair, "=")
+
+		if !ok || label == "" || spec == "" {
+			return nil, fmt.Errorf("Invalid size '%s'", pair)
+		}
+
+		if seen[label] {
+			return nil, fmt.Errorf("Duplicate size label '%s'", label)
+		}
+
+		seen[label] = true
+
+		sz := &GenerateSize{
+			Label: label,
+		}
+
+		if spec == "square" || strings.HasPrefix(spec, "square:") {
+			sz.Square = true
+			spec = strings.TrimPrefix(strings.TrimPrefix(spec, "square"), ":")
+		}
+
+		if spec != "" && spec != "full" {
+
+			max, err := strconv.Atoi(spec)
+
+			if err != nil || max <= 0 {
+				return nil, fmt.Errorf("Invalid dimension for size '%s'", pair)
+			}
+
+			sz.MaxDimension = max
+		}
+
+		sizes = append(sizes, sz)
+	}
+
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("No sizes defined")
+	}
+
+	return sizes, nil
+}
+
+// ResizeImage returns a new image derived from 'im' for 'sz'.
+func ResizeImage(im image.Image, sz *GenerateSize) image.Image {
+
+	if sz.Square {
+
+		bounds := im.Bounds()
+		side := min(bounds.Dx(), bounds.Dy())
+
+		im = imaging.CropCenter(im, side, side)
+
+		if sz.MaxDimension > 0 && side != sz.MaxDimension {
+			max := uint(sz.MaxDimension)
+			im = resize.Resize(max, max, im, resize.Lanczos3)
+		}
+
+		return im
+	}
+
+	if sz.MaxDimension == 0 {
+		return im
+	}
+
+	bounds := im.Bounds()
+
+	if bounds.Dx() <= sz.MaxDimension && bounds.Dy() <= sz.MaxDimension {
+		return im
+	}
+
+	max := uint(sz.MaxDimension)
+	return resize.Thumbnail(max, max, im, resize.Lanczos3)
+}
@@ -0,0 +1,139 @@
+// package filename provides methods for parsing and formatting the "{id}_{secret}_{label}.{extension}" filenames of
+// processed (derivative) media files, as produced by the go-iiif/go-iiif-uri "idsecret" scheme.
+package filename
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// ORIGINAL_LABEL is the label for the original-size derivative of a media file. Original-size derivatives are assigned
+// a different secret from the other derivatives of a media file.
+const ORIGINAL_LABEL string = "o"
+
+// re_filename matches "{id}_{secret}_{label}.{extension}" filenames. No component may contain underscores, so that
+// filenames are parsed unambiguously; IDs and labels may contain hyphens.
+var re_filename = regexp.MustCompile(`^([A-Za-z0-9\-]+)_([A-Za-z0-9]+)_([A-Za-z0-9\-]+)\.([A-Za-z0-9]+)$`)
+
+var re_id = regexp.MustCompile(`^[A-Za-z0-9\-]+$`)
+var re_secret = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+var re_label = regexp.MustCompile(`^[A-Za-z0-9\-]+$`)
+var re_extension = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// re_temporary matches the ".{suffix}.tmp" and ".{suffix}.bak" suffixes appended to the keys of objects which are
+// staged or backed up while they are being written. The key being written must itself have an extension.
+var re_temporary = regexp.MustCompile(`^(.+\.[A-Za-z0-9]+)\.[A-Za-z0-9]+\.(tmp|bak)$`)
+
+// Filename is a struct containing the components of a "{id}_{secret}_{label}.{extension}" media filename.
+type Filename struct {
+	// The ID of the media file. This is usually a numeric WOF ID but alternate (non-numeric) ID formats, consisting of
+	// alphanumeric characters and hyphens, are supported.
+	ID string
+	// The URI secret of the media file.
+	Secret string
+	// The label of the media file, for example "o" (original) or "b".
+	Label string
+	// The filename extension of the media file, without a leading ".".
+	Extension string
+}
+
+// NewFilename returns a new Filename instance for a numeric WOF ID, returning an error if any of the components are invalid.
+func NewFilename(id int64, secret string, label string, extension string) (*Filename, error) {
+
+	f := &Filename{
+		ID:        strconv.FormatInt(id, 10),
+		Secret:    secret,
+		Label:     label,
+		Extension: extension,
+	}
+
+	err := f.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Parse returns a new Filename instance derived from the final element of 'path_or_name', returning an error if it does
+// not match the "{id}_{secret}_{label}.{extension}" convention.
+func Parse(path_or_name string) (*Filename, error) {
+
+	name := path.Base(path_or_name)
+
+	m := re_filename.FindStringSubmatch(name)
+
+	if len(m) != 5 {
+		return nil, fmt.Errorf("'%s' is not a valid media filename", name)
+	}
+
+	f := &Filename{
+		ID:        m[1],
+		Secret:    m[2],
+		Label:     m[3],
+		Extension: m[4],
+	}
+
+	return f, nil
+}
+
+// TrimTemporarySuffix returns 'path_or_name' with any ".{suffix}.tmp" or ".{suffix}.bak" suffix, appended to objects
+// which are staged or backed up while they are being written, removed and a boolean value indicating whether a suffix
+// was found.
+func TrimTemporarySuffix(path_or_name string) (string, bool) {
+
+	m := re_temporary.FindStringSubmatch(path_or_name)
+
+	if len(m) != 3 {
+		return path_or_name, false
+	}
+
+	return m[1], true
+}
+
+// Validate returns an error if any of the components of 'f' are missing or invalid.
+func (f *Filename) Validate() error {
+
+	if !re_id.MatchString(f.ID) {
+		return fmt.Errorf("Invalid ID '%s'", f.ID)
+	}
+
+	if !re_secret.MatchString(f.Secret) {
+		return fmt.Errorf("Invalid secret '%s'", f.Secret)
+	}
+
+	if !re_label.MatchString(f.Label) {
+		return fmt.Errorf("Invalid label '%s'", f.Label)
+	}
+
+	if !re_extension.MatchString(f.Extension) {
+		return fmt.Errorf("Invalid extension '%s'", f.Extension)
+	}
+
+	return nil
+}
+
+// Int64 returns the ID of 'f' as a numeric WOF ID, returning an error if it is not numeric.
+func (f *Filename) Int64() (int64, error) {
+
+	id, err := strconv.ParseInt(f.ID, 10, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("ID '%s' is not a numeric ID, %w", f.ID, err)
+	}
+
+	return id, nil
+}
+
+// IsOriginal returns a boolean value indicating whether 'f' is the original-size derivative of a media file.
+func (f *Filename) IsOriginal() bool {
+	return f.Label == ORIGINAL_LABEL
+}
+
+// String returns the "{id}_{secret}_{label}.{extension}" filename for 'f'.
+func (f *Filename) String() string {
+	return fmt.Sprintf("%s_%s_%s.%s", f.ID, f.Secret, f.Label, f.Extension)
+}
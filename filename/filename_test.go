@@ -0,0 +1,163 @@
+package filename
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	valid := map[string]*Filename{
+		"1511951011_abc123_o.jpg":                   {ID: "1511951011", Secret: "abc123", Label: "o", Extension: "jpg"},
+		"1511951011_abc123_z.png":                   {ID: "1511951011", Secret: "abc123", Label: "z", Extension: "png"},
+		"151/195/101/1/1511951011_abc123_b.jpg":     {ID: "1511951011", Secret: "abc123", Label: "b", Extension: "jpg"},
+		"1511951011_ABC123_O.JPG":                   {ID: "1511951011", Secret: "ABC123", Label: "O", Extension: "JPG"},
+		"1511951011_abc123_thumb-small.jpg":         {ID: "1511951011", Secret: "abc123", Label: "thumb-small", Extension: "jpg"},
+		"a1b2-c3d4_abc123_o.jpg":                    {ID: "a1b2-c3d4", Secret: "abc123", Label: "o", Extension: "jpg"},
+		"s3://bucket/media/1511951011_abc123_o.gif": {ID: "1511951011", Secret: "abc123", Label: "o", Extension: "gif"},
+	}
+
+	for name, expected := range valid {
+
+		t.Run(name, func(t *testing.T) {
+
+			f, err := Parse(name)
+
+			if err != nil {
+				t.Fatalf("Failed to parse %s, %v", name, err)
+			}
+
+			if *f != *expected {
+				t.Fatalf("Unexpected components for %s, %v", name, f)
+			}
+
+			err = f.Validate()
+
+			if err != nil {
+				t.Fatalf("Parsed filename for %s is not valid, %v", name, err)
+			}
+		})
+	}
+
+	invalid := []string{
+		"",
+		"1511951011.jpg",
+		"1511951011_abc123.jpg",
+		"1511951011_abc123_o",
+		"1511951011_abc123_o.",
+		"1511951011_abc123_o.tar.gz",
+		"1511951011_abc123_o.jpg.tmp",
+		"1511951011_abc123_o.jpg.Xy12ab.tmp",
+		"1511951011_abc123_o.jpg.Xy12ab.bak",
+		"1511951011_abc_123_o.jpg",
+		"1511951011_abc-123_o.jpg",
+		"1511951011__o.jpg",
+		"_abc123_o.jpg",
+		"1511951011_abc123_.jpg",
+		"1511951011_abc123_o.j-g",
+		"1511951011_abc123_o w.jpg",
+	}
+
+	for _, name := range invalid {
+
+		t.Run(name, func(t *testing.T) {
+
+			_, err := Parse(name)
+
+			if err == nil {
+				t.Fatalf("Expected %s to fail parsing", name)
+			}
+		})
+	}
+}
+
+func TestNewFilename(t *testing.T) {
+
+	f, err := NewFilename(1511951011, "abc123", ORIGINAL_LABEL, "jpg")
+
+	if err != nil {
+		t.Fatalf("Failed to create filename, %v", err)
+	}
+
+	if f.String() != "1511951011_abc123_o.jpg" {
+		t.Fatalf("Unexpected filename, %s", f.String())
+	}
+
+	if !f.IsOriginal() {
+		t.Fatalf("Expected filename to be original")
+	}
+
+	id, err := f.Int64()
+
+	if err != nil {
+		t.Fatalf("Failed to derive numeric ID, %v", err)
+	}
+
+	if id != 1511951011 {
+		t.Fatalf("Unexpected ID, %d", id)
+	}
+
+	invalid := map[string][3]string{
+		"empty secret":          {"", "o", "jpg"},
+		"secret with hyphen":    {"abc-123", "o", "jpg"},
+		"empty label":           {"abc123", "", "jpg"},
+		"label with underscore": {"abc123", "o_b", "jpg"},
+		"empty extension":       {"abc123", "o", ""},
+		"extension with dot":    {"abc123", "o", ".jpg"},
+		"multiple extensions":   {"abc123", "o", "tar.gz"},
+	}
+
+	for name, components := range invalid {
+
+		t.Run(name, func(t *testing.T) {
+
+			_, err := NewFilename(1511951011, components[0], components[1], components[2])
+
+			if err == nil {
+				t.Fatalf("Expected %v to be invalid", components)
+			}
+		})
+	}
+
+	f, err = Parse("a1b2-c3d4_abc123_b.jpg")
+
+	if err != nil {
+		t.Fatalf("Failed to parse filename, %v", err)
+	}
+
+	if f.IsOriginal() {
+		t.Fatalf("Did not expect filename to be original")
+	}
+
+	_, err = f.Int64()
+
+	if err == nil {
+		t.Fatalf("Expected non-numeric ID to fail conversion")
+	}
+}
+
+func TestTrimTemporarySuffix(t *testing.T) {
+
+	tests := map[string]struct {
+		Name      string
+		Temporary bool
+	}{
+		"1511951011_abc123_o.jpg":                     {"1511951011_abc123_o.jpg", false},
+		"1511951011_abc123_o.jpg.Xy12ab.tmp":          {"1511951011_abc123_o.jpg", true},
+		"1511951011_abc123_o.jpg.Xy12ab.bak":          {"1511951011_abc123_o.jpg", true},
+		"151/195/101/1/1511951011.geojson.Xy12ab.bak": {"151/195/101/1/1511951011.geojson", true},
+		"1511951011_abc123_o.jpg.tmp":                 {"1511951011_abc123_o.jpg.tmp", false},
+		"1511951011_abc123_o.jpg.Xy-12.tmp":           {"1511951011_abc123_o.jpg.Xy-12.tmp", false},
+	}
+
+	for input, expected := range tests {
+
+		t.Run(input, func(t *testing.T) {
+
+			name, temporary := TrimTemporarySuffix(input)
+
+			if name != expected.Name || temporary != expected.Temporary {
+				t.Fatalf("Unexpected result for %s, %s (%t)", input, name, temporary)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// package iiif provides methods for deriving IIIF Presentation 3.0 manifests and collections from Who's On First style
+// media feature records.
+package iiif
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sfomuseum/go-whosonfirst-media/filename"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+// PRESENTATION_CONTEXT is the JSON-LD context for IIIF Presentation 3.0 documents.
+const PRESENTATION_CONTEXT string = "http://iiif.io/api/presentation/3/context.json"
+
+// DEFAULT_MANIFEST_KEY_TEMPLATE is the default template for the keys (relative paths) of media manifests.
+const DEFAULT_MANIFEST_KEY_TEMPLATE string = "{id_path}/{id}-manifest.json"
+
+// DEFAULT_COLLECTION_KEY_TEMPLATE is the default template for the keys (relative paths) of depicted feature collections.
+const DEFAULT_COLLECTION_KEY_TEMPLATE string = "{id_path}/{id}-collection.json"
+
+// LanguageMap is a IIIF language map, keyed by language code ("none" if unknown).
+type LanguageMap map[string][]string
+
+// MetadataEntry is a IIIF label and value pair.
+type MetadataEntry struct {
+	Label LanguageMap `json:"label"`
+	Value LanguageMap `json:"value"`
+}
+
+// Resource is a IIIF content resource, for example an image.
+type Resource struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Format string `json:"format,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// Annotation is a IIIF annotation associating a Resource with a Canvas.
+type Annotation struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Motivation string    `json:"motivation"`
+	Body       *Resource `json:"body"`
+	Target     string    `json:"target"`
+}
+
+// AnnotationPage is a IIIF list of annotations.
+type AnnotationPage struct {
+	ID    string        `json:"id"`
+	Type  string        `json:"type"`
+	Items []*Annotation `json:"items"`
+}
+
+// Canvas is a IIIF canvas.
+type Canvas struct {
+	ID     string            `json:"id"`
+	Type   string            `json:"type"`
+	Label  LanguageMap       `json:"label,omitempty"`
+	Width  int               `json:"width"`
+	Height int               `json:"height"`
+	Items  []*AnnotationPage `json:"items"`
+}
+
+// Manifest is a IIIF Presentation 3.0 manifest.
+type Manifest struct {
+	Context   string           `json:"@context,omitempty"`
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	Label     LanguageMap      `json:"label"`
+	Metadata  []*MetadataEntry `json:"metadata,omitempty"`
+	Thumbnail []*Resource      `json:"thumbnail,omitempty"`
+	Items     []*Canvas        `json:"items"`
+}
+
+// CollectionItem is a reference to a Manifest in a Collection.
+type CollectionItem struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Label     LanguageMap `json:"label"`
+	Thumbnail []*Resource `json:"thumbnail,omitempty"`
+}
+
+// Collection is a IIIF Presentation 3.0 collection.
+type Collection struct {
+	Context string            `json:"@context,omitempty"`
+	ID      string            `json:"id"`
+	Type    string            `json:"type"`
+	Label   LanguageMap       `json:"label"`
+	Items   []*CollectionItem `json:"items"`
+}
+
+// URITemplate is a struct for deriving URIs, and keys, from templates containing "{placeholder}" strings. Valid placeholders are:
+// * {id} – The WOF ID of the media (or depicted) feature.
+// * {id_path} – The nested WOF path for the WOF ID (for example "101/736/545") as derived by whosonfirst/go-whosonfirst-uri.Id2Path.
+// * {secret} – The secret of a derivative.
+// * {label} – The size label of a derivative, for example "o" or "b".
+// * {extension} – The filename extension of a derivative, without a leading ".".
+// * {filename} – The "{id}_{secret}_{label}.{extension}" filename of a derivative.
+type URITemplate struct {
+	template string
+}
+
+// URIValues is a struct containing the values used to replace placeholders in a URITemplate.
+type URIValues struct {
+	// The WOF ID of the media (or depicted) feature.
+	ID int64
+	// The secret of a derivative.
+	Secret string
+	// The size label of a derivative.
+	Label string
+	// The filename extension of a derivative.
+	Extension string
+}
+
+// NewURITemplate returns a new URITemplate instance for 't', returning an error if 't' is empty, contains unbalanced
+// braces or unknown placeholders.
+func NewURITemplate(t string) (*URITemplate, error) {
+
+	if t == "" {
+		return nil, fmt.Errorf("URI template is empty")
+	}
+
+	remaining := t
+
+	for {
+
+		start := strings.Index(remaining, "{")
+		end := strings.Index(remaining, "}")
+
+		if start == -1 && end == -1 {
+			break
+		}
+
+		if start == -1 || end == -1 || end < start {
+			return nil, fmt.Errorf("URI template '%s' has unbalanced braces", t)
+		}
+
+		name := remaining[start+1 : end]
+
+		switch name {
+		case "id", "id_path", "secret", "label", "extension", "filename":
+			// pass
+		default:
+			return nil, fmt.Errorf("URI template '%s' has unknown placeholder '{%s}'", t, name)
+		}
+
+		remaining = remaining[end+1:]
+	}
+
+	u := &URITemplate{
+		template: t,
+	}
+
+	return u, nil
+}
+
+// Render returns the URI for 'v'.
+func (u *URITemplate) Render(v *URIValues) (string, error) {
+
+	id_path, err := uri.Id2Path(v.ID)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to derive path for %d, %w", v.ID, err)
+	}
+
+	fname := ""
+
+	if strings.Contains(u.template, "{filename}") {
+
+		f, err := filename.NewFilename(v.ID, v.Secret, v.Label, v.Extension)
+
+		if err != nil {
+			return "", fmt.Errorf("Invalid filename, %w", err)
+		}
+
+		fname = f.String()
+	}
+
+	r := strings.NewReplacer(
+		"{id}", strconv.FormatInt(v.ID, 10),
+		"{id_path}", id_path,
+		"{secret}", v.Secret,
+		"{label}", v.Label,
+		"{extension}", v.Extension,
+		"{filename}", fname,
+	)
+
+	return r.Replace(u.template), nil
+}
+
+// String returns the template string for 'u'.
+func (u *URITemplate) String() string {
+	return u.template
+}
+
+// noneLanguageMap returns a LanguageMap for 'values' using the "none" language code.
+func noneLanguageMap(values ...string) LanguageMap {
+	return LanguageMap{"none": values}
+}
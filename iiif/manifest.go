@@ -0,0 +1,585 @@
+package iiif
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sfomuseum/go-whosonfirst-media/filename"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"github.com/sfomuseum/go-whosonfirst-media/status"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-reader/v2"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"gocloud.dev/blob"
+)
+
+// CONTENT_TYPE is the content type assigned to manifests and collections written by WriteManifests.
+const CONTENT_TYPE string = `application/ld+json;profile="http://iiif.io/api/presentation/3/context.json"`
+
+// DEFAULT_THUMBNAIL_LABELS are the default size labels, in order of preference, used for manifest thumbnails.
+var DEFAULT_THUMBNAIL_LABELS = []string{"n", "sq", "z"}
+
+// ManifestOptions is a struct containing configuration details for deriving manifests and collections.
+type ManifestOptions struct {
+	// The URITemplate used to derive the URLs of derivative images.
+	ImageURITemplate *URITemplate
+	// The URITemplate used to derive the keys of media manifests. If nil then DEFAULT_MANIFEST_KEY_TEMPLATE is used.
+	ManifestKeyTemplate *URITemplate
+	// The URITemplate used to derive the keys of depicted feature collections. If nil then DEFAULT_COLLECTION_KEY_TEMPLATE is used.
+	CollectionKeyTemplate *URITemplate
+	// The base URL where manifests and collections are published. Manifest and collection IDs are derived by appending
+	// their keys to BaseURL.
+	BaseURL string
+	// The size label of the derivative painted on each canvas. If empty, or if a media feature does not have that
+	// derivative, the original (filename.ORIGINAL_LABEL) derivative or else the largest derivative is used.
+	ImageLabel string
+	// The size labels, in order of preference, used for thumbnails. If empty then DEFAULT_THUMBNAIL_LABELS is used.
+	ThumbnailLabels []string
+	// An optional whosonfirst/go-reader Reader used to read depicted features in order to label collections with their
+	// wof:name property. If nil collections are labeled with the depicted feature's WOF ID.
+	DepictsReader reader.Reader
+}
+
+// NewManifestOptions returns a new ManifestOptions instance for the image URI template 'image_template' and 'base_url',
+// using the default key templates and labels. 'base_url' must be an absolute http or https URL since it is used to
+// derive the IDs of manifests and collections.
+func NewManifestOptions(image_template string, base_url string) (*ManifestOptions, error) {
+
+	if base_url == "" {
+		return nil, fmt.Errorf("Missing base URL")
+	}
+
+	u, err := url.Parse(base_url)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid base URL, %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid base URL '%s', scheme must be http or https", base_url)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("Invalid base URL '%s', missing host", base_url)
+	}
+
+	image_t, err := NewURITemplate(image_template)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid image URI template, %w", err)
+	}
+
+	manifest_t, err := NewURITemplate(DEFAULT_MANIFEST_KEY_TEMPLATE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	collection_t, err := NewURITemplate(DEFAULT_COLLECTION_KEY_TEMPLATE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &ManifestOptions{
+		ImageURITemplate:      image_t,
+		ManifestKeyTemplate:   manifest_t,
+		CollectionKeyTemplate: collection_t,
+		BaseURL:               base_url,
+		ImageLabel:            filename.ORIGINAL_LABEL,
+		ThumbnailLabels:       DEFAULT_THUMBNAIL_LABELS,
+	}
+
+	return opts, nil
+}
+
+// NewManifest returns a new Manifest for the media feature 'body', and the key where it should be written.
+func NewManifest(body []byte, opts *ManifestOptions) (*Manifest, string, error) {
+
+	if opts.ImageURITemplate == nil {
+		return nil, "", fmt.Errorf("Missing image URI template")
+	}
+
+	id_rsp := gjson.GetBytes(body, "properties.wof:id")
+
+	if !id_rsp.Exists() {
+		return nil, "", fmt.Errorf("Missing properties.wof:id")
+	}
+
+	id := id_rsp.Int()
+
+	mp, err := properties.Unmarshal(body)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to derive media properties, %w", err)
+	}
+
+	if len(mp.Details.Sizes) == 0 {
+		return nil, "", fmt.Errorf("Feature has no derivatives")
+	}
+
+	key, err := renderKey(opts.ManifestKeyTemplate, DEFAULT_MANIFEST_KEY_TEMPLATE, id)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	manifest_id := joinURL(opts.BaseURL, key)
+
+	image_label := imageLabel(mp.Details.Sizes, opts.ImageLabel)
+
+	image, err := newImageResource(id, image_label, mp.Details.Sizes[image_label], opts.ImageURITemplate)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	canvas_id := manifest_id + "/canvas/1"
+
+	annotation := &Annotation{
+		ID:         canvas_id + "/annotation/1",
+		Type:       "Annotation",
+		Motivation: "painting",
+		Body:       image,
+		Target:     canvas_id,
+	}
+
+	page := &AnnotationPage{
+		ID:    canvas_id + "/page/1",
+		Type:  "AnnotationPage",
+		Items: []*Annotation{annotation},
+	}
+
+	canvas := &Canvas{
+		ID:     canvas_id,
+		Type:   "Canvas",
+		Width:  image.Width,
+		Height: image.Height,
+		Items:  []*AnnotationPage{page},
+	}
+
+	m := &Manifest{
+		Context:  PRESENTATION_CONTEXT,
+		ID:       manifest_id,
+		Type:     "Manifest",
+		Label:    noneLanguageMap(featureName(body, id)),
+		Metadata: mediaMetadata(id, mp),
+		Items:    []*Canvas{canvas},
+	}
+
+	thumbnail, err := thumbnailResource(id, mp.Details.Sizes, opts)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if thumbnail != nil {
+		m.Thumbnail = []*Resource{thumbnail}
+	}
+
+	return m, key, nil
+}
+
+// NewCollection returns a new Collection for the feature 'depicts_id' containing 'manifests', and the key where it should
+// be written.
+func NewCollection(ctx context.Context, depicts_id int64, manifests []*Manifest, opts *ManifestOptions) (*Collection, string, error) {
+
+	key, err := renderKey(opts.CollectionKeyTemplate, DEFAULT_COLLECTION_KEY_TEMPLATE, depicts_id)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	label := strconv.FormatInt(depicts_id, 10)
+
+	if opts.DepictsReader != nil {
+
+		name, err := depictedName(ctx, opts.DepictsReader, depicts_id)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		label = name
+	}
+
+	items := make([]*CollectionItem, len(manifests))
+
+	for idx, m := range manifests {
+
+		items[idx] = &CollectionItem{
+			ID:        m.ID,
+			Type:      "Manifest",
+			Label:     m.Label,
+			Thumbnail: m.Thumbnail,
+		}
+	}
+
+	c := &Collection{
+		Context: PRESENTATION_CONTEXT,
+		ID:      joinURL(opts.BaseURL, key),
+		Type:    "Collection",
+		Label:   noneLanguageMap(label),
+		Items:   items,
+	}
+
+	return c, key, nil
+}
+
+// WriteManifests will write a Manifest for each of the media features yielded by 'features' to 'bucket', followed by a
+// Collection for each of the features they depict. Manifests in a collection are ordered by ID. Features that are not
+// PUBLISHED (for example because they are hidden, deprecated or have not been processed yet) or that do not have any
+// derivatives are skipped.
+func WriteManifests(ctx context.Context, bucket *blob.Bucket, features iter.Seq2[[]byte, error], opts *ManifestOptions) error {
+
+	depicts := make(map[int64][]*Manifest)
+
+	for body, err := range features {
+
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+			// pass
+		}
+
+		current, err := status.Current(body)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive status for %d, %w", gjson.GetBytes(body, "properties.wof:id").Int(), err)
+		}
+
+		if current != status.PUBLISHED {
+			slog.Debug("Feature is not published, skipping", "id", gjson.GetBytes(body, "properties.wof:id").Int(), "status", current.String())
+			continue
+		}
+
+		// Media features that have not been processed yet do not have any derivatives
+
+		if !gjson.GetBytes(body, "properties.media:properties.sizes").Exists() {
+			slog.Debug("Feature has no derivatives, skipping", "id", gjson.GetBytes(body, "properties.wof:id").Int())
+			continue
+		}
+
+		m, key, err := NewManifest(body, opts)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive manifest for %d, %w", gjson.GetBytes(body, "properties.wof:id").Int(), err)
+		}
+
+		err = writeJSON(ctx, bucket, key, m)
+
+		if err != nil {
+			return err
+		}
+
+		for _, r := range gjson.GetBytes(body, "properties.wof:depicts").Array() {
+
+			depicts_id := r.Int()
+
+			if depicts_id <= 0 {
+				continue
+			}
+
+			depicts[depicts_id] = append(depicts[depicts_id], m)
+		}
+	}
+
+	for depicts_id, manifests := range depicts {
+
+		sort.Slice(manifests, func(i, j int) bool {
+			return manifests[i].ID < manifests[j].ID
+		})
+
+		c, key, err := NewCollection(ctx, depicts_id, manifests, opts)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive collection for %d, %w", depicts_id, err)
+		}
+
+		err = writeJSON(ctx, bucket, key, c)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BucketFeatures returns an iterator of the (non-alternate) GeoJSON features stored in 'bucket'.
+func BucketFeatures(ctx context.Context, bucket *blob.Bucket) iter.Seq2[[]byte, error] {
+
+	return func(yield func([]byte, error) bool) {
+
+		list := bucket.List(nil)
+
+		for {
+
+			obj, err := list.Next(ctx)
+
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil {
+				yield(nil, fmt.Errorf("Failed to list features, %w", err))
+				return
+			}
+
+			if obj.IsDir || !strings.HasSuffix(obj.Key, ".geojson") {
+				continue
+			}
+
+			_, uri_args, err := uri.ParseURI(obj.Key)
+
+			if err != nil || uri_args.IsAlternate {
+				continue
+			}
+
+			body, err := bucket.ReadAll(ctx, obj.Key)
+
+			if err != nil {
+				err = fmt.Errorf("Failed to read %s, %w", obj.Key, err)
+			}
+
+			if !yield(body, err) {
+				return
+			}
+		}
+	}
+}
+
+// newImageResource returns a new image Resource for the 'label' derivative 'sz' of the media feature 'id'.
+func newImageResource(id int64, label string, sz properties.Size, t *URITemplate) (*Resource, error) {
+
+	v := &URIValues{
+		ID:        id,
+		Secret:    sz.Secret,
+		Label:     label,
+		Extension: sz.Extension,
+	}
+
+	image_uri, err := t.Render(v)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive URI for %s derivative, %w", label, err)
+	}
+
+	r := &Resource{
+		ID:     image_uri,
+		Type:   "Image",
+		Format: sz.Mimetype,
+		Width:  sz.Width,
+		Height: sz.Height,
+	}
+
+	return r, nil
+}
+
+// thumbnailResource returns the image Resource for the first of opts.ThumbnailLabels in 'sizes', or nil if there are none.
+func thumbnailResource(id int64, sizes map[string]properties.Size, opts *ManifestOptions) (*Resource, error) {
+
+	labels := opts.ThumbnailLabels
+
+	if len(labels) == 0 {
+		labels = DEFAULT_THUMBNAIL_LABELS
+	}
+
+	for _, label := range labels {
+
+		sz, ok := sizes[label]
+
+		if ok {
+			return newImageResource(id, label, sz, opts.ImageURITemplate)
+		}
+	}
+
+	return nil, nil
+}
+
+// imageLabel returns 'preferred' if it is in 'sizes', otherwise the original label if it is in 'sizes', otherwise the
+// label of the largest derivative.
+func imageLabel(sizes map[string]properties.Size, preferred string) string {
+
+	for _, label := range []string{preferred, filename.ORIGINAL_LABEL} {
+
+		_, ok := sizes[label]
+
+		if label != "" && ok {
+			return label
+		}
+	}
+
+	largest := ""
+	largest_px := -1
+
+	for label, sz := range sizes {
+
+		px := sz.Width * sz.Height
+
+		if px > largest_px || (px == largest_px && label < largest) {
+			largest = label
+			largest_px = px
+		}
+	}
+
+	return largest
+}
+
+// mediaMetadata returns the IIIF metadata for the media feature 'id' derived from 'mp'.
+func mediaMetadata(id int64, mp *properties.MediaProperties) []*MetadataEntry {
+
+	metadata := make([]*MetadataEntry, 0)
+
+	add := func(label string, value string) {
+
+		if value == "" {
+			return
+		}
+
+		e := &MetadataEntry{
+			Label: noneLanguageMap(label),
+			Value: noneLanguageMap(value),
+		}
+
+		metadata = append(metadata, e)
+	}
+
+	add("WOF ID", strconv.FormatInt(id, 10))
+	add("Medium", mp.Medium)
+	add("Mimetype", mp.Mimetype)
+	add("Source", mp.Source)
+
+	if mp.Created != 0 {
+		add("Created", time.Unix(mp.Created, 0).UTC().Format(time.RFC3339))
+	}
+
+	add("Fingerprint", mp.Fingerprint)
+
+	if len(mp.Details.Colours) > 0 {
+
+		names := make([]string, len(mp.Details.Colours))
+
+		for idx, c := range mp.Details.Colours {
+			names[idx] = c.Name
+		}
+
+		add("Colours", strings.Join(names, ", "))
+	}
+
+	return metadata
+}
+
+// featureName returns the wof:name property of 'body', or 'id' if it is not present.
+func featureName(body []byte, id int64) string {
+
+	name := gjson.GetBytes(body, "properties.wof:name").String()
+
+	if name == "" {
+		name = strconv.FormatInt(id, 10)
+	}
+
+	return name
+}
+
+// depictedName returns the wof:name property of the feature 'id' read from 'r'.
+func depictedName(ctx context.Context, r reader.Reader, id int64) (string, error) {
+
+	rel_path, err := uri.Id2RelPath(id)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to derive rel path for %d, %w", id, err)
+	}
+
+	fh, err := r.Read(ctx, rel_path)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to read %s, %w", rel_path, err)
+	}
+
+	defer fh.Close()
+
+	body, err := io.ReadAll(fh)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to read body for %s, %w", rel_path, err)
+	}
+
+	return featureName(body, id), nil
+}
+
+// renderKey returns the key for 'id' derived from 't', or 'default_template' if 't' is nil.
+func renderKey(t *URITemplate, default_template string, id int64) (string, error) {
+
+	if t == nil {
+
+		default_t, err := NewURITemplate(default_template)
+
+		if err != nil {
+			return "", err
+		}
+
+		t = default_t
+	}
+
+	key, err := t.Render(&URIValues{ID: id})
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to derive key for %d, %w", id, err)
+	}
+
+	return key, nil
+}
+
+// joinURL returns 'key' appended to 'base_url'.
+func joinURL(base_url string, key string) string {
+
+	if base_url == "" {
+		return key
+	}
+
+	return strings.TrimRight(base_url, "/") + "/" + strings.TrimLeft(key, "/")
+}
+
+// writeJSON writes the JSON encoding of 'v' to 'key' in 'bucket'.
+func writeJSON(ctx context.Context, bucket *blob.Bucket, key string, v interface{}) error {
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+
+	err := enc.Encode(v)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal %s, %w", key, err)
+	}
+
+	wr_opts := &blob.WriterOptions{
+		ContentType: CONTENT_TYPE,
+	}
+
+	err = bucket.WriteAll(ctx, key, buf.Bytes(), wr_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write %s, %w", key, err)
+	}
+
+	return nil
+}
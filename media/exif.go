@@ -0,0 +1,122 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/mknote"
+	"gocloud.dev/blob"
+)
+
+// exifProperties is a struct containing the subset of EXIF data that is used to populate media feature properties.
+type exifProperties struct {
+	// The Unix timestamp derived from the EXIF DateTimeOriginal tag, if present.
+	Created int64
+	// The latitude derived from the EXIF GPS tags, if present.
+	Latitude float64
+	// The longitude derived from the EXIF GPS tags, if present.
+	Longitude float64
+}
+
+// HasCreated returns true if a creation date was derived from EXIF data.
+func (p *exifProperties) HasCreated() bool {
+	return p.Created != 0
+}
+
+// HasCoordinates returns true if a non-zero coordinate pair was derived from EXIF data.
+func (p *exifProperties) HasCoordinates() bool {
+	return p.Latitude != 0.0 && p.Longitude != 0.0
+}
+
+// deriveEXIFProperties will return an exifProperties instance for the image at 'path' in 'bucket'. If 'path' is not a JPEG
+// file or does not contain EXIF data it will return nil.
+func deriveEXIFProperties(ctx context.Context, bucket *blob.Bucket, path string) (*exifProperties, error) {
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		// pass
+	default:
+		return nil, nil
+	}
+
+	if bucket == nil {
+		return nil, fmt.Errorf("Missing source bucket")
+	}
+
+	logger := slog.Default()
+	logger = logger.With("path", path)
+
+	im_fname := filepath.Base(path)
+	im_r, err := bucket.NewReader(ctx, im_fname, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create reader for %s, %w", im_fname, err)
+	}
+
+	defer im_r.Close()
+
+	exif.RegisterParsers(mknote.All...)
+	exif_data, err := exif.Decode(im_r)
+
+	if err != nil {
+		logger.Debug("Failed to decode EXIF data from image", "error", err)
+		return nil, nil
+	}
+
+	props := new(exifProperties)
+
+	/*
+		> exiv2 -pa _Case_Automotive_Toys_and_Plasitic_Models.jpg | grep DateTime
+		Exif.Image.DateTime                          Ascii      20  2018:12:26 09:30:09
+		Exif.Photo.DateTimeOriginal                  Ascii      20  2018:12:20 12:22:42
+		Exif.Photo.DateTimeDigitized                 Ascii      20  2018:12:20 12:22:42
+
+	*/
+
+	tag, err := exif_data.Get("DateTimeOriginal")
+
+	if err == nil {
+
+		str_dt := tag.String()
+
+		str_dt = strings.Trim(str_dt, "\"")    // see this? it's important
+		str_dt = fmt.Sprintf("%s PST", str_dt) // see this? we might regret it one day...
+
+		// remember these datetime formats are Go's internal cray-cray
+		// for working with time... (20190201/thisisaaronland)
+
+		exif_fmt := "2006:01:02 15:04:05 MST"
+		// iso_fmt := "2006-01-02T15:04:05-0700"
+
+		t, err := time.Parse(exif_fmt, str_dt)
+
+		if err == nil {
+
+			ldn, _ := time.LoadLocation("Europe/London")
+			t = t.In(ldn)
+
+			props.Created = t.Unix()
+		}
+
+	} else {
+		logger.Debug("Failed to wrangle dates for 'DateTimeOriginal' tag", "error", err)
+	}
+
+	// geo stuff
+
+	lat, lon, err := exif_data.LatLong()
+
+	if err == nil {
+		props.Latitude = lat
+		props.Longitude = lon
+	} else {
+		logger.Debug("Failed to derive coordinates from EXIF data", "error", err)
+	}
+
+	return props, nil
+}
@@ -4,18 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
-	"path/filepath"
-	"strings"
 	"sync"
-	"time"
 
-	"github.com/rwcarlsen/goexif/exif"
-	"github.com/rwcarlsen/goexif/mknote"
 	"github.com/sfomuseum/go-whosonfirst-media/operations/gather"
+	media_properties "github.com/sfomuseum/go-whosonfirst-media/properties"
+	"github.com/sfomuseum/go-whosonfirst-media/status"
+	"github.com/whosonfirst/go-reader/v2"
 	"github.com/whosonfirst/go-whosonfirst-feature/properties"
 	"github.com/whosonfirst/go-whosonfirst-id"
 	"github.com/whosonfirst/go-whosonfirst-placetypes"
+	"github.com/whosonfirst/go-whosonfirst-uri"
 	"gocloud.dev/blob"
 )
 
@@ -53,6 +53,14 @@ type NewMediaFeatureOptions struct {
 	DepictsPlacetype string
 	// Custom properties to assign to the new Feature
 	CustomProperties map[string]interface{}
+	// An optional MediaLookup instance used to determine whether a media record already exists for the image being processed.
+	// If a match is found a new ID will not be minted and either the existing record (if ExistingReader is defined) or a
+	// DuplicateMediaError will be returned.
+	Lookup MediaLookup
+	// A boolean flag indicating whether Lookup should also be used to look for near-duplicate images using image hashes.
+	LookupImageHashes bool
+	// An optional whosonfirst/go-reader.Reader instance used to read existing media records matched by Lookup.
+	ExistingReader reader.Reader
 }
 
 // Create a new geojson.Feature instance with media:properties associated with a Feature instance it depicts.
@@ -74,20 +82,23 @@ func NewMediaFeatureWithProvider(ctx context.Context, pr id.Provider, rsp *gathe
 		return nil, fmt.Errorf("Options missing Repo (wof:repo) property.")
 	}
 
-	centroid, _, err := properties.Centroid(depicts)
+	if opts.Lookup != nil {
 
-	if err != nil {
-		return nil, fmt.Errorf("Failed to derive centroid for feature being depicted, %w", err)
-	}
+		existing, err := lookupExistingMediaFeature(ctx, rsp, opts)
 
-	coords := []float64{
-		centroid.X(),
-		centroid.Y(),
+		if err != nil {
+			return nil, err
+		}
+
+		if existing != nil {
+			return existing, nil
+		}
 	}
 
-	geom := Geometry{
-		Type:        "Point",
-		Coordinates: coords,
+	geom, err := approximateGeometry(depicts)
+
+	if err != nil {
+		return nil, err
 	}
 
 	depicts_id, err := properties.Id(depicts)
@@ -198,10 +209,14 @@ func NewMediaFeatureWithProvider(ctx context.Context, pr id.Provider, rsp *gathe
 	props["iso:country"] = country
 	props["src:geom"] = source_geom
 
-	props["media:source"] = "unknown"
-	props["media:medium"] = "image"
+	props["media:source"] = media_properties.DEFAULT_SOURCE
+	props["media:medium"] = media_properties.DEFAULT_MEDIUM
 	props["media:mimetype"] = rsp.MimeType
 	props["media:fingerprint"] = rsp.Fingerprint
+	props["media:status_id"] = int(status.GATHERED)
+	props["media:status_history"] = []*status.HistoryEntry{
+		status.NewHistoryEntry(status.GATHERED),
+	}
 
 	for _, h := range rsp.ImageHashes {
 		k := fmt.Sprintf("media:imagehash_%s", h.Approach)
@@ -212,6 +227,12 @@ func NewMediaFeatureWithProvider(ctx context.Context, pr id.Provider, rsp *gathe
 		props["media:imagetext"] = string(rsp.ImageText)
 	}
 
+	if len(rsp.Palette) > 0 {
+		props["media:properties"] = &media_properties.Details{
+			Colours: rsp.Palette,
+		}
+	}
+
 	props["mz:is_approximate"] = 1
 
 	if opts.CustomProperties != nil {
@@ -219,97 +240,133 @@ func NewMediaFeatureWithProvider(ctx context.Context, pr id.Provider, rsp *gathe
 			props[k] = v
 		}
 	}
-	var exif_data *exif.Exif
 
-	switch filepath.Ext(rsp.Path) {
+	exif_props, err := deriveEXIFProperties(ctx, opts.SourceBucket, rsp.Path)
 
-	case ".jpg", ".jpeg":
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive EXIF properties, %w", err)
+	}
 
-		im_fname := filepath.Base(rsp.Path)
-		im_r, err := opts.SourceBucket.NewReader(ctx, im_fname, nil)
+	if exif_props != nil {
 
-		if err != nil {
-			return nil, err
+		if exif_props.HasCreated() {
+			props["media:created"] = exif_props.Created
 		}
 
-		exif.RegisterParsers(mknote.All...)
-		im_exif, err := exif.Decode(im_r)
+		if exif_props.HasCoordinates() {
+
+			geom.Coordinates[0] = exif_props.Longitude
+			geom.Coordinates[1] = exif_props.Latitude
 
-		if err == nil {
-			logger.Debug("Failed to decode EXIF data from image", "error", err)
-			exif_data = im_exif
+			props["mz:is_approximate"] = 0
 		}
+	}
+
+	f := &Feature{
+		Type:       "Feature",
+		Geometry:   geom,
+		Properties: props,
+	}
 
-		im_r.Close()
+	enc_f, err := json.Marshal(f)
 
-	default:
-		// pass
+	if err != nil {
+		return nil, err
 	}
 
-	if exif_data != nil {
+	err = media_properties.ValidateFeature(enc_f)
 
-		/*
-			> exiv2 -pa _Case_Automotive_Toys_and_Plasitic_Models.jpg | grep DateTime
-			Exif.Image.DateTime                          Ascii      20  2018:12:26 09:30:09
-			Exif.Photo.DateTimeOriginal                  Ascii      20  2018:12:20 12:22:42
-			Exif.Photo.DateTimeDigitized                 Ascii      20  2018:12:20 12:22:42
+	if err != nil {
+		return nil, fmt.Errorf("New feature has invalid media properties, %w", err)
+	}
 
-		*/
+	logger.Debug("Return new depiction feature")
+	return enc_f, nil
+}
 
-		tag, err := exif_data.Get("DateTimeOriginal")
+// lookupExistingMediaFeature will use opts.Lookup to determine whether a media record already exists for 'rsp'. If a match is
+// found and opts.ExistingReader is defined the existing record is returned. If a match is found and there is no reader a
+// DuplicateMediaError is returned. If there is no match then both return values will be nil.
+func lookupExistingMediaFeature(ctx context.Context, rsp *gather.GatherImagesResponse, opts *NewMediaFeatureOptions) ([]byte, error) {
 
-		if err == nil {
+	match := "fingerprint"
 
-			str_dt := tag.String()
+	existing_id, err := opts.Lookup.LookupFingerprint(ctx, rsp.Fingerprint)
 
-			str_dt = strings.Trim(str_dt, "\"")    // see this? it's important
-			str_dt = fmt.Sprintf("%s PST", str_dt) // see this? we might regret it one day...
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lookup fingerprint '%s', %w", rsp.Fingerprint, err)
+	}
 
-			// remember these datetime formats are Go's internal cray-cray
-			// for working with time... (20190201/thisisaaronland)
+	if existing_id == 0 && opts.LookupImageHashes {
 
-			exif_fmt := "2006:01:02 15:04:05 MST"
-			// iso_fmt := "2006-01-02T15:04:05-0700"
+		match = "imagehash"
 
-			t, err := time.Parse(exif_fmt, str_dt)
+		existing_id, err = opts.Lookup.LookupImageHashes(ctx, rsp.ImageHashes)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to lookup image hashes for '%s', %w", rsp.Path, err)
+		}
+	}
 
-			if err == nil {
+	if existing_id == 0 {
+		return nil, nil
+	}
 
-				ldn, _ := time.LoadLocation("Europe/London")
-				t = t.In(ldn)
+	slog.Debug("Image resolves to existing media record", "path", rsp.Path, "id", existing_id, "match", match)
 
-				props["media:created"] = t.Unix()
-			}
+	if opts.ExistingReader == nil {
 
-		} else {
-			logger.Debug("Failed to wrangle dates for 'DateTimeOriginal' tag", "error", err)
+		dupe_err := &DuplicateMediaError{
+			ID:          existing_id,
+			Fingerprint: rsp.Fingerprint,
+			Match:       match,
 		}
 
-		// geo stuff
+		return nil, dupe_err
+	}
 
-		lat, lon, err := exif_data.LatLong()
+	rel_path, err := uri.Id2RelPath(existing_id)
 
-		if err != nil && lat != 0.0 && lon != 0.0 {
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive relative path for existing media record %d, %w", existing_id, err)
+	}
 
-			geom.Coordinates[0] = lon
-			geom.Coordinates[1] = lat
+	r, err := opts.ExistingReader.Read(ctx, rel_path)
 
-			props["mz:is_approximate"] = 0
-		}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read existing media record %s, %w", rel_path, err)
 	}
 
-	f := &Feature{
-		Type:       "Feature",
-		Geometry:   geom,
-		Properties: props,
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read body for existing media record %s, %w", rel_path, err)
 	}
 
-	enc_f, err := json.Marshal(f)
+	return body, nil
+}
+
+// approximateGeometry returns the (approximate) Point geometry for a media feature derived from the centroid of the feature
+// it depicts.
+func approximateGeometry(depicts []byte) (Geometry, error) {
+
+	centroid, _, err := properties.Centroid(depicts)
 
 	if err != nil {
-		return nil, err
+		return Geometry{}, fmt.Errorf("Failed to derive centroid for feature being depicted, %w", err)
 	}
 
-	logger.Debug("Return new depiction feature")
-	return enc_f, nil
+	coords := []float64{
+		centroid.X(),
+		centroid.Y(),
+	}
+
+	geom := Geometry{
+		Type:        "Point",
+		Coordinates: coords,
+	}
+
+	return geom, nil
 }
@@ -0,0 +1,173 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/tidwall/gjson"
+)
+
+// MediaLookup is an interface for resolving images to existing media records. It is used to prevent the creation of
+// multiple media records for the same image.
+type MediaLookup interface {
+	// LookupFingerprint returns the ID of an existing media record whose media:fingerprint property matches 'fingerprint'
+	// or 0 if there is no match.
+	LookupFingerprint(context.Context, string) (int64, error)
+	// LookupImageHashes returns the ID of an existing media record whose media:imagehash_* properties are near-duplicates
+	// of 'hashes' or 0 if there is no match.
+	LookupImageHashes(context.Context, []*common.ImageHashRsp) (int64, error)
+}
+
+// DuplicateMediaError is an error returned when an image resolves to an existing media record.
+type DuplicateMediaError struct {
+	// The ID of the existing media record.
+	ID int64
+	// The fingerprint of the image being resolved.
+	Fingerprint string
+	// The criteria used to match the existing media record ("fingerprint" or "imagehash").
+	Match string
+}
+
+// Error returns a string representation of the DuplicateMediaError.
+func (e *DuplicateMediaError) Error() string {
+	return fmt.Sprintf("Image with fingerprint '%s' is a duplicate (by %s) of existing media record %d", e.Fingerprint, e.Match, e.ID)
+}
+
+type memoryImageHashes struct {
+	id     int64
+	hashes map[string]string
+}
+
+var _ MediaLookup = (*MemoryMediaLookup)(nil)
+
+// MemoryMediaLookup implements the MediaLookup interface for records stored in memory.
+type MemoryMediaLookup struct {
+	// The maximum (Hamming) distance between two image hashes for them to be considered near-duplicates.
+	MaxDistance  int
+	fingerprints map[string]int64
+	imagehashes  []*memoryImageHashes
+	mu           *sync.RWMutex
+}
+
+// NewMemoryMediaLookup returns a new MemoryMediaLookup instance. Image hashes whose distance is less than or
+// equal to 'max_distance' are considered near-duplicates.
+func NewMemoryMediaLookup(ctx context.Context, max_distance int) (*MemoryMediaLookup, error) {
+
+	l := &MemoryMediaLookup{
+		MaxDistance:  max_distance,
+		fingerprints: make(map[string]int64),
+		imagehashes:  make([]*memoryImageHashes, 0),
+		mu:           new(sync.RWMutex),
+	}
+
+	return l, nil
+}
+
+// AddFeature will add the media:fingerprint and media:imagehash_* properties of the media feature 'body' to the lookup.
+func (l *MemoryMediaLookup) AddFeature(ctx context.Context, body []byte) error {
+
+	id_rsp := gjson.GetBytes(body, "properties.wof:id")
+
+	if !id_rsp.Exists() {
+		return fmt.Errorf("Missing properties.wof:id")
+	}
+
+	id := id_rsp.Int()
+
+	hashes := make(map[string]string)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	for k, v := range props_rsp.Map() {
+
+		if strings.HasPrefix(k, "media:imagehash_") {
+			approach := strings.Replace(k, "media:imagehash_", "", 1)
+			hashes[approach] = v.String()
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fp_rsp := gjson.GetBytes(body, "properties.media:fingerprint")
+
+	if fp_rsp.Exists() {
+		l.fingerprints[fp_rsp.String()] = id
+	}
+
+	if len(hashes) > 0 {
+
+		h := &memoryImageHashes{
+			id:     id,
+			hashes: hashes,
+		}
+
+		l.imagehashes = append(l.imagehashes, h)
+	}
+
+	return nil
+}
+
+// LookupFingerprint returns the ID of an existing media record whose media:fingerprint property matches 'fingerprint'
+// or 0 if there is no match.
+func (l *MemoryMediaLookup) LookupFingerprint(ctx context.Context, fingerprint string) (int64, error) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	id, ok := l.fingerprints[fingerprint]
+
+	if !ok {
+		return 0, nil
+	}
+
+	return id, nil
+}
+
+// LookupImageHashes returns the ID of the first existing media record where all the image hashes shared with 'hashes'
+// are within l.MaxDistance of each other or 0 if there is no match.
+func (l *MemoryMediaLookup) LookupImageHashes(ctx context.Context, hashes []*common.ImageHashRsp) (int64, error) {
+
+	if len(hashes) == 0 {
+		return 0, nil
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, candidate := range l.imagehashes {
+
+		compared := 0
+		matches := 0
+
+		for _, h := range hashes {
+
+			other, ok := candidate.hashes[h.Approach]
+
+			if !ok {
+				continue
+			}
+
+			compared += 1
+
+			d, err := common.ImageHashDistance(h.Hash, other)
+
+			if err != nil {
+				return 0, fmt.Errorf("Failed to compare image hashes for record %d, %w", candidate.id, err)
+			}
+
+			if d <= l.MaxDistance {
+				matches += 1
+			}
+		}
+
+		if compared > 0 && compared == matches {
+			return candidate.id, nil
+		}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,145 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/sfomuseum/go-whosonfirst-media/operations/gather"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"github.com/whosonfirst/go-whosonfirst-export/v3"
+	"gocloud.dev/blob"
+)
+
+// UpdateMediaFeatureOptions is a struct containing application-specific options used to update existing media-related GeoJSON Features.
+type UpdateMediaFeatureOptions struct {
+	// The gocloud.dev/blob.Bucket where media records are loaded from
+	SourceBucket *blob.Bucket
+	// A valid whosonfirst/go-whosonfirst-export Exporter for exporting the updated feature.
+	Exporter export.Exporter
+	// The feature depicted by the media feature. If the new image has no EXIF coordinates the geometry is reset to the
+	// (approximate) centroid of this feature. It is required if the existing geometry was derived from EXIF data.
+	Depicts []byte
+}
+
+// UpdateMediaFeature will update the media-specific properties of an existing media feature, 'body', using the details in 'rsp'
+// (typically the result of regathering a replaced or rescanned image). The fingerprint, mimetype, image hashes, image text and
+// EXIF-derived properties (including the geometry) are updated in place. All other properties, including wof:id and any curated properties, are preserved.
+// The updated feature is re-exported using the Exporter defined in 'opts'.
+func UpdateMediaFeature(ctx context.Context, body []byte, rsp *gather.GatherImagesResponse, opts *UpdateMediaFeatureOptions) ([]byte, error) {
+
+	if opts.Exporter == nil {
+		return nil, fmt.Errorf("Options missing Exporter")
+	}
+
+	id_rsp := gjson.GetBytes(body, "properties.wof:id")
+
+	if !id_rsp.Exists() {
+		return nil, fmt.Errorf("Missing properties.wof:id")
+	}
+
+	logger := slog.Default()
+	logger = logger.With("id", id_rsp.Int())
+
+	logger.Debug("Update media feature")
+
+	mp, err := properties.Unmarshal(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive media properties, %w", err)
+	}
+
+	mp.Fingerprint = rsp.Fingerprint
+	mp.Mimetype = rsp.MimeType
+	mp.ImageText = string(rsp.ImageText)
+
+	// Replace rather than merge image hashes so that hashes derived using
+	// approaches that weren't applied to the new image are removed
+
+	mp.ImageHashes = make(map[string]string)
+
+	for _, h := range rsp.ImageHashes {
+		mp.ImageHashes[h.Approach] = h.Hash
+	}
+
+	exif_props, err := deriveEXIFProperties(ctx, opts.SourceBucket, rsp.Path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive EXIF properties, %w", err)
+	}
+
+	mp.Created = 0
+
+	if exif_props != nil && exif_props.HasCreated() {
+		mp.Created = exif_props.Created
+	}
+
+	body, err = mp.Marshal(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to assign media properties, %w", err)
+	}
+
+	// Handle the geometry the same way as media:created: if the new image has
+	// no coordinates then any EXIF-derived geometry is reset to the approximate
+	// geometry of the feature being depicted, as NewMediaFeature does
+
+	var geom *Geometry
+	is_approximate := 0
+
+	if exif_props != nil && exif_props.HasCoordinates() {
+
+		geom = &Geometry{
+			Type:        "Point",
+			Coordinates: []float64{exif_props.Longitude, exif_props.Latitude},
+		}
+
+	} else if opts.Depicts != nil {
+
+		approx_geom, err := approximateGeometry(opts.Depicts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		geom = &approx_geom
+		is_approximate = 1
+
+	} else if gjson.GetBytes(body, "properties.mz:is_approximate").Int() != 1 {
+		return nil, fmt.Errorf("Options missing Depicts, required to reset EXIF-derived geometry")
+	}
+
+	if geom != nil {
+
+		updates := map[string]interface{}{
+			"geometry":                     geom,
+			"properties.mz:is_approximate": is_approximate,
+		}
+
+		for path, value := range updates {
+
+			body, err = sjson.SetBytes(body, path, value)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to assign %s property, %w", path, err)
+			}
+		}
+	}
+
+	err = properties.ValidateFeature(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Updated feature has invalid media properties, %w", err)
+	}
+
+	_, body, err = opts.Exporter.Export(ctx, body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to export updated feature, %w", err)
+	}
+
+	logger.Debug("Return updated media feature")
+	return body, nil
+}
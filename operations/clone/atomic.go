@@ -0,0 +1,431 @@
+package clone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/aaronland/go-string/random"
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"gocloud.dev/blob"
+)
+
+// cloneObject is a struct containing details about an object (an image or a feature) being written as part of a cloneTransaction.
+type cloneObject struct {
+	// The final key for the object in the target bucket. Objects added with AddStream are assigned their final key, using
+	// SetKey, after they have been staged.
+	key string
+	// The body of the object, or nil if the object was streamed to its temporary key by AddStream.
+	body []byte
+	// The digest of the body of the object.
+	digest *digest
+	// The attributes used to derive the options for writing (and copying) the object.
+	attrs *common.WriteAttributes
+	// The random suffix used to derive the temporary and backup keys.
+	suffix string
+	// The temporary key where the object is staged before being committed.
+	tmp_key string
+	// The key where the previous version of the object (if there is one) is backed up during a commit.
+	backup_key string
+	// A boolean flag indicating whether the object has been written to its temporary key and verified.
+	staged bool
+	// A boolean flag indicating whether a previous version of the object was backed up.
+	backed_up bool
+	// A boolean flag indicating whether the object has been copied to its final key.
+	committed bool
+}
+
+// cloneTransaction is a struct for writing one or more objects to a bucket as a single unit. Objects are first written
+// ("staged") to temporary keys and verified, then copied ("committed") to their final keys. If any step fails then all
+// the objects are rolled back to their previous state.
+type cloneTransaction struct {
+	bucket  *blob.Bucket
+	policy  common.WritePolicy
+	objects []*cloneObject
+	// A boolean flag indicating whether rolling back the transaction failed, in which case backups are not removed.
+	rollback_failed bool
+}
+
+// newCloneTransaction returns a new cloneTransaction for writing objects to 'bucket' using the options derived from 'policy'.
+// If 'policy' is nil then common.DefaultWritePolicy is used.
+func newCloneTransaction(bucket *blob.Bucket, policy common.WritePolicy) (*cloneTransaction, error) {
+
+	if policy == nil {
+		policy = common.NewDefaultWritePolicy()
+	}
+
+	tx := &cloneTransaction{
+		bucket:  bucket,
+		policy:  policy,
+		objects: make([]*cloneObject, 0),
+	}
+
+	return tx, nil
+}
+
+// Add will add an object, with final key 'key', body 'body' and digest 'd', associated with WOF ID 'id' to the transaction.
+func (tx *cloneTransaction) Add(key string, body []byte, d *digest, id int64) error {
+
+	suffix, err := tempSuffix()
+
+	if err != nil {
+		return err
+	}
+
+	obj := &cloneObject{
+		key:    key,
+		body:   body,
+		digest: d,
+		attrs: &common.WriteAttributes{
+			Key:         key,
+			ContentType: common.SniffContentType(key, body),
+			ID:          id,
+			Fingerprint: d.Fingerprint(),
+		},
+		suffix:     suffix,
+		tmp_key:    fmt.Sprintf("%s.%s.tmp", key, suffix),
+		backup_key: fmt.Sprintf("%s.%s.bak", key, suffix),
+	}
+
+	tx.objects = append(tx.objects, obj)
+	return nil
+}
+
+// AddStream will add an object, associated with WOF ID 'id', whose body is written by 'write_func' to the transaction.
+// The body is streamed to a temporary key, derived from 'name', and its digest is computed as it is written so that it is
+// never held in memory. The staged object is verified before AddStream returns. The returned cloneObject must be assigned
+// its final key, using SetKey, before the transaction is executed. Since the fingerprint of the body is not known until
+// it has been written the "fingerprint" metadata assigned by some WritePolicy implementations is not set for the object.
+func (tx *cloneTransaction) AddStream(ctx context.Context, name string, content_type string, id int64, write_func func(io.Writer) error) (*cloneObject, error) {
+
+	suffix, err := tempSuffix()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tmp_key := fmt.Sprintf("%s.%s.tmp", name, suffix)
+
+	obj := &cloneObject{
+		digest: newDigest(),
+		attrs: &common.WriteAttributes{
+			Key:         tmp_key,
+			ContentType: content_type,
+			ID:          id,
+		},
+		suffix:  suffix,
+		tmp_key: tmp_key,
+	}
+
+	// Add the object before it is written so that cleanup removes a partially written temporary key
+
+	tx.objects = append(tx.objects, obj)
+
+	wr_opts, err := tx.policy.WriterOptions(ctx, obj.attrs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive writer options for %s, %w", tmp_key, err)
+	}
+
+	wr, err := tx.bucket.NewWriter(ctx, tmp_key, wr_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create writer for %s, %w", tmp_key, err)
+	}
+
+	err = write_func(io.MultiWriter(wr, obj.digest))
+
+	if err != nil {
+		wr.Close()
+		return nil, fmt.Errorf("Failed to write %s, %w", tmp_key, err)
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to close %s after writing, %w", tmp_key, err)
+	}
+
+	ok, err := verifyObject(ctx, tx.bucket, tmp_key, obj.digest)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to verify %s, %w", tmp_key, err)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("Staged object %s does not match source", tmp_key)
+	}
+
+	obj.staged = true
+	return obj, nil
+}
+
+// SetKey assigns the final key 'key' to an object added using AddStream.
+func (obj *cloneObject) SetKey(key string) {
+
+	obj.key = key
+	obj.backup_key = fmt.Sprintf("%s.%s.bak", key, obj.suffix)
+	obj.attrs.Key = key
+	obj.attrs.Fingerprint = obj.digest.Fingerprint()
+}
+
+// Execute will stage, verify and commit all the objects in the transaction. If any of those steps fail the transaction
+// is rolled back. Callers are expected to call Cleanup once the transaction is no longer needed.
+func (tx *cloneTransaction) Execute(ctx context.Context) error {
+
+	for _, obj := range tx.objects {
+
+		if obj.key == "" {
+			return fmt.Errorf("Staged object %s has not been assigned a key", obj.tmp_key)
+		}
+	}
+
+	for _, obj := range tx.objects {
+
+		if obj.staged {
+			continue
+		}
+
+		err := tx.stage(ctx, obj)
+
+		if err != nil {
+			return fmt.Errorf("Failed to stage %s, %w", obj.key, err)
+		}
+	}
+
+	for _, obj := range tx.objects {
+
+		err := tx.commit(ctx, obj)
+
+		if err != nil {
+
+			rollback_err := tx.rollback(ctx)
+
+			if rollback_err != nil {
+				return fmt.Errorf("Failed to commit %s, %w (and failed to roll back, %w)", obj.key, err, rollback_err)
+			}
+
+			return fmt.Errorf("Failed to commit %s, %w", obj.key, err)
+		}
+	}
+
+	return nil
+}
+
+// stage writes the body of 'obj' to its temporary key and verifies that it was written correctly.
+func (tx *cloneTransaction) stage(ctx context.Context, obj *cloneObject) error {
+
+	wr_opts, err := tx.policy.WriterOptions(ctx, obj.attrs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive writer options for %s, %w", obj.key, err)
+	}
+
+	err = writeObject(ctx, tx.bucket, obj.tmp_key, obj.body, obj.digest, wr_opts)
+
+	if err != nil {
+		return err
+	}
+
+	ok, err := verifyObject(ctx, tx.bucket, obj.tmp_key, obj.digest)
+
+	if err != nil {
+		return fmt.Errorf("Failed to verify %s, %w", obj.tmp_key, err)
+	}
+
+	if !ok {
+		return fmt.Errorf("Staged object %s does not match source", obj.tmp_key)
+	}
+
+	obj.staged = true
+	return nil
+}
+
+// commit backs up the previous version of 'obj' (if there is one), copies 'obj' from its temporary key to its final key
+// and verifies that the copy matches the original.
+func (tx *cloneTransaction) commit(ctx context.Context, obj *cloneObject) error {
+
+	exists, err := tx.bucket.Exists(ctx, obj.key)
+
+	if err != nil {
+		return fmt.Errorf("Failed to determine if %s exists, %w", obj.key, err)
+	}
+
+	copy_opts, err := tx.policy.CopyOptions(ctx, obj.attrs)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive copy options for %s, %w", obj.key, err)
+	}
+
+	if exists {
+
+		err := tx.bucket.Copy(ctx, obj.backup_key, obj.key, nil)
+
+		if err != nil {
+			return fmt.Errorf("Failed to back up %s, %w", obj.key, err)
+		}
+
+		obj.backed_up = true
+	}
+
+	// Set this before the copy since a failed copy may still have modified the final key
+
+	obj.committed = true
+
+	err = tx.bucket.Copy(ctx, obj.key, obj.tmp_key, copy_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s to %s, %w", obj.tmp_key, obj.key, err)
+	}
+
+	ok, err := verifyObject(ctx, tx.bucket, obj.key, obj.digest)
+
+	if err != nil {
+		return fmt.Errorf("Failed to verify %s, %w", obj.key, err)
+	}
+
+	if !ok {
+		return fmt.Errorf("Committed object %s does not match source", obj.key)
+	}
+
+	return nil
+}
+
+// rollback restores any objects that have been committed to their previous state.
+func (tx *cloneTransaction) rollback(ctx context.Context) error {
+
+	// Use a context that can't be cancelled so that previous versions are
+	// restored even if the transaction was interrupted
+
+	ctx = context.WithoutCancel(ctx)
+
+	errs := make([]error, 0)
+
+	for _, obj := range tx.objects {
+
+		if !obj.committed {
+			continue
+		}
+
+		var err error
+
+		if obj.backed_up {
+			err = tx.bucket.Copy(ctx, obj.key, obj.backup_key, nil)
+		} else {
+			err = deleteObject(ctx, tx.bucket, obj.key)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to roll back %s, %w", obj.key, err))
+			continue
+		}
+
+		obj.committed = false
+	}
+
+	if len(errs) > 0 {
+		tx.rollback_failed = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// Cleanup removes all the temporary and backup objects created by the transaction, except for backups that are needed to
+// restore previous versions if the transaction failed to roll back (which are logged instead).
+func (tx *cloneTransaction) Cleanup(ctx context.Context) {
+
+	// Use a context that can't be cancelled so that temporary files are
+	// removed even if the transaction was interrupted
+
+	ctx = context.WithoutCancel(ctx)
+
+	for _, obj := range tx.objects {
+
+		keys := []string{obj.tmp_key}
+
+		if tx.rollback_failed && obj.backed_up {
+			slog.Error("Transaction failed to roll back, keeping backup of previous version", "key", obj.key, "backup", obj.backup_key)
+		} else {
+			keys = append(keys, obj.backup_key)
+		}
+
+		for _, key := range keys {
+
+			if key == "" {
+				continue
+			}
+
+			err := deleteObject(ctx, tx.bucket, key)
+
+			if err != nil {
+				slog.Warn("Failed to remove temporary object", "key", key, "error", err)
+			}
+		}
+	}
+}
+
+// tempSuffix returns a random string used to derive the temporary and backup keys of an object.
+func tempSuffix() (string, error) {
+
+	rand_opts := random.DefaultOptions()
+	rand_opts.AlphaNumeric = true
+
+	suffix, err := random.String(rand_opts)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate suffix for temporary keys, %w", err)
+	}
+
+	return suffix, nil
+}
+
+// writeObject writes 'body' to 'key' in 'bucket' using 'wr_opts'. The MD5 hash in 'd' is passed to the bucket so that the
+// write fails if the bytes received do not match.
+func writeObject(ctx context.Context, bucket *blob.Bucket, key string, body []byte, d *digest, wr_opts *blob.WriterOptions) error {
+
+	if wr_opts == nil {
+		wr_opts = &blob.WriterOptions{}
+	}
+
+	wr_opts.ContentMD5 = d.MD5()
+
+	wr, err := bucket.NewWriter(ctx, key, wr_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create writer for %s, %w", key, err)
+	}
+
+	_, err = wr.Write(body)
+
+	if err != nil {
+		wr.Close()
+		bucket.Delete(ctx, key)
+		return fmt.Errorf("Failed to write %s, %w", key, err)
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close %s after writing, %w", key, err)
+	}
+
+	return nil
+}
+
+// deleteObject removes 'key' from 'bucket' if it exists.
+func deleteObject(ctx context.Context, bucket *blob.Bucket, key string) error {
+
+	exists, err := bucket.Exists(ctx, key)
+
+	if err != nil {
+		return fmt.Errorf("Failed to determine if %s exists, %w", key, err)
+	}
+
+	if !exists {
+		return nil
+	}
+
+	return bucket.Delete(ctx, key)
+}
@@ -0,0 +1,339 @@
+package clone
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"sync"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/transform"
+	"github.com/whosonfirst/go-reader/v2"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"gocloud.dev/blob"
+)
+
+// DEFAULT_WORKERS is the default number of clone requests that CloneImages will process concurrently.
+const DEFAULT_WORKERS int = 10
+
+// CloneRequest is a struct encapsulating data for cloning a single image (and its feature).
+type CloneRequest struct {
+	// WOF (or sfomuseum-data-media-* ) ID
+	ID int64 `json:"id"`
+	// Source FileMaker image ID
+	ImageID int64 `json:"image_id"`
+	// Source FileMaker image filename
+	Filename string `json:"filename"`
+	// The path to the (GeoJSON) Feature record associated with the image, relative to CloneImagesOptions.FeatureReader.
+	// If empty, and CloneImagesOptions.FeatureReader is defined, the path is derived from ID.
+	Feature string `json:"feature,omitempty"`
+}
+
+// key returns a unique key for the request used to identify it in a Manifest.
+func (req *CloneRequest) key() string {
+	return fmt.Sprintf("%d#%d#%s", req.ID, req.ImageID, req.Filename)
+}
+
+// CloneRequestError is an error returned for an individual clone request that could not be parsed.
+type CloneRequestError struct {
+	// The (1-based) line number of the clone request.
+	Line int
+	// The underlying error.
+	Err error
+}
+
+// Error returns a string describing the clone request that could not be parsed and why.
+func (e *CloneRequestError) Error() string {
+	return fmt.Sprintf("Invalid clone request at line %d, %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CloneRequestError) Unwrap() error {
+	return e.Err
+}
+
+// CloneImagesOptions is a struct containing application-specific options and details related to cloning a batch of images.
+type CloneImagesOptions struct {
+	// A blob.Bucket instance where images are read from.
+	Source *blob.Bucket
+	// A blob.Bucket instance where images are written to.
+	Target *blob.Bucket
+	// An optional whosonfirst/go-reader.Reader instance where the (GeoJSON) Feature records associated with images are read from.
+	FeatureReader reader.Reader
+	// Boolean flag to signal that images should be cloned even if they already exist in the target location.
+	Force bool
+	// An optional list of transformations to apply, in order, to each image before it is written to the target location.
+	Transformations []transform.Transformation
+	// An optional naming template used to derive the path of each image in the target location. See CloneImageOptions.ImageTemplate for details.
+	ImageTemplate string
+	// An optional naming template used to derive the path of each feature in the target location. See CloneImageOptions.FeatureTemplate for details.
+	FeatureTemplate string
+	// An optional common.WritePolicy used to derive the options for objects written to the target location. See CloneImageOptions.WritePolicy for details.
+	WritePolicy common.WritePolicy
+	// The maximum number of clone requests to process concurrently. If 0 then DEFAULT_WORKERS is used.
+	Workers int
+	// An optional Manifest from a previous run. Requests that it records as cloned or skipped are not processed again.
+	Resume *Manifest
+	// An optional io.Writer where manifest entries are written, as JSON Lines, as each clone request completes.
+	ManifestWriter io.Writer
+}
+
+// ReadCloneRequests returns an iterator of CloneRequest instances derived from the JSON Lines encoded records in 'r'. Lines
+// that can not be parsed, or that decode to a null request, yield a CloneRequestError.
+func ReadCloneRequests(r io.Reader) iter.Seq2[*CloneRequest, error] {
+
+	return func(yield func(*CloneRequest, error) bool) {
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		lineno := 0
+
+		for scanner.Scan() {
+
+			lineno += 1
+
+			line := scanner.Bytes()
+
+			if len(line) == 0 {
+				continue
+			}
+
+			var req *CloneRequest
+
+			err := json.Unmarshal(line, &req)
+
+			if err != nil {
+				err = &CloneRequestError{Line: lineno, Err: fmt.Errorf("Failed to unmarshal clone request, %w", err)}
+			} else if req == nil {
+				err = &CloneRequestError{Line: lineno, Err: fmt.Errorf("Clone request is null")}
+			}
+
+			if !yield(req, err) {
+				return
+			}
+		}
+
+		err := scanner.Err()
+
+		if err != nil {
+			yield(nil, fmt.Errorf("Failed to read clone requests, %w", err))
+		}
+	}
+}
+
+// CloneImages will clone each image (and its feature) in 'requests' from a source bucket to a target bucket, defined in
+// 'opts', processing up to opts.Workers requests concurrently. It returns a Manifest recording the outcome of every request
+// (including those carried over from opts.Resume). Individual clone failures, and requests that could not be parsed
+// (CloneRequestError), are recorded in the manifest rather than returned as errors; an error is only returned if a naming
+// template is invalid, 'requests' yields any other error or the manifest can not be written.
+func CloneImages(ctx context.Context, opts *CloneImagesOptions, requests iter.Seq2[*CloneRequest, error]) (*Manifest, error) {
+
+	for _, t := range []string{opts.ImageTemplate, opts.FeatureTemplate} {
+
+		if t == "" {
+			continue
+		}
+
+		_, err := NewNamingTemplate(t)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid naming template, %w", err)
+		}
+	}
+
+	workers := opts.Workers
+
+	if workers <= 0 {
+		workers = DEFAULT_WORKERS
+	}
+
+	manifest := NewManifest()
+
+	wr_mu := new(sync.Mutex)
+	var wr_err error
+
+	record := func(e *ManifestEntry) {
+
+		manifest.Add(e)
+
+		if opts.ManifestWriter == nil {
+			return
+		}
+
+		wr_mu.Lock()
+		defer wr_mu.Unlock()
+
+		err := writeManifestEntry(opts.ManifestWriter, e)
+
+		if err != nil && wr_err == nil {
+			wr_err = err
+		}
+	}
+
+	throttle := make(chan bool, workers)
+	wg := new(sync.WaitGroup)
+
+	var iter_err error
+
+	offset := 0
+
+	for req, err := range requests {
+
+		offset += 1
+
+		if err == nil && req == nil {
+			err = &CloneRequestError{Line: offset, Err: fmt.Errorf("Clone request is nil")}
+		}
+
+		if err != nil {
+
+			var req_err *CloneRequestError
+
+			if !errors.As(err, &req_err) {
+				iter_err = err
+				break
+			}
+
+			slog.Error("Failed to parse clone request", "line", req_err.Line, "error", req_err.Err)
+
+			record(&ManifestEntry{
+				Line:   req_err.Line,
+				Status: MANIFEST_FAILED,
+				Error:  req_err.Error(),
+			})
+
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			iter_err = ctx.Err()
+		default:
+			// pass
+		}
+
+		if iter_err != nil {
+			break
+		}
+
+		if opts.Resume != nil && opts.Resume.Completed(req) {
+
+			e, _ := opts.Resume.Entry(req)
+			manifest.Add(e)
+
+			slog.Debug("Skip clone request completed in previous run", "id", req.ID, "filename", req.Filename)
+			continue
+		}
+
+		throttle <- true
+		wg.Add(1)
+
+		go func(req *CloneRequest) {
+
+			defer func() {
+				<-throttle
+				wg.Done()
+			}()
+
+			record(cloneRequest(ctx, opts, req))
+
+		}(req)
+	}
+
+	wg.Wait()
+
+	if iter_err != nil {
+		return manifest, iter_err
+	}
+
+	if wr_err != nil {
+		return manifest, wr_err
+	}
+
+	return manifest, nil
+}
+
+// cloneRequest will clone the image (and feature) defined by 'req' and return a ManifestEntry recording the outcome.
+func cloneRequest(ctx context.Context, opts *CloneImagesOptions, req *CloneRequest) *ManifestEntry {
+
+	logger := slog.Default()
+	logger = logger.With("id", req.ID)
+	logger = logger.With("filename", req.Filename)
+
+	e := &ManifestEntry{
+		Request: req,
+	}
+
+	fail := func(err error) *ManifestEntry {
+		logger.Error("Failed to clone image", "error", err)
+		e.Status = MANIFEST_FAILED
+		e.Error = err.Error()
+		return e
+	}
+
+	clone_opts := &CloneImageOptions{
+		Source:          opts.Source,
+		Target:          opts.Target,
+		ID:              req.ID,
+		ImageID:         req.ImageID,
+		Filename:        req.Filename,
+		Force:           opts.Force,
+		Transformations: opts.Transformations,
+		ImageTemplate:   opts.ImageTemplate,
+		FeatureTemplate: opts.FeatureTemplate,
+		WritePolicy:     opts.WritePolicy,
+	}
+
+	if req.Feature != "" || opts.FeatureReader != nil {
+
+		if opts.FeatureReader == nil {
+			return fail(fmt.Errorf("Request defines feature '%s' but there is no feature reader", req.Feature))
+		}
+
+		feature_path := req.Feature
+
+		if feature_path == "" {
+
+			rel_path, err := uri.Id2RelPath(req.ID)
+
+			if err != nil {
+				return fail(fmt.Errorf("Failed to derive relative path for %d, %w", req.ID, err))
+			}
+
+			feature_path = rel_path
+		}
+
+		r, err := opts.FeatureReader.Read(ctx, feature_path)
+
+		if err != nil {
+			return fail(fmt.Errorf("Failed to read feature %s, %w", feature_path, err))
+		}
+
+		defer r.Close()
+
+		clone_opts.Feature = r
+	}
+
+	rsp, err := CloneImage(ctx, clone_opts)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	e.Target = rsp.Path
+	e.Fingerprint = rsp.Fingerprint
+	e.Status = MANIFEST_CLONED
+
+	if rsp.Skipped {
+		e.Status = MANIFEST_SKIPPED
+	}
+
+	logger.Debug("Clone image", "target", rsp.Path, "status", e.Status)
+	return e
+}
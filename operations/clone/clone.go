@@ -2,11 +2,20 @@
 package clone
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"path/filepath"
+	"strings"
 
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"github.com/sfomuseum/go-whosonfirst-media/status"
+	"github.com/sfomuseum/go-whosonfirst-media/transform"
+	"github.com/tidwall/sjson"
 	"gocloud.dev/blob"
 )
 
@@ -23,110 +32,345 @@ type CloneImageOptions struct {
 	ImageID int64
 	// Source FileMaker image filename
 	Filename string
-	// Boolean flag to signal that an image should be cloned even if it already exists in the target location.
+	// Boolean flag to signal that an image should be cloned even if it already exists in the target location. If false
+	// then the image (and feature) will only be skipped if they both exist in the target location and their contents match.
 	Force bool
 	// The (GeoJSON) Feature record associated with this image.
 	Feature io.ReadCloser
+	// An optional list of transformations to apply, in order, to the image before it is written to the target location.
+	// If the transformations change the image's format then the filename extension of the target path is updated to match.
+	Transformations []transform.Transformation
+	// An optional naming template used to derive the path of the image in the target location. If empty then
+	// DEFAULT_IMAGE_TEMPLATE is used, or DEFAULT_FILENAME_IMAGE_TEMPLATE if ImageID is -1. See NamingTemplate for details.
+	ImageTemplate string
+	// An optional naming template used to derive the path of the feature in the target location. If empty then
+	// DEFAULT_FEATURE_TEMPLATE is used. See NamingTemplate for details. Features cloned for processing should only use the
+	// {id} and {id_path} placeholders, and the same template should be assigned to process.ReportProcessor.FeatureTemplate,
+	// so that the report processor can locate them.
+	FeatureTemplate string
+	// An optional common.WritePolicy used to derive the options (content type, cache headers, metadata and driver-specific
+	// options) for objects written to the target location. If nil then common.DefaultWritePolicy is used.
+	WritePolicy common.WritePolicy
 }
 
-// CloneImage will copy a file from a source bucket to a target bucket, defined in 'opts'.
-func CloneImage(ctx context.Context, opts *CloneImageOptions) (string, error) {
+// CloneImageResult is a struct containing details about the outcome of cloning an image.
+type CloneImageResult struct {
+	// The path of the image in the target location.
+	Path string `json:"path"`
+	// The path of the feature in the target location. Empty if no feature was cloned.
+	FeaturePath string `json:"feature_path,omitempty"`
+	// The SHA-1 fingerprint of the image written to (or already present in) the target location, computed as the image was read.
+	Fingerprint string `json:"fingerprint"`
+	// Boolean flag indicating that the image (and feature) already existed in the target location, with matching contents, and was not written again.
+	Skipped bool `json:"skipped"`
+	// Boolean flag indicating that an existing image (or feature) in the target location did not match and was overwritten.
+	Replaced bool `json:"replaced"`
+}
 
-	image_ext := filepath.Ext(opts.Filename)
+// CloneImage will copy a file from a source bucket to a target bucket, defined in 'opts'. The image and its feature (if
+// present) are treated as a single unit: Both are written to temporary locations and verified before being copied to
+// their final locations. If either step fails then both the image and the feature are rolled back to their previous state.
+// The image is streamed to its temporary location, and its fingerprint computed as it is written, so that it is never held
+// in memory. The fingerprint is compared against the hash stored by the target bucket (or a re-read of the target) so that
+// stale or truncated objects in the target location are detected and overwritten. If 'ctx' is cancelled before anything
+// is committed then the context's error is returned.
+func CloneImage(ctx context.Context, opts *CloneImageOptions) (*CloneImageResult, error) {
 
-	var target_path string
+	// Read and validate the WOF record associated with the image file
+	// before anything is written to the target bucket
 
-	switch opts.ImageID {
-	case -1:
-		target_path = fmt.Sprintf("%d_%s", opts.ID, opts.Filename)
-	default:
-		target_path = fmt.Sprintf("%d_%d%s", opts.ID, opts.ImageID, image_ext)
+	var feature_body []byte
+
+	if opts.Feature != nil {
+
+		if opts.ID == 0 {
+			return nil, fmt.Errorf("Feature ID is missing.")
+		}
+
+		body, err := io.ReadAll(opts.Feature)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read feature, %w", err)
+		}
+
+		err = properties.ValidateFeature(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Feature has invalid media properties, %w", err)
+		}
+
+		body, err = status.MarkCloned(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to update feature status, %w", err)
+		}
+
+		feature_body = body
+	}
+
+	image_path := opts.Filename
+
+	image_fname := opts.Filename
+
+	tx, err := newCloneTransaction(opts.Target, opts.WritePolicy)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create clone transaction, %w", err)
+	}
+
+	defer tx.Cleanup(ctx)
+
+	// The image is streamed to a temporary key in the target bucket, and its digest computed
+	// as it is written, so that (large) images are never held in memory
+
+	var image_obj *cloneObject
+
+	if len(opts.Transformations) > 0 {
+
+		im, source_format, err := transformImage(ctx, opts.Source, image_path, opts.Transformations...)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to transform %s, %w", image_path, err)
+		}
+
+		if im.Format != source_format {
+			image_fname = strings.TrimSuffix(opts.Filename, filepath.Ext(opts.Filename)) + im.Extension()
+		}
+
+		obj, err := tx.AddStream(ctx, image_fname, im.Mimetype(), opts.ID, im.Encode)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to stage transformed image for %s, %w", image_path, err)
+		}
+
+		image_obj = obj
+
+		// The transformed image is what will be processed so the feature
+		// needs to describe it rather than the untransformed source image
+
+		if feature_body != nil {
+
+			mp, err := properties.Unmarshal(feature_body)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to derive media properties, %w", err)
+			}
+
+			mp.ReplaceFingerprint(image_obj.digest.Fingerprint(), "transform")
+			mp.Mimetype = im.Mimetype()
+
+			feature_body, err = mp.Marshal(feature_body)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to assign media properties, %w", err)
+			}
+		}
+
+	} else {
+
+		r, err := opts.Source.NewReader(ctx, image_path, nil)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create reader for %s, %w", image_path, err)
+		}
+
+		defer r.Close()
+
+		br := bufio.NewReader(r)
+
+		// Peek at the start of the image in order to sniff its content type
+
+		head, err := br.Peek(512)
+
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("Failed to read %s, %w", image_path, err)
+		}
+
+		copy_func := func(wr io.Writer) error {
+			_, err := io.Copy(wr, br)
+			return err
+		}
+
+		obj, err := tx.AddStream(ctx, image_fname, common.SniffContentType(image_path, head), opts.ID, copy_func)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to stage %s, %w", image_path, err)
+		}
+
+		image_obj = obj
+	}
+
+	image_digest := image_obj.digest
+
+	image_template := opts.ImageTemplate
+
+	if image_template == "" {
+
+		switch opts.ImageID {
+		case -1:
+			image_template = DEFAULT_FILENAME_IMAGE_TEMPLATE
+		default:
+			image_template = DEFAULT_IMAGE_TEMPLATE
+		}
+	}
+
+	feature_template := opts.FeatureTemplate
+
+	if feature_template == "" {
+		feature_template = DEFAULT_FEATURE_TEMPLATE
+	}
+
+	naming_values := &NamingValues{
+		ID:          opts.ID,
+		ImageID:     opts.ImageID,
+		Filename:    image_fname,
+		Fingerprint: image_digest.Fingerprint(),
+	}
+
+	target_path, err := renderTemplate(image_template, naming_values)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive target path for image, %w", err)
+	}
+
+	feature_path, err := renderTemplate(feature_template, naming_values)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive target path for feature, %w", err)
+	}
+
+	rsp := &CloneImageResult{
+		Path:        target_path,
+		Fingerprint: image_digest.Fingerprint(),
+	}
+
+	if feature_body != nil {
+		rsp.FeaturePath = feature_path
 	}
 
 	select {
 	case <-ctx.Done():
-		return "", nil
+		return nil, ctx.Err()
 	default:
 		// pass
 	}
 
 	if !opts.Force {
 
-		exists, err := opts.Target.Exists(ctx, target_path)
+		exists, stale, err := targetExists(ctx, opts.Target, target_path, image_digest, feature_path, feature_body)
 
 		if err != nil {
-			return target_path, fmt.Errorf("Failed to determine if %s exists, %w", target_path, err)
+			return nil, err
 		}
 
 		if exists {
-			return target_path, nil
+			rsp.Skipped = true
+			return rsp, nil
+		}
+
+		if stale {
+			slog.Warn("Target does not match source, overwriting", "path", target_path)
+			rsp.Replaced = true
 		}
 	}
 
-	// Copy the image file itself
+	image_obj.SetKey(target_path)
 
-	image_path := opts.Filename
+	if feature_body != nil {
+
+		err = tx.Add(feature_path, feature_body, digestBytes(feature_body), opts.ID)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to add %s to clone transaction, %w", feature_path, err)
+		}
+	}
 
-	source_r, err := opts.Source.NewReader(ctx, image_path, nil)
+	err = tx.Execute(ctx)
 
 	if err != nil {
-		return target_path, fmt.Errorf("Failed to create reader for %s, %w", image_path, err)
+		return nil, fmt.Errorf("Failed to clone %s to %s, %w", image_path, target_path, err)
 	}
 
-	defer source_r.Close()
+	return rsp, nil
+}
 
-	// this is where we might transform a source image (scaling it, converting
-	// image format, etc.) prior to processing (20191121/thisisaaronland)
+// targetExists returns a boolean value indicating whether the image (and the feature, if 'feature_body' is not nil) already
+// exist in 'bucket' with the same content as 'image_digest' and 'feature_body'. It also returns a boolean value indicating
+// whether either object exists but is stale (its content does not match).
+func targetExists(ctx context.Context, bucket *blob.Bucket, image_path string, image_digest *digest, feature_path string, feature_body []byte) (bool, bool, error) {
 
-	target_wr, err := opts.Target.NewWriter(ctx, target_path, nil)
+	exists, err := bucket.Exists(ctx, image_path)
 
 	if err != nil {
-		return target_path, fmt.Errorf("Failed to create writer for %s, %w", target_path, err)
+		return false, false, fmt.Errorf("Failed to determine if %s exists, %w", image_path, err)
 	}
 
-	_, err = io.Copy(target_wr, source_r)
+	if !exists {
+		return false, false, nil
+	}
+
+	matches, err := verifyObject(ctx, bucket, image_path, image_digest)
 
 	if err != nil {
-		opts.Target.Delete(ctx, target_path)
-		return target_path, fmt.Errorf("Failed to copy %s to %s, %w", image_path, target_path, err)
+		return false, false, fmt.Errorf("Failed to compare %s, %w", image_path, err)
+	}
+
+	if !matches {
+		slog.Debug("Existing image does not match source", "path", image_path)
+		return false, true, nil
 	}
 
-	err = target_wr.Close()
+	if feature_body == nil {
+		return true, false, nil
+	}
+
+	exists, err = bucket.Exists(ctx, feature_path)
 
 	if err != nil {
-		return target_path, fmt.Errorf("Failed to close %s after writing, %w", target_path, err)
+		return false, false, fmt.Errorf("Failed to determine if %s exists, %w", feature_path, err)
 	}
 
-	// Copy the WOF record associated with the image file
+	if !exists {
+		return false, false, nil
+	}
 
-	if opts.Feature != nil {
+	existing_feature, err := readObject(ctx, bucket, feature_path)
 
-		if opts.ID == 0 {
-			return "", fmt.Errorf("Feature ID is missing.")
-		}
+	if err != nil {
+		return false, false, err
+	}
 
-		feature_path := fmt.Sprintf("%d.geojson", opts.ID)
-		feature_r := opts.Feature
+	matches, err = featuresMatch(existing_feature, feature_body)
 
-		feature_wr, err := opts.Target.NewWriter(ctx, feature_path, nil)
+	if err != nil {
+		return false, false, fmt.Errorf("Failed to compare %s, %w", feature_path, err)
+	}
 
-		if err != nil {
-			return feature_path, fmt.Errorf("Failed to create new writer for %s, %w", feature_path, err)
-		}
+	if !matches {
+		slog.Debug("Existing feature does not match source", "path", feature_path)
+		return false, true, nil
+	}
 
-		_, err = io.Copy(feature_wr, feature_r)
+	return true, false, nil
+}
 
-		if err != nil {
-			opts.Target.Delete(ctx, feature_path)
-			return feature_path, fmt.Errorf("Failed to copy feature to %s, %w", feature_path, err)
-		}
+// featuresMatch returns a boolean value indicating whether two features have the same content, ignoring the timestamps
+// in their media:status_history properties (which are updated every time a feature is cloned).
+func featuresMatch(a []byte, b []byte) (bool, error) {
 
-		err = feature_wr.Close()
+	var err error
 
-		if err != nil {
-			return feature_path, fmt.Errorf("Failed to close %s after writing, %w", feature_path, err)
-		}
+	a, err = sjson.DeleteBytes(a, "properties.media:status_history")
+
+	if err != nil {
+		return false, err
+	}
+
+	b, err = sjson.DeleteBytes(b, "properties.media:status_history")
+
+	if err != nil {
+		return false, err
 	}
 
-	return target_path, nil
+	return bytes.Equal(a, b), nil
 }
@@ -0,0 +1,397 @@
+package clone
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+)
+
+const test_id int64 = 1511951011
+
+// test_image_path is the path of the image cloned by the tests, derived from DEFAULT_IMAGE_TEMPLATE using an image ID of 1.
+const test_image_path string = "1511951011_1.jpg"
+
+// test_feature_path is the path of the feature cloned by the tests, derived from DEFAULT_FEATURE_TEMPLATE.
+const test_feature_path string = "1511951011.geojson"
+
+// failingWritePolicy is a common.WritePolicy which fails to derive copy options for keys with a given suffix, so that
+// committing those keys fails.
+type failingWritePolicy struct {
+	common.WritePolicy
+	suffix string
+}
+
+func (p *failingWritePolicy) CopyOptions(ctx context.Context, attrs *common.WriteAttributes) (*blob.CopyOptions, error) {
+
+	if strings.HasSuffix(attrs.Key, p.suffix) {
+		return nil, fmt.Errorf("Refusing to copy %s", attrs.Key)
+	}
+
+	return p.WritePolicy.CopyOptions(ctx, attrs)
+}
+
+// testImage returns a JPEG-encoded image whose pixels are derived from 'seed'.
+func testImage(t *testing.T, seed uint8) []byte {
+
+	t.Helper()
+
+	im := image.NewRGBA(image.Rect(0, 0, 64, 64))
+
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			im.Set(x, y, color.RGBA{uint8(x*4) + seed, uint8(y * 4), seed, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+
+	err := jpeg.Encode(&buf, im, nil)
+
+	if err != nil {
+		t.Fatalf("Failed to encode image, %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// testFeature returns a media feature for test_id with the name 'name'.
+func testFeature(name string) io.ReadCloser {
+
+	feature := fmt.Sprintf(`{
+  "id": %d,
+  "type": "Feature",
+  "properties": {
+    "wof:id": %d,
+    "wof:name": "%s",
+    "wof:placetype": "media",
+    "media:medium": "image",
+    "media:mimetype": "image/jpeg",
+    "media:source": "test"
+  },
+  "geometry": {"type": "Point", "coordinates": [0.0, 0.0]}
+}`, test_id, test_id, name)
+
+	return io.NopCloser(strings.NewReader(feature))
+}
+
+// cloneOptions returns the CloneImageOptions for cloning 'source_key' in 'source' to 'target', with a feature named 'name'.
+func cloneOptions(source *blob.Bucket, target *blob.Bucket, source_key string, name string) *CloneImageOptions {
+
+	opts := &CloneImageOptions{
+		Source:   source,
+		Target:   target,
+		ID:       test_id,
+		ImageID:  1,
+		Filename: source_key,
+		Feature:  testFeature(name),
+	}
+
+	return opts
+}
+
+// listKeys returns the sorted list of keys in 'bucket'.
+func listKeys(t *testing.T, bucket *blob.Bucket) []string {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	keys := make([]string, 0)
+
+	iter := bucket.List(nil)
+
+	for {
+
+		obj, err := iter.Next(ctx)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to list bucket, %v", err)
+		}
+
+		keys = append(keys, obj.Key)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+// readKey returns the contents of 'key' in 'bucket'.
+func readKey(t *testing.T, bucket *blob.Bucket, key string) []byte {
+
+	t.Helper()
+
+	body, err := bucket.ReadAll(context.Background(), key)
+
+	if err != nil {
+		t.Fatalf("Failed to read %s, %v", key, err)
+	}
+
+	return body
+}
+
+func TestCloneImageReplacesTruncatedTarget(t *testing.T) {
+
+	ctx := context.Background()
+
+	source := memblob.OpenBucket(nil)
+	defer source.Close()
+
+	target := memblob.OpenBucket(nil)
+	defer target.Close()
+
+	body := testImage(t, 0)
+
+	err := source.WriteAll(ctx, "a.jpg", body, nil)
+
+	if err != nil {
+		t.Fatalf("Failed to write source image, %v", err)
+	}
+
+	rsp, err := CloneImage(ctx, cloneOptions(source, target, "a.jpg", "test"))
+
+	if err != nil {
+		t.Fatalf("Failed to clone image, %v", err)
+	}
+
+	if rsp.Path != test_image_path || rsp.FeaturePath != test_feature_path {
+		t.Fatalf("Unexpected paths, %s %s", rsp.Path, rsp.FeaturePath)
+	}
+
+	if rsp.Skipped || rsp.Replaced {
+		t.Fatalf("Expected image to be cloned, %v", rsp)
+	}
+
+	// Truncate the cloned image, as if an earlier copy had been interrupted
+
+	err = target.WriteAll(ctx, test_image_path, body[:len(body)/2], nil)
+
+	if err != nil {
+		t.Fatalf("Failed to truncate target image, %v", err)
+	}
+
+	rsp, err = CloneImage(ctx, cloneOptions(source, target, "a.jpg", "test"))
+
+	if err != nil {
+		t.Fatalf("Failed to clone image, %v", err)
+	}
+
+	if rsp.Skipped || !rsp.Replaced {
+		t.Fatalf("Expected truncated image to be replaced, %v", rsp)
+	}
+
+	if !bytes.Equal(readKey(t, target, test_image_path), body) {
+		t.Fatalf("Target image does not match source")
+	}
+
+	rsp, err = CloneImage(ctx, cloneOptions(source, target, "a.jpg", "test"))
+
+	if err != nil {
+		t.Fatalf("Failed to clone image, %v", err)
+	}
+
+	if !rsp.Skipped {
+		t.Fatalf("Expected matching image to be skipped, %v", rsp)
+	}
+
+	keys := listKeys(t, target)
+	expected := []string{test_feature_path, test_image_path}
+
+	if !slices.Equal(keys, expected) {
+		t.Fatalf("Unexpected keys in target bucket, %v", keys)
+	}
+}
+
+func TestCloneImageRollback(t *testing.T) {
+
+	ctx := context.Background()
+
+	policy := &failingWritePolicy{
+		WritePolicy: common.NewDefaultWritePolicy(),
+		suffix:      ".geojson",
+	}
+
+	t.Run("new", func(t *testing.T) {
+
+		source := memblob.OpenBucket(nil)
+		defer source.Close()
+
+		target := memblob.OpenBucket(nil)
+		defer target.Close()
+
+		err := source.WriteAll(ctx, "a.jpg", testImage(t, 0), nil)
+
+		if err != nil {
+			t.Fatalf("Failed to write source image, %v", err)
+		}
+
+		opts := cloneOptions(source, target, "a.jpg", "test")
+		opts.WritePolicy = policy
+
+		_, err = CloneImage(ctx, opts)
+
+		if err == nil {
+			t.Fatalf("Expected committing feature to fail")
+		}
+
+		keys := listKeys(t, target)
+
+		if len(keys) != 0 {
+			t.Fatalf("Expected image to be rolled back, found %v", keys)
+		}
+	})
+
+	t.Run("existing", func(t *testing.T) {
+
+		source := memblob.OpenBucket(nil)
+		defer source.Close()
+
+		target := memblob.OpenBucket(nil)
+		defer target.Close()
+
+		old_body := testImage(t, 0)
+		new_body := testImage(t, 64)
+
+		err := source.WriteAll(ctx, "old.jpg", old_body, nil)
+
+		if err != nil {
+			t.Fatalf("Failed to write source image, %v", err)
+		}
+
+		err = source.WriteAll(ctx, "new.jpg", new_body, nil)
+
+		if err != nil {
+			t.Fatalf("Failed to write source image, %v", err)
+		}
+
+		_, err = CloneImage(ctx, cloneOptions(source, target, "old.jpg", "old"))
+
+		if err != nil {
+			t.Fatalf("Failed to clone image, %v", err)
+		}
+
+		old_feature := readKey(t, target, test_feature_path)
+
+		opts := cloneOptions(source, target, "new.jpg", "new")
+		opts.WritePolicy = policy
+
+		_, err = CloneImage(ctx, opts)
+
+		if err == nil {
+			t.Fatalf("Expected committing feature to fail")
+		}
+
+		if !bytes.Equal(readKey(t, target, test_image_path), old_body) {
+			t.Fatalf("Expected image to be rolled back to previous version")
+		}
+
+		if !bytes.Equal(readKey(t, target, test_feature_path), old_feature) {
+			t.Fatalf("Expected feature to be left unchanged")
+		}
+
+		keys := listKeys(t, target)
+		expected := []string{test_feature_path, test_image_path}
+
+		if !slices.Equal(keys, expected) {
+			t.Fatalf("Unexpected keys in target bucket, %v", keys)
+		}
+	})
+}
+
+func TestCloneImagesResume(t *testing.T) {
+
+	ctx := context.Background()
+
+	source := memblob.OpenBucket(nil)
+	defer source.Close()
+
+	target := memblob.OpenBucket(nil)
+	defer target.Close()
+
+	requests := []*CloneRequest{
+		{ID: test_id, ImageID: 1, Filename: "1.jpg"},
+		{ID: test_id, ImageID: 2, Filename: "2.jpg"},
+		{ID: test_id, ImageID: 3, Filename: "3.jpg"},
+	}
+
+	// The image for the first request is not in the source bucket so cloning it would fail
+
+	for _, req := range requests[1:] {
+
+		err := source.WriteAll(ctx, req.Filename, testImage(t, uint8(req.ImageID)), nil)
+
+		if err != nil {
+			t.Fatalf("Failed to write source image, %v", err)
+		}
+	}
+
+	resume := NewManifest()
+
+	resume.Add(&ManifestEntry{
+		Request: requests[0],
+		Target:  "1511951011_1.jpg",
+		Status:  MANIFEST_CLONED,
+	})
+
+	resume.Add(&ManifestEntry{
+		Request: requests[1],
+		Status:  MANIFEST_FAILED,
+		Error:   "Failed to clone image",
+	})
+
+	opts := &CloneImagesOptions{
+		Source: source,
+		Target: target,
+		Resume: resume,
+	}
+
+	iter := func(yield func(*CloneRequest, error) bool) {
+
+		for _, req := range requests {
+
+			if !yield(req, nil) {
+				return
+			}
+		}
+	}
+
+	manifest, err := CloneImages(ctx, opts, iter)
+
+	if err != nil {
+		t.Fatalf("Failed to clone images, %v", err)
+	}
+
+	for _, req := range requests {
+
+		e, ok := manifest.Entry(req)
+
+		if !ok {
+			t.Fatalf("Manifest is missing entry for %s", req.Filename)
+		}
+
+		if e.Status != MANIFEST_CLONED {
+			t.Fatalf("Unexpected status for %s, %s (%s)", req.Filename, e.Status, e.Error)
+		}
+	}
+
+	keys := listKeys(t, target)
+	expected := []string{"1511951011_2.jpg", "1511951011_3.jpg"}
+
+	if !slices.Equal(keys, expected) {
+		t.Fatalf("Unexpected keys in target bucket, %v", keys)
+	}
+}
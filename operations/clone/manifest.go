@@ -0,0 +1,219 @@
+package clone
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// type ManifestStatus is a string label describing the outcome of a clone request.
+type ManifestStatus string
+
+const (
+	// MANIFEST_CLONED indicates that an image (and its feature) was cloned.
+	MANIFEST_CLONED ManifestStatus = "cloned"
+	// MANIFEST_SKIPPED indicates that an image (and its feature) was not cloned because it already exists in the target location.
+	MANIFEST_SKIPPED ManifestStatus = "skipped"
+	// MANIFEST_FAILED indicates that an image (and its feature) could not be cloned.
+	MANIFEST_FAILED ManifestStatus = "failed"
+)
+
+// ManifestEntry is a struct recording the outcome of a single clone request.
+type ManifestEntry struct {
+	// The clone request. This is nil for clone requests that could not be parsed.
+	Request *CloneRequest `json:"request"`
+	// The (1-based) line number of a clone request that could not be parsed.
+	Line int `json:"line,omitempty"`
+	// The path of the cloned image in the target location.
+	Target string `json:"target,omitempty"`
+	// The SHA-1 fingerprint of the cloned image.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// The outcome of the clone request.
+	Status ManifestStatus `json:"status"`
+	// The error message for failed clone requests.
+	Error string `json:"error,omitempty"`
+}
+
+// Manifest is a struct recording the outcomes of a batch of clone requests.
+type Manifest struct {
+	entries map[string]*ManifestEntry
+	keys    []string
+	mu      *sync.RWMutex
+}
+
+// NewManifest returns a new empty Manifest instance.
+func NewManifest() *Manifest {
+
+	m := &Manifest{
+		entries: make(map[string]*ManifestEntry),
+		keys:    make([]string, 0),
+		mu:      new(sync.RWMutex),
+	}
+
+	return m
+}
+
+// ReadManifest returns a new Manifest instance derived from the JSON Lines encoded ManifestEntry records in 'r'. If there
+// are multiple entries for the same clone request the last one wins.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+
+	m := NewManifest()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lineno := 0
+
+	for scanner.Scan() {
+
+		lineno += 1
+
+		line := scanner.Bytes()
+
+		if len(line) == 0 {
+			continue
+		}
+
+		var e *ManifestEntry
+
+		err := json.Unmarshal(line, &e)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal manifest entry at line %d, %w", lineno, err)
+		}
+
+		if e.Request == nil && e.Line == 0 {
+			return nil, fmt.Errorf("Manifest entry at line %d is missing request", lineno)
+		}
+
+		m.Add(e)
+	}
+
+	err := scanner.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read manifest, %w", err)
+	}
+
+	return m, nil
+}
+
+// Add will add 'e' to the manifest, replacing any existing entry for the same clone request.
+func (m *Manifest) Add(e *ManifestEntry) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := e.key()
+
+	_, exists := m.entries[k]
+
+	if !exists {
+		m.keys = append(m.keys, k)
+	}
+
+	m.entries[k] = e
+}
+
+// Entry returns the ManifestEntry for 'req' and a boolean flag indicating whether it exists.
+func (m *Manifest) Entry(req *CloneRequest) (*ManifestEntry, bool) {
+
+	if req == nil {
+		return nil, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.entries[req.key()]
+	return e, ok
+}
+
+// Completed returns a boolean flag indicating whether 'req' has already been cloned (or skipped).
+func (m *Manifest) Completed(req *CloneRequest) bool {
+
+	e, ok := m.Entry(req)
+
+	if !ok {
+		return false
+	}
+
+	return e.Status == MANIFEST_CLONED || e.Status == MANIFEST_SKIPPED
+}
+
+// Entries returns the list of entries in the manifest, in the order they were first added.
+func (m *Manifest) Entries() []*ManifestEntry {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]*ManifestEntry, len(m.keys))
+
+	for idx, k := range m.keys {
+		entries[idx] = m.entries[k]
+	}
+
+	return entries
+}
+
+// Count returns the number of entries in the manifest with status 's'.
+func (m *Manifest) Count(s ManifestStatus) int {
+
+	count := 0
+
+	for _, e := range m.Entries() {
+
+		if e.Status == s {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+// Write will write each entry in the manifest to 'wr' as JSON Lines.
+func (m *Manifest) Write(wr io.Writer) error {
+
+	for _, e := range m.Entries() {
+
+		err := writeManifestEntry(wr, e)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// key returns a unique key for the entry used to identify it in a Manifest. Entries for clone requests that could not be
+// parsed are keyed by their line number.
+func (e *ManifestEntry) key() string {
+
+	if e.Request == nil {
+		return fmt.Sprintf("line#%d", e.Line)
+	}
+
+	return e.Request.key()
+}
+
+func writeManifestEntry(wr io.Writer, e *ManifestEntry) error {
+
+	enc, err := json.Marshal(e)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal manifest entry, %w", err)
+	}
+
+	enc = append(enc, '\n')
+
+	_, err = wr.Write(enc)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write manifest entry, %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package clone
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+// DEFAULT_IMAGE_TEMPLATE is the default naming template for images with a (FileMaker) image ID.
+const DEFAULT_IMAGE_TEMPLATE string = "{id}_{image_id}{ext}"
+
+// DEFAULT_FILENAME_IMAGE_TEMPLATE is the default naming template for images without an image ID (ImageID is -1).
+const DEFAULT_FILENAME_IMAGE_TEMPLATE string = "{id}_{filename}"
+
+// DEFAULT_FEATURE_TEMPLATE is the default naming template for features.
+const DEFAULT_FEATURE_TEMPLATE string = "{id}.geojson"
+
+// NamingTemplate is a struct for deriving target paths from templates containing "{placeholder}" strings. Valid placeholders are:
+// * {id} – The WOF ID of the image.
+// * {image_id} – The (FileMaker) image ID of the image.
+// * {filename} – The image's filename. If the image's format was changed by a transformation the filename's extension is updated to match.
+// * {basename} – The image's filename without its extension.
+// * {ext} – The image's extension, including the leading ".".
+// * {fingerprint} – The SHA-1 fingerprint of the image written to the target location.
+// * {id_path} – The nested WOF path for the WOF ID (for example "101/736/545") as derived by whosonfirst/go-whosonfirst-uri.Id2Path.
+type NamingTemplate struct {
+	template string
+}
+
+// NamingValues is a struct containing the values used to replace placeholders in a NamingTemplate.
+type NamingValues struct {
+	// WOF (or sfomuseum-data-media-* ) ID
+	ID int64
+	// Source FileMaker image ID
+	ImageID int64
+	// The image's filename
+	Filename string
+	// The SHA-1 fingerprint of the image
+	Fingerprint string
+}
+
+// NewNamingTemplate returns a new NamingTemplate instance for 't', returning an error if 't' is empty, contains unbalanced
+// braces or unknown placeholders.
+func NewNamingTemplate(t string) (*NamingTemplate, error) {
+
+	if t == "" {
+		return nil, fmt.Errorf("Naming template is empty")
+	}
+
+	remaining := t
+
+	for {
+
+		start := strings.Index(remaining, "{")
+		end := strings.Index(remaining, "}")
+
+		if start == -1 && end == -1 {
+			break
+		}
+
+		if start == -1 || end == -1 || end < start {
+			return nil, fmt.Errorf("Naming template '%s' has unbalanced braces", t)
+		}
+
+		name := remaining[start+1 : end]
+
+		switch name {
+		case "id", "image_id", "filename", "basename", "ext", "fingerprint", "id_path":
+			// pass
+		default:
+			return nil, fmt.Errorf("Naming template '%s' has unknown placeholder '{%s}'", t, name)
+		}
+
+		remaining = remaining[end+1:]
+	}
+
+	nt := &NamingTemplate{
+		template: t,
+	}
+
+	return nt, nil
+}
+
+// Render returns the path derived by replacing the placeholders in 'nt' with 'v'. An error is returned if the resulting
+// path is empty, absolute or refers to a parent directory.
+func (nt *NamingTemplate) Render(v *NamingValues) (string, error) {
+
+	fname := v.Filename
+	ext := filepath.Ext(fname)
+
+	replacements := []string{
+		"{id}", strconv.FormatInt(v.ID, 10),
+		"{image_id}", strconv.FormatInt(v.ImageID, 10),
+		"{filename}", fname,
+		"{basename}", strings.TrimSuffix(fname, ext),
+		"{ext}", ext,
+		"{fingerprint}", v.Fingerprint,
+	}
+
+	if strings.Contains(nt.template, "{id_path}") {
+
+		id_path, err := uri.Id2Path(v.ID)
+
+		if err != nil {
+			return "", fmt.Errorf("Failed to derive path for %d, %w", v.ID, err)
+		}
+
+		replacements = append(replacements, "{id_path}", id_path)
+	}
+
+	p := strings.NewReplacer(replacements...).Replace(nt.template)
+
+	if p == "" || path.IsAbs(p) {
+		return "", fmt.Errorf("Naming template '%s' produced invalid path '%s'", nt.template, p)
+	}
+
+	p = path.Clean(p)
+
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("Naming template '%s' produced invalid path '%s'", nt.template, p)
+	}
+
+	return p, nil
+}
+
+// String returns the template string for 'nt'.
+func (nt *NamingTemplate) String() string {
+	return nt.template
+}
+
+// renderTemplate parses 't' as a NamingTemplate and renders it with 'v'.
+func renderTemplate(t string, v *NamingValues) (string, error) {
+
+	nt, err := NewNamingTemplate(t)
+
+	if err != nil {
+		return "", err
+	}
+
+	return nt.Render(v)
+}
@@ -0,0 +1,38 @@
+package clone
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sfomuseum/go-whosonfirst-media/transform"
+	"gocloud.dev/blob"
+)
+
+// transformImage will decode the image at 'path' in 'bucket' and apply 'transformations' to it. It returns the transformed
+// image and the format of the source image.
+func transformImage(ctx context.Context, bucket *blob.Bucket, path string, transformations ...transform.Transformation) (*transform.Image, string, error) {
+
+	r, err := bucket.NewReader(ctx, path, nil)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to create reader for %s, %w", path, err)
+	}
+
+	defer r.Close()
+
+	im, err := transform.Decode(r)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to decode %s, %w", path, err)
+	}
+
+	source_format := im.Format
+
+	im, err = transform.Apply(ctx, im, transformations...)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return im, source_format, nil
+}
@@ -0,0 +1,117 @@
+package clone
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log/slog"
+	"strings"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"gocloud.dev/blob"
+)
+
+// digest is a struct containing the SHA-1 and MD5 hashes, and the size, of an object's body. It implements the io.Writer
+// interface so that hashes can be computed as the body is read (or encoded).
+type digest struct {
+	sha1 hash.Hash
+	md5  hash.Hash
+	size int64
+}
+
+// newDigest returns a new, empty, digest instance.
+func newDigest() *digest {
+
+	d := &digest{
+		sha1: sha1.New(),
+		md5:  md5.New(),
+	}
+
+	return d
+}
+
+// digestBytes returns a new digest instance for 'body'.
+func digestBytes(body []byte) *digest {
+	d := newDigest()
+	d.Write(body)
+	return d
+}
+
+// Write updates the hashes and size of the digest with 'p'.
+func (d *digest) Write(p []byte) (int, error) {
+	d.sha1.Write(p)
+	d.md5.Write(p)
+	d.size += int64(len(p))
+	return len(p), nil
+}
+
+// Fingerprint returns the hex-encoded SHA-1 hash of the digest. This is the same value as common.FingerprintFile.
+func (d *digest) Fingerprint() string {
+	return hex.EncodeToString(d.sha1.Sum(nil))
+}
+
+// MD5 returns the MD5 hash of the digest.
+func (d *digest) MD5() []byte {
+	return d.md5.Sum(nil)
+}
+
+// Size returns the number of bytes written to the digest.
+func (d *digest) Size() int64 {
+	return d.size
+}
+
+// readObject returns the body of the object stored at 'key' in 'bucket'.
+func readObject(ctx context.Context, bucket *blob.Bucket, key string) ([]byte, error) {
+
+	body, err := bucket.ReadAll(ctx, key)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s, %w", key, err)
+	}
+
+	return body, nil
+}
+
+// verifyObject returns a boolean value indicating whether the object stored at 'key' in 'bucket' matches 'd'. Objects whose
+// size differs from 'd' (for example truncated uploads) never match. Otherwise the MD5 hash stored by the bucket is compared
+// if the driver exposes one, followed by the object's ETag if it looks like an MD5 hash. If neither is conclusive then the
+// object is re-read and its SHA-1 fingerprint is compared.
+func verifyObject(ctx context.Context, bucket *blob.Bucket, key string, d *digest) (bool, error) {
+
+	attrs, err := bucket.Attributes(ctx, key)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to retrieve attributes for %s, %w", key, err)
+	}
+
+	if attrs.Size != d.Size() {
+		slog.Debug("Object size does not match", "key", key, "expected", d.Size(), "size", attrs.Size)
+		return false, nil
+	}
+
+	if len(attrs.MD5) > 0 {
+		return bytes.Equal(attrs.MD5, d.MD5()), nil
+	}
+
+	// Not all ETags are MD5 hashes (multipart uploads, server-side encryption) so a
+	// mismatch here falls through to re-reading the object rather than failing
+
+	etag := strings.TrimPrefix(attrs.ETag, "W/")
+	etag = strings.Trim(etag, `"`)
+
+	if strings.EqualFold(etag, hex.EncodeToString(d.MD5())) {
+		return true, nil
+	}
+
+	fp, err := common.FingerprintFile(ctx, bucket, key)
+
+	if err != nil {
+		return false, err
+	}
+
+	return fp == d.Fingerprint(), nil
+}
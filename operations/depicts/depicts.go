@@ -0,0 +1,310 @@
+// package depicts provides common methods for updating the features depicted by media files to reference them.
+package depicts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/sfomuseum/go-whosonfirst-media/operations/process"
+	"github.com/sfomuseum/go-whosonfirst-media/status"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"github.com/whosonfirst/go-ioutil"
+	"github.com/whosonfirst/go-reader/v2"
+	"github.com/whosonfirst/go-whosonfirst-export/v3"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+// DEFAULT_PRIMARY_PROPERTY is the default property, in a depicted feature, assigned the WOF ID of its primary media file.
+const DEFAULT_PRIMARY_PROPERTY string = "sfomuseum:primary_image"
+
+// DEFAULT_MEDIA_PROPERTY is the default property, in a depicted feature, containing the list of WOF IDs of all the media
+// files that depict it.
+const DEFAULT_MEDIA_PROPERTY string = "wof:media"
+
+// DEFAULT_EXPLICIT_PROPERTY is the default property, in a media feature, used to mark it as the primary media file for the
+// features it depicts when PRIMARY_EXPLICIT is used.
+const DEFAULT_EXPLICIT_PROPERTY string = "media:is_primary"
+
+// type PrimaryPolicy is a string label describing how the primary media file of a depicted feature is chosen.
+type PrimaryPolicy string
+
+const (
+	// PRIMARY_NEWEST makes the most recently processed media file the primary media file.
+	PRIMARY_NEWEST PrimaryPolicy = "newest"
+	// PRIMARY_FIRST makes the first media file processed the primary media file. It is not replaced by later media files.
+	PRIMARY_FIRST PrimaryPolicy = "first"
+	// PRIMARY_EXPLICIT only makes a media file the primary media file if its ExplicitProperty is set to 1.
+	PRIMARY_EXPLICIT PrimaryPolicy = "explicit"
+)
+
+// ParsePrimaryPolicy returns the PrimaryPolicy matching 'name', returning an error if it is not a known policy.
+func ParsePrimaryPolicy(name string) (PrimaryPolicy, error) {
+
+	policy := PrimaryPolicy(name)
+
+	switch policy {
+	case PRIMARY_NEWEST, PRIMARY_FIRST, PRIMARY_EXPLICIT:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Invalid primary policy '%s'", name)
+	}
+}
+
+// type Updater provides a struct for updating the features depicted by media files.
+type Updater struct {
+	// A whosonfirst/go-reader Reader for reading depicted features.
+	Reader reader.Reader
+	// A whosonfirst/go-writer Writer for writing depicted features.
+	Writer writer.Writer
+	// A whosonfirst/go-whosonfirst-export Exporter for exporting depicted features.
+	Exporter export.Exporter
+	// The policy for choosing the primary media file of a depicted feature. If empty then PRIMARY_NEWEST is used.
+	Policy PrimaryPolicy
+	// The property assigned the WOF ID of the primary media file. If empty then DEFAULT_PRIMARY_PROPERTY is used.
+	PrimaryProperty string
+	// The property containing the WOF IDs of all the media files that depict a feature. If empty then
+	// DEFAULT_MEDIA_PROPERTY is used.
+	MediaProperty string
+	// The property, in a media feature, used to mark it as the primary media file when Policy is PRIMARY_EXPLICIT. If
+	// empty then DEFAULT_EXPLICIT_PROPERTY is used.
+	ExplicitProperty string
+	// A boolean flag indicating whether to perform an update in "dry run" mode.
+	Dryrun bool
+	// Per-feature locks, keyed by depicted feature ID, ensuring that concurrent updates to the same feature are serialized
+	locks    map[int64]*sync.Mutex
+	locks_mu sync.Mutex
+}
+
+// NewUpdater returns a new Updater instance using PRIMARY_NEWEST and the default properties.
+func NewUpdater(r reader.Reader, wr writer.Writer, ex export.Exporter) (*Updater, error) {
+
+	u := &Updater{
+		Reader:           r,
+		Writer:           wr,
+		Exporter:         ex,
+		Policy:           PRIMARY_NEWEST,
+		PrimaryProperty:  DEFAULT_PRIMARY_PROPERTY,
+		MediaProperty:    DEFAULT_MEDIA_PROPERTY,
+		ExplicitProperty: DEFAULT_EXPLICIT_PROPERTY,
+	}
+
+	return u, nil
+}
+
+// Hook returns a process.Hook, named 'name', that updates the features depicted by each media feature that is written.
+func (u *Updater) Hook(name string) *process.Hook {
+
+	fn := func(ctx context.Context, hc *process.HookContext, depicts_id int64) error {
+		return u.UpdateDepicted(ctx, depicts_id, hc.NewFeature)
+	}
+
+	return process.NewDepictsHook(name, fn)
+}
+
+// Update will update each of the features in the wof:depicts property of the media feature 'media_feature'.
+func (u *Updater) Update(ctx context.Context, media_feature []byte) error {
+
+	for _, r := range gjson.GetBytes(media_feature, "properties.wof:depicts").Array() {
+
+		depicts_id := r.Int()
+
+		if depicts_id <= 0 {
+			continue
+		}
+
+		err := u.UpdateDepicted(ctx, depicts_id, media_feature)
+
+		if err != nil {
+			return fmt.Errorf("Failed to update depicted feature %d, %w", depicts_id, err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateDepicted will update the feature 'depicts_id' to reference the media feature 'media_feature', adding it to the
+// list of media files that depict the feature and, depending on u.Policy, making it the primary media file. Nothing is
+// written if the depicted feature is unchanged or if 'media_feature' is not PUBLISHED.
+func (u *Updater) UpdateDepicted(ctx context.Context, depicts_id int64, media_feature []byte) error {
+
+	media_id := gjson.GetBytes(media_feature, "properties.wof:id").Int()
+
+	if media_id <= 0 {
+		return fmt.Errorf("Media feature is missing properties.wof:id")
+	}
+
+	current, err := status.Current(media_feature)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive status for media feature %d, %w", media_id, err)
+	}
+
+	if current != status.PUBLISHED {
+		slog.Debug("Media feature is not published, skipping", "depicts", depicts_id, "media", media_id, "status", current.String())
+		return nil
+	}
+
+	mu := u.lock(depicts_id)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	rel_path, err := uri.Id2RelPath(depicts_id)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive rel path for %d, %w", depicts_id, err)
+	}
+
+	r, err := u.Reader.Read(ctx, rel_path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read %s, %w", rel_path, err)
+	}
+
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read body for %s, %w", rel_path, err)
+	}
+
+	primary_prop := fmt.Sprintf("properties.%s", valueOrDefault(u.PrimaryProperty, DEFAULT_PRIMARY_PROPERTY))
+	media_prop := fmt.Sprintf("properties.%s", valueOrDefault(u.MediaProperty, DEFAULT_MEDIA_PROPERTY))
+
+	new_body := body
+
+	media_ids := make([]int64, 0)
+	has_media := false
+
+	for _, r := range gjson.GetBytes(body, media_prop).Array() {
+
+		id := r.Int()
+
+		if id == media_id {
+			has_media = true
+		}
+
+		media_ids = append(media_ids, id)
+	}
+
+	if !has_media {
+
+		media_ids = append(media_ids, media_id)
+
+		new_body, err = sjson.SetBytes(new_body, media_prop, media_ids)
+
+		if err != nil {
+			return fmt.Errorf("Failed to assign %s property, %w", media_prop, err)
+		}
+	}
+
+	is_primary, err := u.isPrimary(body, primary_prop, media_feature)
+
+	if err != nil {
+		return err
+	}
+
+	if is_primary && gjson.GetBytes(body, primary_prop).Int() != media_id {
+
+		new_body, err = sjson.SetBytes(new_body, primary_prop, media_id)
+
+		if err != nil {
+			return fmt.Errorf("Failed to assign %s property, %w", primary_prop, err)
+		}
+	}
+
+	logger := slog.Default()
+	logger = logger.With("depicts", depicts_id)
+	logger = logger.With("media", media_id)
+
+	if bytes.Equal(new_body, body) {
+		logger.Debug("Depicted feature is unchanged")
+		return nil
+	}
+
+	_, new_body, err = u.Exporter.Export(ctx, new_body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to export %s, %w", rel_path, err)
+	}
+
+	if u.Dryrun {
+		logger.Info("DRYRUN update depicted feature", "path", rel_path, "primary", is_primary)
+		return nil
+	}
+
+	out, err := ioutil.NewReadSeekCloser(bytes.NewReader(new_body))
+
+	if err != nil {
+		return fmt.Errorf("Failed to create ReadSeekCloser, %w", err)
+	}
+
+	_, err = u.Writer.Write(ctx, rel_path, out)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write %s, %w", rel_path, err)
+	}
+
+	logger.Info("Updated depicted feature", "path", rel_path, "primary", is_primary)
+	return nil
+}
+
+// lock returns the sync.Mutex used to serialize updates to the depicted feature 'depicts_id'.
+func (u *Updater) lock(depicts_id int64) *sync.Mutex {
+
+	u.locks_mu.Lock()
+	defer u.locks_mu.Unlock()
+
+	if u.locks == nil {
+		u.locks = make(map[int64]*sync.Mutex)
+	}
+
+	mu, exists := u.locks[depicts_id]
+
+	if !exists {
+		mu = new(sync.Mutex)
+		u.locks[depicts_id] = mu
+	}
+
+	return mu
+}
+
+// isPrimary returns a boolean value indicating whether 'media_feature' should be the primary media file for the depicted
+// feature 'body', according to u.Policy.
+func (u *Updater) isPrimary(body []byte, primary_prop string, media_feature []byte) (bool, error) {
+
+	policy := u.Policy
+
+	if policy == "" {
+		policy = PRIMARY_NEWEST
+	}
+
+	switch policy {
+	case PRIMARY_NEWEST:
+		return true, nil
+	case PRIMARY_FIRST:
+		return gjson.GetBytes(body, primary_prop).Int() <= 0, nil
+	case PRIMARY_EXPLICIT:
+		explicit_prop := fmt.Sprintf("properties.%s", valueOrDefault(u.ExplicitProperty, DEFAULT_EXPLICIT_PROPERTY))
+		return gjson.GetBytes(media_feature, explicit_prop).Int() == 1, nil
+	default:
+		return false, fmt.Errorf("Invalid primary policy '%s'", policy)
+	}
+}
+
+// valueOrDefault returns 'value' or, if it is empty, 'default_value'.
+func valueOrDefault(value string, default_value string) string {
+
+	if value == "" {
+		return default_value
+	}
+
+	return value
+}
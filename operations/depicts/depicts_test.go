@@ -0,0 +1,93 @@
+package depicts
+
+import (
+	"testing"
+)
+
+func TestIsPrimary(t *testing.T) {
+
+	primary_prop := "properties." + DEFAULT_PRIMARY_PROPERTY
+
+	without_primary := []byte(`{"properties": {"wof:id": 102527513}}`)
+	with_primary := []byte(`{"properties": {"wof:id": 102527513, "sfomuseum:primary_image": 1511951011}}`)
+
+	media := []byte(`{"properties": {"wof:id": 1511951013}}`)
+	explicit_media := []byte(`{"properties": {"wof:id": 1511951013, "media:is_primary": 1}}`)
+	custom_media := []byte(`{"properties": {"wof:id": 1511951013, "sfomuseum:is_primary": 1}}`)
+
+	tests := []struct {
+		Name             string
+		Policy           PrimaryPolicy
+		ExplicitProperty string
+		Depicted         []byte
+		Media            []byte
+		Expected         bool
+	}{
+		{"default without primary", "", "", without_primary, media, true},
+		{"default with primary", "", "", with_primary, media, true},
+		{"newest without primary", PRIMARY_NEWEST, "", without_primary, media, true},
+		{"newest with primary", PRIMARY_NEWEST, "", with_primary, media, true},
+		{"first without primary", PRIMARY_FIRST, "", without_primary, media, true},
+		{"first with primary", PRIMARY_FIRST, "", with_primary, media, false},
+		{"explicit unmarked", PRIMARY_EXPLICIT, "", without_primary, media, false},
+		{"explicit marked", PRIMARY_EXPLICIT, "", with_primary, explicit_media, true},
+		{"explicit custom property unmarked", PRIMARY_EXPLICIT, "sfomuseum:is_primary", without_primary, explicit_media, false},
+		{"explicit custom property marked", PRIMARY_EXPLICIT, "sfomuseum:is_primary", with_primary, custom_media, true},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			u := &Updater{
+				Policy:           test.Policy,
+				ExplicitProperty: test.ExplicitProperty,
+			}
+
+			is_primary, err := u.isPrimary(test.Depicted, primary_prop, test.Media)
+
+			if err != nil {
+				t.Fatalf("Failed to determine primary media file, %v", err)
+			}
+
+			if is_primary != test.Expected {
+				t.Fatalf("Expected is primary to be %t", test.Expected)
+			}
+		})
+	}
+
+	u := &Updater{
+		Policy: PrimaryPolicy("oldest"),
+	}
+
+	_, err := u.isPrimary(without_primary, primary_prop, media)
+
+	if err == nil {
+		t.Fatalf("Expected invalid policy to fail")
+	}
+}
+
+func TestParsePrimaryPolicy(t *testing.T) {
+
+	for _, policy := range []PrimaryPolicy{PRIMARY_NEWEST, PRIMARY_FIRST, PRIMARY_EXPLICIT} {
+
+		parsed, err := ParsePrimaryPolicy(string(policy))
+
+		if err != nil {
+			t.Fatalf("Failed to parse %s, %v", policy, err)
+		}
+
+		if parsed != policy {
+			t.Fatalf("Expected %s, got %s", policy, parsed)
+		}
+	}
+
+	for _, name := range []string{"", "oldest", "Newest"} {
+
+		_, err := ParsePrimaryPolicy(name)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to be rejected", name)
+		}
+	}
+}
@@ -6,13 +6,12 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"mime"
 	"path/filepath"
-	"strings"
 	"sync"
 
 	"github.com/sfomuseum/go-text-emboss/v2"
 	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
 	"gocloud.dev/blob"
 )
 
@@ -28,6 +27,8 @@ type GatherImagesResponse struct {
 	ImageHashes []*common.ImageHashRsp
 	// Text extracted from the image using the `sfomuseum/go-text-emboss` package.
 	ImageText []byte
+	// The colour palette for the image file being gathered
+	Palette []properties.Colour
 }
 
 // type GatherImageCallbackFunc provides a function signature for custom callbacks applied to gathered images.
@@ -42,6 +43,8 @@ type GatherImagesOptions struct {
 	EmbossImages bool
 	// A valid sfomuseum/go-text-emboss.Embosser instance used to extract text from gathered images
 	Embosser emboss.Embosser
+	// Optional configuration for extracting the colour palette of gathered images. If nil then palettes are not extracted.
+	PaletteOptions *common.PaletteOptions
 }
 
 // GatherImages will gather images from bucket enabling image hashing by default.
@@ -191,13 +194,9 @@ func GatherImageResponseWithPath(ctx context.Context, opts *GatherImagesOptions,
 
 	ext := filepath.Ext(path)
 
-	t := mime.TypeByExtension(ext)
+	t, ok := properties.MimetypeForExtension(ext)
 
-	if t == "" {
-		return nil, nil
-	}
-
-	if !strings.HasPrefix(t, "image/") {
+	if !ok {
 		return nil, nil
 	}
 
@@ -231,5 +230,16 @@ func GatherImageResponseWithPath(ctx context.Context, opts *GatherImagesOptions,
 		rsp.ImageText = im_text
 	}
 
+	if opts.PaletteOptions != nil {
+
+		palette, err := common.PaletteFile(ctx, opts.Bucket, path, opts.PaletteOptions)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to extract palette for %s, %w", path, err)
+		}
+
+		rsp.Palette = palette
+	}
+
 	return rsp, nil
 }
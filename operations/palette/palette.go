@@ -0,0 +1,232 @@
+// package palette provides common methods for deriving the colour palettes of media files that have already been processed.
+package palette
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/filename"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"github.com/whosonfirst/go-ioutil"
+	"github.com/whosonfirst/go-whosonfirst-export/v3"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"gocloud.dev/blob"
+)
+
+// DEFAULT_LABEL is the default size label of the derivative used to derive a colour palette.
+const DEFAULT_LABEL string = "b"
+
+// type Backfill provides a struct for assigning colour palettes to media features that lack them.
+type Backfill struct {
+	// DataSource is a valid gocloud.dev/blob Bucket URI where WOF feature records associated with media files are stored.
+	// If it contains the string "%s" it will be replaced by the repo of each request.
+	DataSource string
+	// MediaSource is a valid gocloud.dev/blob Bucket URI where media files are stored.
+	MediaSource string
+	// A valid whosonfirst/go-whosonfirst-export Exporter for exporting Who's On First feature records.
+	Exporter export.Exporter
+	// Configuration for extracting colour palettes. If nil then common.NewPaletteOptions is used.
+	PaletteOptions *common.PaletteOptions
+	// The size label of the derivative used to derive a colour palette. If "" then DEFAULT_LABEL is used. If a feature does
+	// not have a derivative with this label then the original (filename.ORIGINAL_LABEL) derivative is used.
+	Label string
+	// A boolean flag indicating whether to replace colour palettes that are already present.
+	Force bool
+	// A boolean flag indicating whether to perform a backfill in "dry run" mode.
+	Dryrun bool
+}
+
+// type BackfillRequest provides a struct encapsulating data for assigning the colour palette of a given media file.
+type BackfillRequest struct {
+	// A valid Who's On First ID.
+	Id int64 `json:"id"`
+	// The data repository where Id is stored.
+	Repo string `json:"repo"`
+}
+
+// NewBackfill returns a new Backfill instance.
+func NewBackfill(ex export.Exporter) (*Backfill, error) {
+
+	b := &Backfill{
+		Exporter:       ex,
+		PaletteOptions: common.NewPaletteOptions(),
+		Label:          DEFAULT_LABEL,
+	}
+
+	return b, nil
+}
+
+// Backfill will assign colour palettes to the media features defined in 'requests' that lack them.
+func (b *Backfill) Backfill(ctx context.Context, requests ...*BackfillRequest) error {
+
+	bucket, err := blob.OpenBucket(ctx, b.MediaSource)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open media bucket, %w", err)
+	}
+
+	defer bucket.Close()
+
+	for _, req := range requests {
+
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+			// pass
+		}
+
+		err := b.backfill(ctx, bucket, req)
+
+		if err != nil {
+			return fmt.Errorf("Failed to backfill palette for %d, %w", req.Id, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *Backfill) backfill(ctx context.Context, bucket *blob.Bucket, req *BackfillRequest) error {
+
+	logger := slog.Default()
+	logger = logger.With("id", req.Id)
+
+	rel_path, err := uri.Id2RelPath(req.Id)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive rel path, %w", err)
+	}
+
+	data_source := b.DataSource
+
+	if strings.Contains(data_source, "%s") {
+		data_source = fmt.Sprintf(data_source, req.Repo)
+	}
+
+	rdr, err := common.NewReader(ctx, data_source)
+
+	if err != nil {
+		return err
+	}
+
+	wr, err := common.NewWriter(ctx, data_source)
+
+	if err != nil {
+		return err
+	}
+
+	fh, err := rdr.Read(ctx, rel_path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read %s, %w", rel_path, err)
+	}
+
+	defer fh.Close()
+
+	body, err := io.ReadAll(fh)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read body for %s, %w", rel_path, err)
+	}
+
+	mp, err := properties.Unmarshal(body)
+
+	if err != nil {
+		return err
+	}
+
+	if len(mp.Details.Colours) > 0 && !b.Force {
+		logger.Debug("Feature already has a colour palette, skipping")
+		return nil
+	}
+
+	label := b.Label
+
+	if label == "" {
+		label = DEFAULT_LABEL
+	}
+
+	sz, ok := mp.Details.Sizes[label]
+
+	if !ok {
+
+		o_sz, o_ok := mp.Details.Sizes[filename.ORIGINAL_LABEL]
+
+		if !o_ok {
+			return fmt.Errorf("Feature has no '%s' or '%s' derivative", label, filename.ORIGINAL_LABEL)
+		}
+
+		label = filename.ORIGINAL_LABEL
+		sz = o_sz
+	}
+
+	root, err := uri.Id2Path(req.Id)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive path, %w", err)
+	}
+
+	fname, err := filename.NewFilename(req.Id, sz.Secret, label, sz.Extension)
+
+	if err != nil {
+		return fmt.Errorf("Invalid filename for %s derivative, %w", label, err)
+	}
+
+	im_path := filepath.Join(root, fname.String())
+
+	palette_opts := b.PaletteOptions
+
+	if palette_opts == nil {
+		palette_opts = common.NewPaletteOptions()
+	}
+
+	palette, err := common.PaletteFile(ctx, bucket, im_path, palette_opts)
+
+	if err != nil {
+		return err
+	}
+
+	mp.Details.Colours = palette
+
+	body, err = mp.Marshal(body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to assign media properties, %w", err)
+	}
+
+	_, body, err = b.Exporter.Export(ctx, body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to export feature, %w", err)
+	}
+
+	if b.Dryrun {
+		logger.Info("DRYRUN assign palette", "path", im_path, "colours", len(palette))
+		return nil
+	}
+
+	out, err := ioutil.NewReadSeekCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = wr.Write(ctx, rel_path, out)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write %s, %w", rel_path, err)
+	}
+
+	logger.Info("Assigned palette", "path", im_path, "colours", len(palette))
+	return nil
+}
@@ -0,0 +1,144 @@
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/tidwall/gjson"
+)
+
+// FeatureDiff is a struct describing the changes that processing a report would make to a feature. It is produced when
+// a ReportProcessor is run in "dry run" mode.
+type FeatureDiff struct {
+	// The URI of the report that was processed.
+	Report string `json:"report"`
+	// The WOF ID of the feature.
+	ID int64 `json:"id"`
+	// The relative path of the feature that would have been written.
+	Path string `json:"path"`
+	// The whosonfirst/go-writer URI the feature would have been written to.
+	WriterURI string `json:"writer_uri"`
+	// The properties that would be changed, keyed by property name.
+	Changes map[string]*PropertyChange `json:"changes"`
+}
+
+// PropertyChange is a struct containing the old and new values of a property. Old is empty if the property is being
+// added and New is empty if it is being removed.
+type PropertyChange struct {
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// DiffProperties returns the properties that differ between the 'old_feature' and 'new_feature', keyed by property name.
+func DiffProperties(old_feature []byte, new_feature []byte) (map[string]*PropertyChange, error) {
+
+	old_props, err := featureProperties(old_feature)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive properties for old feature, %w", err)
+	}
+
+	new_props, err := featureProperties(new_feature)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive properties for new feature, %w", err)
+	}
+
+	keys := make(map[string]bool)
+
+	for k := range old_props {
+		keys[k] = true
+	}
+
+	for k := range new_props {
+		keys[k] = true
+	}
+
+	changes := make(map[string]*PropertyChange)
+
+	for k := range keys {
+
+		old_v, old_ok := old_props[k]
+		new_v, new_ok := new_props[k]
+
+		if old_ok && new_ok && bytes.Equal(old_v, new_v) {
+			continue
+		}
+
+		changes[k] = &PropertyChange{
+			Old: old_v,
+			New: new_v,
+		}
+	}
+
+	return changes, nil
+}
+
+// featureProperties returns the (compacted) JSON encoded values of the properties in 'body', keyed by property name.
+func featureProperties(body []byte) (map[string]json.RawMessage, error) {
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if !props_rsp.Exists() {
+		return nil, fmt.Errorf("Missing properties")
+	}
+
+	var props map[string]json.RawMessage
+
+	err := json.Unmarshal([]byte(props_rsp.Raw), &props)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal properties, %w", err)
+	}
+
+	for k, v := range props {
+
+		var buf bytes.Buffer
+
+		err := json.Compact(&buf, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compact %s property, %w", k, err)
+		}
+
+		props[k] = buf.Bytes()
+	}
+
+	return props, nil
+}
+
+// writeFeatureDiff writes 'diff' to 'wr' as a single line of JSON.
+func writeFeatureDiff(wr io.Writer, diff *FeatureDiff) error {
+
+	enc, err := json.Marshal(diff)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal feature diff, %w", err)
+	}
+
+	enc = append(enc, '\n')
+
+	_, err = wr.Write(enc)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write feature diff, %w", err)
+	}
+
+	return nil
+}
+
+// changedProperties returns the sorted list of property names in 'changes'.
+func changedProperties(changes map[string]*PropertyChange) []string {
+
+	names := make([]string, 0)
+
+	for k := range changes {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return names
+}
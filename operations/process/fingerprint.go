@@ -0,0 +1,90 @@
+package process
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+)
+
+// type FingerprintPolicy is a string label describing what a ReportProcessor should do when the origin fingerprint in a
+// report does not match the media:fingerprint property recorded when the image was gathered.
+type FingerprintPolicy string
+
+const (
+	// FINGERPRINT_ERROR signals that a report whose origin fingerprint does not match should not be processed.
+	FINGERPRINT_ERROR FingerprintPolicy = "error"
+	// FINGERPRINT_WARN signals that a mismatched origin fingerprint should be logged as a warning and then accepted.
+	// The earlier fingerprint is recorded in the media:fingerprint_history property. This is the default policy.
+	FINGERPRINT_WARN FingerprintPolicy = "warn"
+	// FINGERPRINT_ACCEPT signals that a mismatched origin fingerprint should be accepted without a warning. The earlier
+	// fingerprint is recorded in the media:fingerprint_history property.
+	FINGERPRINT_ACCEPT FingerprintPolicy = "accept"
+)
+
+// ParseFingerprintPolicy returns the FingerprintPolicy matching 'name', returning an error if it is not a known policy.
+func ParseFingerprintPolicy(name string) (FingerprintPolicy, error) {
+
+	policy := FingerprintPolicy(name)
+
+	switch policy {
+	case FINGERPRINT_ERROR, FINGERPRINT_WARN, FINGERPRINT_ACCEPT:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Invalid fingerprint policy '%s'", name)
+	}
+}
+
+// FingerprintMismatchError is an error returned when the origin fingerprint in a report does not match the
+// media:fingerprint property of the feature it is being applied to and the FINGERPRINT_ERROR policy is in effect.
+type FingerprintMismatchError struct {
+	// The WOF ID of the feature.
+	ID int64
+	// The media:fingerprint property of the feature.
+	Fingerprint string
+	// The origin fingerprint in the report.
+	OriginFingerprint string
+}
+
+// Error returns a string representation of the error.
+func (e *FingerprintMismatchError) Error() string {
+	return fmt.Sprintf("Report origin fingerprint '%s' does not match fingerprint '%s' for %d", e.OriginFingerprint, e.Fingerprint, e.ID)
+}
+
+// applyOriginFingerprint compares the origin fingerprint in 'report' to the fingerprint in 'mp' and, depending on 'policy',
+// either returns a FingerprintMismatchError or assigns the origin fingerprint to 'mp' recording the earlier value in its
+// fingerprint history. If the report does not have an origin fingerprint then 'mp' is left unchanged.
+func applyOriginFingerprint(id int64, mp *properties.MediaProperties, report *IIIFProcessReport, policy FingerprintPolicy) error {
+
+	origin_fp := report.OriginFingerprint
+
+	if origin_fp == "" {
+		slog.Debug("Report does not have an origin fingerprint, keeping existing fingerprint", "id", id)
+		return nil
+	}
+
+	if mp.Fingerprint == "" || mp.Fingerprint == origin_fp {
+		mp.Fingerprint = origin_fp
+		return nil
+	}
+
+	switch policy {
+	case FINGERPRINT_ERROR:
+
+		return &FingerprintMismatchError{
+			ID:                id,
+			Fingerprint:       mp.Fingerprint,
+			OriginFingerprint: origin_fp,
+		}
+
+	case FINGERPRINT_ACCEPT:
+		// pass
+	case FINGERPRINT_WARN, "":
+		slog.Warn("Report origin fingerprint does not match feature fingerprint", "id", id, "fingerprint", mp.Fingerprint, "origin fingerprint", origin_fp)
+	default:
+		return fmt.Errorf("Invalid fingerprint policy '%s'", policy)
+	}
+
+	mp.ReplaceFingerprint(origin_fp, "iiif-process report")
+	return nil
+}
@@ -0,0 +1,296 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/aaronland/go-image-tools/util"
+	"github.com/aaronland/go-string/random"
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/filename"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"gocloud.dev/blob"
+)
+
+// GenerateOptions is a struct containing configuration details for generating derivatives.
+type GenerateOptions struct {
+	// The gocloud.dev/blob Bucket where pending images are read from.
+	Pending *blob.Bucket
+	// The gocloud.dev/blob Bucket where derivatives are written.
+	Media *blob.Bucket
+	// An optional gocloud.dev/blob Bucket where the report describing the derivatives is written.
+	Reports *blob.Bucket
+	// The derivative sizes to produce. If empty then common.DEFAULT_GENERATE_SIZES is used.
+	Sizes []*common.GenerateSize
+	// An optional image format ("jpg", "png" or "gif") for derivatives. If empty then the format of the pending image is used
+	// if it is one of those formats, otherwise "jpg".
+	Format string
+	// A common.WritePolicy used to derive the options for derivatives. If nil then common.DefaultWritePolicy is used.
+	WritePolicy common.WritePolicy
+	// The maximum number of derivatives to produce concurrently. If 0 then common.DEFAULT_WORKERS is used.
+	Workers int
+	// Optional configuration for extracting the colour palette of the pending image. If nil then the report's palette is empty.
+	PaletteOptions *common.PaletteOptions
+}
+
+// GenerateRequest is a struct encapsulating data for generating the derivatives of a pending image.
+type GenerateRequest struct {
+	// The WOF ID of the (media) feature associated with the pending image.
+	Id int64 `json:"id"`
+	// The key of the pending image in the pending bucket.
+	Origin string `json:"origin"`
+}
+
+// GenerateResponse is a struct containing the results of generating the derivatives of a pending image.
+type GenerateResponse struct {
+	// A report describing the derivatives, compatible with the go-iiif "iiif-process" reports consumed by ReportProcessor.
+	Report *IIIFProcessReport
+	// The key of the report in GenerateOptions.Reports, or "" if no reports bucket was defined.
+	ReportKey string
+}
+
+// Generate will produce the derivatives of the pending image described by 'req', using the "{id}_{secret}_{label}.{ext}"
+// naming convention and newly generated secrets, and write them to opts.Media. It returns a IIIFProcessReport describing
+// the derivatives that can be processed by a ReportProcessor, using the same pending bucket, without any changes. If
+// opts.Reports is defined the report is also written there. If any derivative fails then the derivatives that have
+// already been written are removed.
+func Generate(ctx context.Context, opts *GenerateOptions, req *GenerateRequest) (*GenerateResponse, error) {
+
+	if opts.Pending == nil {
+		return nil, fmt.Errorf("Missing pending bucket")
+	}
+
+	if opts.Media == nil {
+		return nil, fmt.Errorf("Missing media bucket")
+	}
+
+	sizes := opts.Sizes
+
+	if len(sizes) == 0 {
+
+		default_sizes, err := common.ParseGenerateSizes(common.DEFAULT_GENERATE_SIZES)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse default sizes, %w", err)
+		}
+
+		sizes = default_sizes
+	}
+
+	r, err := opts.Pending.NewReader(ctx, req.Origin, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s, %w", req.Origin, err)
+	}
+
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s, %w", req.Origin, err)
+	}
+
+	im, format, err := util.DecodeImageFromReader(bytes.NewReader(body))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode %s, %w", req.Origin, err)
+	}
+
+	switch {
+	case opts.Format != "":
+		format = opts.Format
+	case format != "jpeg" && format != "png" && format != "gif":
+		// Derivatives can only be encoded as JPEG, PNG or GIF images
+		format = "jpg"
+	}
+
+	ext := format
+
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+
+	rand_opts := random.DefaultOptions()
+	rand_opts.AlphaNumeric = true
+
+	secret, err := random.String(rand_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate secret, %w", err)
+	}
+
+	secret_o, err := random.String(rand_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate secret, %w", err)
+	}
+
+	root, err := uri.Id2Path(req.Id)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive path for %d, %w", req.Id, err)
+	}
+
+	policy := opts.WritePolicy
+
+	if policy == nil {
+		policy = common.NewDefaultWritePolicy()
+	}
+
+	report := &IIIFProcessReport{
+		Dimensions:        make(IIIFProcessReportDimensions),
+		Palette:           make([]IIIFProcessReportPalette, 0),
+		URIs:              make(IIIFProcessReportURIs),
+		Origin:            req.Origin,
+		OriginURI:         idSecretURI(req.Id, req.Origin, secret, secret_o),
+		OriginFingerprint: common.FingerprintBytes(body),
+	}
+
+	if opts.PaletteOptions != nil {
+
+		palette, err := common.ExtractPalette(ctx, im, opts.PaletteOptions)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to extract palette for %s, %w", req.Origin, err)
+		}
+
+		report.Palette = palette
+	}
+
+	written := make([]string, 0)
+	mu := new(sync.Mutex)
+
+	generate_func := func(ctx context.Context, idx int) error {
+
+		sz := sizes[idx]
+
+		local_secret := secret
+
+		if sz.Label == filename.ORIGINAL_LABEL {
+			local_secret = secret_o
+		}
+
+		fname, err := filename.NewFilename(req.Id, local_secret, sz.Label, ext)
+
+		if err != nil {
+			return fmt.Errorf("Invalid filename for %s derivative, %w", sz.Label, err)
+		}
+
+		key := filepath.Join(root, fname.String())
+
+		derivative := common.ResizeImage(im, sz)
+
+		var buf bytes.Buffer
+
+		err = util.EncodeImage(derivative, format, &buf)
+
+		if err != nil {
+			return fmt.Errorf("Failed to encode %s derivative, %w", sz.Label, err)
+		}
+
+		enc := buf.Bytes()
+
+		attrs := &common.WriteAttributes{
+			Key:         key,
+			ContentType: common.SniffContentType(key, enc),
+			ID:          req.Id,
+			Fingerprint: common.FingerprintBytes(enc),
+		}
+
+		wr_opts, err := policy.WriterOptions(ctx, attrs)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive writer options for %s, %w", key, err)
+		}
+
+		err = opts.Media.WriteAll(ctx, key, enc, wr_opts)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write %s, %w", key, err)
+		}
+
+		dims := derivative.Bounds()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		written = append(written, key)
+
+		report.Dimensions[sz.Label] = []int{dims.Dx(), dims.Dy()}
+		report.URIs[sz.Label] = key
+
+		return nil
+	}
+
+	ex := common.NewExecutor(&common.ExecutorOptions{
+		Workers:  opts.Workers,
+		FailFast: true,
+	})
+
+	scrub := func() {
+
+		for _, key := range written {
+			opts.Media.Delete(context.WithoutCancel(ctx), key)
+		}
+	}
+
+	err = ex.Execute(ctx, len(sizes), generate_func)
+
+	if err != nil {
+		scrub()
+		return nil, err
+	}
+
+	rsp := &GenerateResponse{
+		Report: report,
+	}
+
+	if opts.Reports == nil {
+		return rsp, nil
+	}
+
+	enc, err := json.Marshal(report)
+
+	if err != nil {
+		scrub()
+		return nil, fmt.Errorf("Failed to marshal report, %w", err)
+	}
+
+	report_key := filepath.Join(root, fmt.Sprintf("%d_%s-report.json", req.Id, secret_o))
+
+	err = opts.Reports.WriteAll(ctx, report_key, enc, nil)
+
+	if err != nil {
+		scrub()
+		return nil, fmt.Errorf("Failed to write report %s, %w", report_key, err)
+	}
+
+	rsp.ReportKey = report_key
+	return rsp, nil
+}
+
+// idSecretURI returns a go-iiif-uri "idsecret://" URI for 'origin', so that reports produced by Generate can be resolved
+// by IdSecretOriginResolver.
+func idSecretURI(id int64, origin string, secret string, secret_o string) string {
+
+	q := url.Values{}
+	q.Set("id", strconv.FormatInt(id, 10))
+	q.Set("secret", secret)
+	q.Set("secret_o", secret_o)
+
+	u := url.URL{
+		Scheme:   "idsecret",
+		Path:     "/" + origin,
+		RawQuery: q.Encode(),
+	}
+
+	return u.String()
+}
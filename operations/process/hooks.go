@@ -0,0 +1,301 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-ioutil"
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+// DEFAULT_WEBHOOK_TIMEOUT is the timeout for the default HTTP client used by the hooks returned by NewWebhookHook.
+const DEFAULT_WEBHOOK_TIMEOUT time.Duration = 30 * time.Second
+
+// type HookPhase is a string label describing when a Hook is run.
+type HookPhase string
+
+const (
+	// HOOK_PRE_WRITE indicates a hook that is run after a report has been applied to a feature, and the feature exported,
+	// but before it is written.
+	HOOK_PRE_WRITE HookPhase = "pre-write"
+	// HOOK_POST_WRITE indicates a hook that is run after a feature has been written.
+	HOOK_POST_WRITE HookPhase = "post-write"
+)
+
+// HookContext is a struct containing details about the report and feature being processed, passed to each Hook.
+type HookContext struct {
+	// The URI of the report being processed.
+	ReportURI string
+	// The report being processed.
+	Report *IIIFProcessReport
+	// The WOF ID of the feature being updated.
+	ID int64
+	// The wof:repo property of the feature being updated.
+	Repo string
+	// The feature before the report was applied.
+	OldFeature []byte
+	// The feature after the report was applied and it was exported. Pre-write hooks may replace NewFeature, in which
+	// case it is exported again before it is written. Post-write hooks should treat it as read-only.
+	NewFeature []byte
+	// The relative path the feature is (or will be) written to.
+	Path string
+	// The (resolved) whosonfirst/go-writer URI the feature is (or will be) written to.
+	WriterURI string
+}
+
+// HookFunc is a function that is run for a report being processed.
+type HookFunc func(context.Context, *HookContext) error
+
+// Hook is a struct pairing a HookFunc with a name, used to identify the hook in errors and in the journal.
+type Hook struct {
+	// The name of the hook. Names must be unique within a ReportProcessor and CALLBACK_HOOK_NAME is reserved.
+	Name string
+	// The function to run.
+	Func HookFunc
+}
+
+// HookError is an error returned when a Hook fails.
+type HookError struct {
+	// The phase the hook was run in.
+	Phase HookPhase
+	// The name of the hook that failed.
+	Hook string
+	// The error returned by the hook.
+	Err error
+}
+
+// Error returns a string describing the hook that failed and why.
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook '%s' failed, %v", e.Phase, e.Hook, e.Err)
+}
+
+// Unwrap returns the error returned by the hook.
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// NewHook returns a new Hook named 'name' for 'fn'.
+func NewHook(name string, fn HookFunc) *Hook {
+
+	h := &Hook{
+		Name: name,
+		Func: fn,
+	}
+
+	return h
+}
+
+// NewCallbackHook returns a new Hook named 'name' for a (legacy) ProcessReportCallback function.
+func NewCallbackHook(name string, cb ProcessReportCallback) *Hook {
+
+	fn := func(ctx context.Context, hc *HookContext) error {
+		return cb(ctx, hc.Report, hc.OldFeature, hc.NewFeature)
+	}
+
+	return NewHook(name, fn)
+}
+
+// NewDepictsHook returns a new Hook named 'name' that calls 'fn' for each of the WOF IDs in the wof:depicts property of
+// the updated feature.
+func NewDepictsHook(name string, fn func(context.Context, *HookContext, int64) error) *Hook {
+
+	hook_fn := func(ctx context.Context, hc *HookContext) error {
+
+		for _, r := range gjson.GetBytes(hc.NewFeature, "properties.wof:depicts").Array() {
+
+			depicts_id := r.Int()
+
+			if depicts_id <= 0 {
+				continue
+			}
+
+			err := fn(ctx, hc, depicts_id)
+
+			if err != nil {
+				return fmt.Errorf("Failed to update depicted feature %d, %w", depicts_id, err)
+			}
+		}
+
+		return nil
+	}
+
+	return NewHook(name, hook_fn)
+}
+
+// HookNotification is the struct sent, as JSON, by the hooks returned by NewWebhookHook.
+type HookNotification struct {
+	// The URI of the report that was processed.
+	Report string `json:"report"`
+	// The WOF ID of the feature that was updated.
+	ID int64 `json:"id"`
+	// The wof:repo property of the feature that was updated.
+	Repo string `json:"repo"`
+	// The relative path the feature was written to.
+	Path string `json:"path"`
+	// The Unix timestamp when the notification was sent.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// NewWebhookHook returns a new Hook named 'name' that sends a HookNotification, as JSON, to 'webhook_url' using an HTTP
+// POST request. If 'client' is nil then an http.Client with a timeout of DEFAULT_WEBHOOK_TIMEOUT is used.
+func NewWebhookHook(name string, webhook_url string, client *http.Client) *Hook {
+
+	if client == nil {
+		client = &http.Client{
+			Timeout: DEFAULT_WEBHOOK_TIMEOUT,
+		}
+	}
+
+	fn := func(ctx context.Context, hc *HookContext) error {
+
+		n := &HookNotification{
+			Report:    hc.ReportURI,
+			ID:        hc.ID,
+			Repo:      hc.Repo,
+			Path:      hc.Path,
+			Timestamp: time.Now().Unix(),
+		}
+
+		enc, err := json.Marshal(n)
+
+		if err != nil {
+			return fmt.Errorf("Failed to marshal notification, %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook_url, bytes.NewReader(enc))
+
+		if err != nil {
+			return fmt.Errorf("Failed to create notification request, %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		rsp, err := client.Do(req)
+
+		if err != nil {
+			return fmt.Errorf("Failed to send notification, %w", err)
+		}
+
+		defer rsp.Body.Close()
+
+		if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+			return fmt.Errorf("Notification failed with status %s", rsp.Status)
+		}
+
+		return nil
+	}
+
+	return NewHook(name, fn)
+}
+
+// NewWriterHook returns a new Hook named 'name' that writes the updated feature to the whosonfirst/go-writer Writer
+// defined by 'writer_uri', for example to refresh a search index. If 'writer_uri' contains the string "{repo}" it will
+// be replaced by the feature's wof:repo property.
+func NewWriterHook(name string, writer_uri string) *Hook {
+
+	fn := func(ctx context.Context, hc *HookContext) error {
+
+		uri := expandRepo(writer_uri, hc.Repo)
+
+		wr, err := writer.NewWriter(ctx, uri)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create writer, %w", err)
+		}
+
+		r, err := ioutil.NewReadSeekCloser(bytes.NewReader(hc.NewFeature))
+
+		if err != nil {
+			return fmt.Errorf("Failed to create ReadSeekCloser from new feature, %w", err)
+		}
+
+		_, err = wr.Write(ctx, hc.Path, r)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write %s, %w", hc.Path, err)
+		}
+
+		return wr.Close(ctx)
+	}
+
+	return NewHook(name, fn)
+}
+
+// validateHooks returns an error if any of 'hooks' are nil, are missing a name or function, share a name with another hook
+// or are named CALLBACK_HOOK_NAME. Hook names are used to record, and skip, completed hooks in the journal so they must
+// be unique.
+func validateHooks(hooks ...*Hook) error {
+
+	seen := make(map[string]bool)
+
+	for idx, h := range hooks {
+
+		if h == nil {
+			return fmt.Errorf("Hook at offset %d is nil", idx)
+		}
+
+		if h.Name == "" {
+			return fmt.Errorf("Hook at offset %d is missing a name", idx)
+		}
+
+		if h.Func == nil {
+			return fmt.Errorf("Hook '%s' is missing a function", h.Name)
+		}
+
+		if h.Name == CALLBACK_HOOK_NAME {
+			return fmt.Errorf("Hook name '%s' is reserved", h.Name)
+		}
+
+		if seen[h.Name] {
+			return fmt.Errorf("Duplicate hook name '%s'", h.Name)
+		}
+
+		seen[h.Name] = true
+	}
+
+	return nil
+}
+
+// runHooks runs each hook in 'hooks', in order, with 'hc' skipping any hooks whose names are in 'completed'. 'done' is
+// called after each hook succeeds. It returns a HookError for the first hook that fails.
+func runHooks(ctx context.Context, phase HookPhase, hooks []*Hook, hc *HookContext, completed []string, done func(string) error) error {
+
+	skip := make(map[string]bool)
+
+	for _, name := range completed {
+		skip[name] = true
+	}
+
+	for _, h := range hooks {
+
+		if skip[h.Name] {
+			continue
+		}
+
+		err := h.Func(ctx, hc)
+
+		if err != nil {
+			return &HookError{
+				Phase: phase,
+				Hook:  h.Name,
+				Err:   err,
+			}
+		}
+
+		if done != nil {
+
+			err := done(h.Name)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
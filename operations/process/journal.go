@@ -0,0 +1,237 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/url"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
+)
+
+// type JournalStep is a string label describing a step in the processing of a report.
+type JournalStep string
+
+const (
+	// JOURNAL_READ indicates that the report and its pending feature have been read.
+	JOURNAL_READ JournalStep = "read"
+	// JOURNAL_EXPORTED indicates that the report has been applied to the feature and the feature has been exported.
+	// Nothing outside the journal has been changed.
+	JOURNAL_EXPORTED JournalStep = "exported"
+	// JOURNAL_WRITTEN indicates that the updated feature has been written to the go-writer Writer.
+	JOURNAL_WRITTEN JournalStep = "written"
+	// JOURNAL_CALLBACK indicates that the report processing callback and post-write hooks (if any) have completed.
+	JOURNAL_CALLBACK JournalStep = "callback"
+	// JOURNAL_PRUNED indicates that the report, pending image and pending feature have been pruned (if pruning is enabled).
+	JOURNAL_PRUNED JournalStep = "pruned"
+)
+
+// JournalStepRecord is a struct recording when a JournalStep was reached.
+type JournalStepRecord struct {
+	// The step that was reached.
+	Step JournalStep `json:"step"`
+	// The Unix timestamp when the step was reached.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// JournalEntry is a struct recording the progress of a single report through ProcessReport, with enough detail to finish
+// or roll back the report if processing is interrupted.
+type JournalEntry struct {
+	// The URI of the report being processed.
+	ReportURI string `json:"report_uri"`
+	// The report being processed.
+	Report *IIIFProcessReport `json:"report,omitempty"`
+	// The WOF ID of the feature being updated.
+	ID int64 `json:"id"`
+	// The key of the feature in the pending bucket.
+	FeatureKey string `json:"feature_key"`
+	// The relative path the updated feature is written to.
+	Path string `json:"path"`
+	// The (resolved) go-writer URI the updated feature is written to.
+	WriterURI string `json:"writer_uri,omitempty"`
+	// The feature before the report was applied.
+	OldFeature json.RawMessage `json:"old_feature,omitempty"`
+	// The feature after the report was applied and it was exported.
+	NewFeature json.RawMessage `json:"new_feature,omitempty"`
+	// The steps that have been reached, in order.
+	Steps []*JournalStepRecord `json:"steps"`
+	// The names of the post-write hooks that have completed, in order.
+	Hooks []string `json:"hooks,omitempty"`
+}
+
+// Step returns the most recent JournalStep reached by 'e', or "" if no steps have been reached.
+func (e *JournalEntry) Step() JournalStep {
+
+	if len(e.Steps) == 0 {
+		return ""
+	}
+
+	return e.Steps[len(e.Steps)-1].Step
+}
+
+// AddStep appends 's' to the steps reached by 'e'.
+func (e *JournalEntry) AddStep(s JournalStep) {
+
+	r := &JournalStepRecord{
+		Step:      s,
+		Timestamp: time.Now().Unix(),
+	}
+
+	e.Steps = append(e.Steps, r)
+}
+
+// Journal is an interface for a write-ahead journal recording the progress of reports through ProcessReport.
+type Journal interface {
+	// Record writes (or replaces) the entry for a report.
+	Record(context.Context, *JournalEntry) error
+	// Remove removes the entry for a report URI.
+	Remove(context.Context, string) error
+	// Entries returns an iterator of all the entries in the journal.
+	Entries(context.Context) iter.Seq2[*JournalEntry, error]
+}
+
+// BlobJournal is a Journal implementation that stores entries as JSON documents in a gocloud.dev/blob Bucket.
+type BlobJournal struct {
+	bucket *blob.Bucket
+	prefix string
+}
+
+// NewBlobJournal returns a new BlobJournal instance that stores entries in 'bucket', with keys prefixed by 'prefix'.
+func NewBlobJournal(bucket *blob.Bucket, prefix string) (*BlobJournal, error) {
+
+	if bucket == nil {
+		return nil, fmt.Errorf("Missing journal bucket")
+	}
+
+	j := &BlobJournal{
+		bucket: bucket,
+		prefix: prefix,
+	}
+
+	return j, nil
+}
+
+// NewLocalJournal returns a new BlobJournal instance that stores entries in the local directory 'root', which is created
+// if it does not exist.
+func NewLocalJournal(root string) (*BlobJournal, error) {
+
+	opts := &fileblob.Options{
+		CreateDir: true,
+	}
+
+	bucket, err := fileblob.OpenBucket(root, opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open journal directory %s, %w", root, err)
+	}
+
+	return NewBlobJournal(bucket, "")
+}
+
+// Record writes the entry for e.ReportURI to the journal bucket.
+func (j *BlobJournal) Record(ctx context.Context, e *JournalEntry) error {
+
+	enc, err := json.Marshal(e)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal journal entry, %w", err)
+	}
+
+	key := j.entryKey(e.ReportURI)
+
+	err = j.bucket.WriteAll(ctx, key, enc, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write journal entry %s, %w", key, err)
+	}
+
+	return nil
+}
+
+// Remove removes the entry for 'report_uri' from the journal bucket, if it exists.
+func (j *BlobJournal) Remove(ctx context.Context, report_uri string) error {
+
+	key := j.entryKey(report_uri)
+
+	exists, err := j.bucket.Exists(ctx, key)
+
+	if err != nil {
+		return fmt.Errorf("Failed to determine if %s exists, %w", key, err)
+	}
+
+	if !exists {
+		return nil
+	}
+
+	err = j.bucket.Delete(ctx, key)
+
+	if err != nil {
+		return fmt.Errorf("Failed to delete journal entry %s, %w", key, err)
+	}
+
+	return nil
+}
+
+// Entries returns an iterator of all the entries in the journal bucket.
+func (j *BlobJournal) Entries(ctx context.Context) iter.Seq2[*JournalEntry, error] {
+
+	return func(yield func(*JournalEntry, error) bool) {
+
+		list_opts := &blob.ListOptions{
+			Prefix: j.prefix,
+		}
+
+		iter := j.bucket.List(list_opts)
+
+		for {
+
+			obj, err := iter.Next(ctx)
+
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil {
+				yield(nil, fmt.Errorf("Failed to list journal entries, %w", err))
+				return
+			}
+
+			if obj.IsDir || !strings.HasSuffix(obj.Key, ".json") {
+				continue
+			}
+
+			body, err := j.bucket.ReadAll(ctx, obj.Key)
+
+			if err != nil {
+
+				if !yield(nil, fmt.Errorf("Failed to read journal entry %s, %w", obj.Key, err)) {
+					return
+				}
+
+				continue
+			}
+
+			var e *JournalEntry
+
+			err = json.Unmarshal(body, &e)
+
+			if err != nil {
+				err = fmt.Errorf("Failed to unmarshal journal entry %s, %w", obj.Key, err)
+			}
+
+			if !yield(e, err) {
+				return
+			}
+		}
+	}
+}
+
+// entryKey returns the key for the entry for 'report_uri'.
+func (j *BlobJournal) entryKey(report_uri string) string {
+	return j.prefix + url.PathEscape(report_uri) + ".json"
+}
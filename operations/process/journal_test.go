@@ -0,0 +1,468 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-export/v3"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+)
+
+const test_id int64 = 1511951011
+
+const test_fingerprint string = "018c9bc2cbfd25fdccb2fc29d0cce099d8df7596"
+
+const test_report_key string = "1511951011-report.json"
+
+const test_origin_key string = "1511951011.jpg"
+
+const test_feature_key string = "1511951011.geojson"
+
+// errCrash is the error returned by crashJournal to simulate a report processor being interrupted.
+var errCrash = errors.New("crash")
+
+// crashJournal is a Journal which records entries in an underlying Journal but returns errCrash as soon as an entry
+// reaching a given step has been recorded, so that ProcessReport stops as if it had been interrupted at that step.
+type crashJournal struct {
+	Journal
+	step JournalStep
+}
+
+func (j *crashJournal) Record(ctx context.Context, e *JournalEntry) error {
+
+	err := j.Journal.Record(ctx, e)
+
+	if err != nil {
+		return err
+	}
+
+	if e.Step() == j.step {
+		return errCrash
+	}
+
+	return nil
+}
+
+// journalTest is a struct containing a ReportProcessor, whose buckets contain a single report and its pending image
+// and feature, and the state needed to inspect it.
+type journalTest struct {
+	processor *ReportProcessor
+	journal   *BlobJournal
+	root      string
+	callbacks int
+}
+
+// newJournalTest returns a new journalTest instance whose report, pending image and pending feature are stored in
+// memblob buckets and whose feature is written to a temporary directory.
+func newJournalTest(t *testing.T) *journalTest {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	reports := memblob.OpenBucket(nil)
+	pending := memblob.OpenBucket(nil)
+	journal_bucket := memblob.OpenBucket(nil)
+
+	t.Cleanup(func() {
+		reports.Close()
+		pending.Close()
+		journal_bucket.Close()
+	})
+
+	report := fmt.Sprintf(`{
+  "dimensions": {"o": [40, 20], "z": [20, 10]},
+  "uris": {"o": "%d_def456_o.jpg", "z": "%d_abc123_z.jpg"},
+  "origin": "%s",
+  "origin_uri": "test:///%s",
+  "origin_fingerprint": "%s"
+}`, test_id, test_id, test_origin_key, test_origin_key, test_fingerprint)
+
+	// The "media" placetype is not part of the core placetypes validated by the whosonfirst:// exporter
+
+	feature := fmt.Sprintf(`{
+  "id": %d,
+  "type": "Feature",
+  "properties": {
+    "wof:id": %d,
+    "wof:name": "test",
+    "wof:parent_id": -1,
+    "wof:placetype": "venue",
+    "wof:repo": "sfomuseum-data-media",
+    "media:fingerprint": "%s",
+    "media:medium": "image",
+    "media:mimetype": "image/jpeg",
+    "media:source": "test",
+    "media:status_id": 2
+  },
+  "geometry": {"type": "Point", "coordinates": [0.0, 0.0]}
+}`, test_id, test_id, test_fingerprint)
+
+	fixtures := map[*blob.Bucket]map[string]string{
+		reports: {
+			test_report_key: report,
+		},
+		pending: {
+			test_origin_key:  "not really an image",
+			test_feature_key: feature,
+		},
+	}
+
+	for bucket, objects := range fixtures {
+
+		for key, body := range objects {
+
+			err := bucket.WriteAll(ctx, key, []byte(body), nil)
+
+			if err != nil {
+				t.Fatalf("Failed to write %s, %v", key, err)
+			}
+		}
+	}
+
+	ex, err := export.NewExporter(ctx, "whosonfirst://")
+
+	if err != nil {
+		t.Fatalf("Failed to create exporter, %v", err)
+	}
+
+	journal, err := NewBlobJournal(journal_bucket, "journal/")
+
+	if err != nil {
+		t.Fatalf("Failed to create journal, %v", err)
+	}
+
+	jt := &journalTest{
+		journal: journal,
+		root:    t.TempDir(),
+	}
+
+	resolver := func(ctx context.Context, origin_uri string, report *IIIFProcessReport) (*OriginResolution, error) {
+		return &OriginResolution{ID: test_id}, nil
+	}
+
+	jt.processor = &ReportProcessor{
+		Reports:   reports,
+		Pending:   pending,
+		WriterURI: fmt.Sprintf("fs://%s", jt.root),
+		Exporter:  ex,
+		Prune:     true,
+		Callback: func(ctx context.Context, report *IIIFProcessReport, old_feature []byte, new_feature []byte) error {
+			jt.callbacks += 1
+			return nil
+		},
+		OriginResolvers: map[string]OriginResolver{
+			"test": resolver,
+		},
+		Journal: journal,
+	}
+
+	return jt
+}
+
+// written returns a boolean value indicating whether the updated feature has been written.
+func (jt *journalTest) written(t *testing.T) bool {
+
+	t.Helper()
+
+	rel_path, err := uri.Id2RelPath(test_id)
+
+	if err != nil {
+		t.Fatalf("Failed to derive rel path, %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(jt.root, rel_path))
+
+	if os.IsNotExist(err) {
+		return false
+	}
+
+	if err != nil {
+		t.Fatalf("Failed to stat written feature, %v", err)
+	}
+
+	return true
+}
+
+// pruned returns a boolean value indicating whether the report, pending image and pending feature have all been pruned.
+// It fails the test if only some of them have been pruned.
+func (jt *journalTest) pruned(t *testing.T) bool {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	keys := map[string]*blob.Bucket{
+		test_report_key:  jt.processor.Reports,
+		test_origin_key:  jt.processor.Pending,
+		test_feature_key: jt.processor.Pending,
+	}
+
+	count := 0
+
+	for key, bucket := range keys {
+
+		exists, err := bucket.Exists(ctx, key)
+
+		if err != nil {
+			t.Fatalf("Failed to determine whether %s exists, %v", key, err)
+		}
+
+		if !exists {
+			count += 1
+		}
+	}
+
+	if count != 0 && count != len(keys) {
+		t.Fatalf("Expected all or none of the keys to be pruned, %d of %d pruned", count, len(keys))
+	}
+
+	return count == len(keys)
+}
+
+// entries returns the journal entries.
+func (jt *journalTest) entries(t *testing.T) []*JournalEntry {
+
+	t.Helper()
+
+	entries := make([]*JournalEntry, 0)
+
+	for e, err := range jt.journal.Entries(context.Background()) {
+
+		if err != nil {
+			t.Fatalf("Failed to read journal entry, %v", err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+func TestProcessReportJournal(t *testing.T) {
+
+	ctx := context.Background()
+
+	jt := newJournalTest(t)
+
+	err := jt.processor.ProcessReport(ctx, test_report_key)
+
+	if err != nil {
+		t.Fatalf("Failed to process report, %v", err)
+	}
+
+	if !jt.written(t) {
+		t.Fatalf("Feature was not written")
+	}
+
+	if !jt.pruned(t) {
+		t.Fatalf("Report was not pruned")
+	}
+
+	if jt.callbacks != 1 {
+		t.Fatalf("Expected callback to be run once, got %d", jt.callbacks)
+	}
+
+	entries := jt.entries(t)
+
+	if len(entries) != 0 {
+		t.Fatalf("Expected journal to be empty, got %d entries", len(entries))
+	}
+}
+
+func TestRecover(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		// The step at which processing is interrupted.
+		Step JournalStep
+		// Whether the feature has been written when processing is interrupted.
+		Written bool
+		// The number of times the callback has been run when processing is interrupted.
+		Callbacks int
+		// Whether the report is finished (rather than rolled back) by Recover.
+		Finished bool
+	}{
+		{JOURNAL_READ, false, 0, false},
+		{JOURNAL_EXPORTED, false, 0, false},
+		{JOURNAL_WRITTEN, true, 0, true},
+		{JOURNAL_CALLBACK, true, 1, true},
+		{JOURNAL_PRUNED, true, 1, true},
+	}
+
+	for _, test := range tests {
+
+		t.Run(string(test.Step), func(t *testing.T) {
+
+			jt := newJournalTest(t)
+
+			jt.processor.Journal = &crashJournal{
+				Journal: jt.journal,
+				step:    test.Step,
+			}
+
+			err := jt.processor.ProcessReport(ctx, test_report_key)
+
+			if !errors.Is(err, errCrash) {
+				t.Fatalf("Expected processing to be interrupted, %v", err)
+			}
+
+			entries := jt.entries(t)
+
+			if len(entries) != 1 {
+				t.Fatalf("Expected 1 journal entry, got %d", len(entries))
+			}
+
+			if entries[0].Step() != test.Step {
+				t.Fatalf("Expected journal entry to be at %s step, got %s", test.Step, entries[0].Step())
+			}
+
+			if jt.written(t) != test.Written {
+				t.Fatalf("Expected written to be %t", test.Written)
+			}
+
+			if jt.pruned(t) != (test.Step == JOURNAL_PRUNED) {
+				t.Fatalf("Unexpected prune state before recovery")
+			}
+
+			if jt.callbacks != test.Callbacks {
+				t.Fatalf("Expected callback to have been run %d times, got %d", test.Callbacks, jt.callbacks)
+			}
+
+			jt.processor.Journal = jt.journal
+
+			finished, err := jt.processor.Recover(ctx)
+
+			if err != nil {
+				t.Fatalf("Failed to recover, %v", err)
+			}
+
+			entries = jt.entries(t)
+
+			if len(entries) != 0 {
+				t.Fatalf("Expected journal to be empty after recovery, got %d entries", len(entries))
+			}
+
+			if !test.Finished {
+
+				if len(finished) != 0 {
+					t.Fatalf("Expected report to be rolled back, got %v", finished)
+				}
+
+				if jt.pruned(t) {
+					t.Fatalf("Rolled back report was pruned")
+				}
+
+				if jt.callbacks != 0 {
+					t.Fatalf("Callback was run for rolled back report")
+				}
+
+				// Rolled back reports can be processed again from scratch
+
+				err = jt.processor.ProcessReport(ctx, test_report_key)
+
+				if err != nil {
+					t.Fatalf("Failed to process rolled back report, %v", err)
+				}
+
+			} else {
+
+				if len(finished) != 1 || finished[0] != test_report_key {
+					t.Fatalf("Expected report to be finished, got %v", finished)
+				}
+			}
+
+			if !jt.written(t) {
+				t.Fatalf("Feature was not written")
+			}
+
+			if !jt.pruned(t) {
+				t.Fatalf("Report was not pruned")
+			}
+
+			if jt.callbacks != 1 {
+				t.Fatalf("Expected callback to be run once, got %d", jt.callbacks)
+			}
+		})
+	}
+}
+
+func TestRecoverPruneFailure(t *testing.T) {
+
+	ctx := context.Background()
+
+	jt := newJournalTest(t)
+
+	reports := jt.processor.Reports
+
+	// Swap in a closed bucket, once the callback has run, so that pruning the report fails
+
+	closed := memblob.OpenBucket(nil)
+	closed.Close()
+
+	callback := jt.processor.Callback
+
+	jt.processor.Callback = func(ctx context.Context, report *IIIFProcessReport, old_feature []byte, new_feature []byte) error {
+		jt.processor.Reports = closed
+		return callback(ctx, report, old_feature, new_feature)
+	}
+
+	err := jt.processor.ProcessReport(ctx, test_report_key)
+
+	if err == nil {
+		t.Fatalf("Expected pruning to fail")
+	}
+
+	jt.processor.Reports = reports
+
+	entries := jt.entries(t)
+
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 journal entry, got %d", len(entries))
+	}
+
+	if entries[0].Step() != JOURNAL_CALLBACK {
+		t.Fatalf("Expected journal entry to be at %s step, got %s", JOURNAL_CALLBACK, entries[0].Step())
+	}
+
+	exists, err := reports.Exists(ctx, test_report_key)
+
+	if err != nil {
+		t.Fatalf("Failed to determine whether report exists, %v", err)
+	}
+
+	if !exists {
+		t.Fatalf("Report was pruned")
+	}
+
+	finished, err := jt.processor.Recover(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to recover, %v", err)
+	}
+
+	if len(finished) != 1 {
+		t.Fatalf("Expected report to be finished, got %v", finished)
+	}
+
+	if !jt.pruned(t) {
+		t.Fatalf("Report was not pruned")
+	}
+
+	if jt.callbacks != 1 {
+		t.Fatalf("Expected callback to be run once, got %d", jt.callbacks)
+	}
+
+	entries = jt.entries(t)
+
+	if len(entries) != 0 {
+		t.Fatalf("Expected journal to be empty after recovery, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,76 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+)
+
+// MarkerStore is an interface for recording which reports have been processed so that they are not processed again,
+// for example after a restart.
+type MarkerStore interface {
+	// IsProcessed returns a boolean value indicating whether a report URI has been marked as processed.
+	IsProcessed(context.Context, string) (bool, error)
+	// MarkProcessed marks a report URI as processed.
+	MarkProcessed(context.Context, string) error
+}
+
+// BlobMarkerStore is a MarkerStore implementation that records processed reports as (empty) objects in a gocloud.dev/blob Bucket.
+type BlobMarkerStore struct {
+	bucket *blob.Bucket
+	prefix string
+}
+
+// NewBlobMarkerStore returns a new BlobMarkerStore instance that writes markers to 'bucket'. Marker keys are the report
+// URI, prefixed by 'prefix', with a ".processed" suffix.
+func NewBlobMarkerStore(bucket *blob.Bucket, prefix string) (*BlobMarkerStore, error) {
+
+	if bucket == nil {
+		return nil, fmt.Errorf("Missing marker bucket")
+	}
+
+	s := &BlobMarkerStore{
+		bucket: bucket,
+		prefix: prefix,
+	}
+
+	return s, nil
+}
+
+// IsProcessed returns a boolean value indicating whether a marker exists for 'report_uri'.
+func (s *BlobMarkerStore) IsProcessed(ctx context.Context, report_uri string) (bool, error) {
+
+	key := s.markerKey(report_uri)
+
+	exists, err := s.bucket.Exists(ctx, key)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to determine if %s exists, %w", key, err)
+	}
+
+	return exists, nil
+}
+
+// MarkProcessed writes a marker for 'report_uri' whose body is the time it was processed.
+func (s *BlobMarkerStore) MarkProcessed(ctx context.Context, report_uri string) error {
+
+	key := s.markerKey(report_uri)
+
+	now := time.Now()
+	body := []byte(now.Format(time.RFC3339))
+
+	err := s.bucket.WriteAll(ctx, key, body, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write marker %s, %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *BlobMarkerStore) markerKey(report_uri string) string {
+	return s.prefix + strings.TrimLeft(report_uri, "/") + ".processed"
+}
@@ -0,0 +1,280 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	iiifuri "github.com/go-iiif/go-iiif-uri"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+// DEFAULT_FEATURE_KEY_TEMPLATE is the default template for the key of the feature associated with a processed image
+// in the pending bucket. It matches the default feature template used by the clone package.
+const DEFAULT_FEATURE_KEY_TEMPLATE string = "{id}.geojson"
+
+// OriginResolution is a struct containing the details derived from the origin_uri property of a IIIFProcessReport.
+type OriginResolution struct {
+	// The WOF ID of the feature associated with the processed image.
+	ID int64
+	// The key of the feature, associated with the processed image, in the pending bucket. If empty it is derived from
+	// the WOF ID using the ReportProcessor's feature template.
+	FeatureKey string
+}
+
+// OriginResolver is a custom function for mapping the origin_uri property of a IIIFProcessReport to an OriginResolution.
+type OriginResolver func(context.Context, string, *IIIFProcessReport) (*OriginResolution, error)
+
+var origin_resolvers = make(map[string]OriginResolver)
+var origin_resolvers_mu = new(sync.RWMutex)
+
+// re_leading_id matches filenames that start with a numeric (WOF) ID, for example the "{id}_{image_id}.jpg" or
+// "{id}_{filename}" paths produced by the clone package.
+var re_leading_id = regexp.MustCompile(`^(\d+)(?:[_\-\.]|$)`)
+
+func init() {
+
+	ctx := context.Background()
+
+	err := RegisterOriginResolver(ctx, "idsecret", IdSecretOriginResolver)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = RegisterOriginResolver(ctx, "rewrite", FilenameOriginResolver)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = RegisterOriginResolver(ctx, "file", FilenameOriginResolver)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegisterOriginResolver will register 'resolver' for origin URIs whose scheme is 'scheme'. It returns an error if a
+// resolver has already been registered for 'scheme'.
+func RegisterOriginResolver(ctx context.Context, scheme string, resolver OriginResolver) error {
+
+	origin_resolvers_mu.Lock()
+	defer origin_resolvers_mu.Unlock()
+
+	scheme = strings.ToLower(scheme)
+
+	_, exists := origin_resolvers[scheme]
+
+	if exists {
+		return fmt.Errorf("Origin resolver for '%s' scheme already registered", scheme)
+	}
+
+	origin_resolvers[scheme] = resolver
+	return nil
+}
+
+// OriginResolverSchemes returns the list of schemes that have registered origin resolvers.
+func OriginResolverSchemes() []string {
+
+	origin_resolvers_mu.RLock()
+	defer origin_resolvers_mu.RUnlock()
+
+	schemes := make([]string, 0)
+
+	for s := range origin_resolvers {
+		schemes = append(schemes, s)
+	}
+
+	sort.Strings(schemes)
+	return schemes
+}
+
+// ResolveOrigin will map the origin_uri property of 'report' to an OriginResolution using the resolver registered for
+// its scheme and DEFAULT_FEATURE_KEY_TEMPLATE.
+func ResolveOrigin(ctx context.Context, report *IIIFProcessReport) (*OriginResolution, error) {
+	return resolveOrigin(ctx, report, nil, "")
+}
+
+// resolveOrigin will map the origin_uri property of 'report' to an OriginResolution using the resolver in 'resolvers'
+// for its scheme, falling back to the resolvers registered using RegisterOriginResolver. If the resolver does not
+// assign a feature key it is derived using 'feature_template'.
+func resolveOrigin(ctx context.Context, report *IIIFProcessReport, resolvers map[string]OriginResolver, feature_template string) (*OriginResolution, error) {
+
+	u, err := url.Parse(report.OriginURI)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse origin URI '%s', %w", report.OriginURI, err)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+
+	resolver, ok := resolvers[scheme]
+
+	if !ok {
+
+		origin_resolvers_mu.RLock()
+		resolver, ok = origin_resolvers[scheme]
+		origin_resolvers_mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("Unsupported URI driver in report: %s", scheme)
+	}
+
+	res, err := resolver(ctx, report.OriginURI, report)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve origin URI '%s', %w", report.OriginURI, err)
+	}
+
+	if res.ID <= 0 {
+		return nil, fmt.Errorf("Origin URI '%s' resolved to invalid ID %d", report.OriginURI, res.ID)
+	}
+
+	if res.FeatureKey == "" {
+
+		key, err := FeatureKey(feature_template, res.ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res.FeatureKey = key
+	}
+
+	return res, nil
+}
+
+// IdSecretOriginResolver is an OriginResolver for go-iiif-uri "idsecret://" URIs. The WOF ID is derived from the URI's
+// "id" query parameter.
+func IdSecretOriginResolver(ctx context.Context, origin_uri string, report *IIIFProcessReport) (*OriginResolution, error) {
+
+	_, err := iiifuri.NewURI(ctx, origin_uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new IIIF URI from '%s', %w", origin_uri, err)
+	}
+
+	u, _ := url.Parse(origin_uri) // we've just parsed it
+	q := u.Query()
+
+	str_id := q.Get("id") // iiifuri.URI interface does not have an "ID" method
+	id, err := strconv.ParseInt(str_id, 10, 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse string ID '%s', %w", str_id, err)
+	}
+
+	return newOriginResolution(id)
+}
+
+// FilenameOriginResolver is an OriginResolver for go-iiif-uri "rewrite://" and "file://" URIs. The WOF ID is derived from
+// the leading digits of the URI's target, or its origin if the target does not start with a numeric ID.
+func FilenameOriginResolver(ctx context.Context, origin_uri string, report *IIIFProcessReport) (*OriginResolution, error) {
+
+	iiif_u, err := iiifuri.NewURI(ctx, origin_uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new IIIF URI from '%s', %w", origin_uri, err)
+	}
+
+	candidates := make([]string, 0)
+
+	target, err := iiif_u.Target(nil)
+
+	if err == nil && target != "" {
+		candidates = append(candidates, target)
+	}
+
+	candidates = append(candidates, iiif_u.Origin())
+
+	for _, c := range candidates {
+
+		m := re_leading_id.FindStringSubmatch(filepath.Base(c))
+
+		if len(m) != 2 {
+			continue
+		}
+
+		id, err := strconv.ParseInt(m[1], 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		return newOriginResolution(id)
+	}
+
+	return nil, fmt.Errorf("Unable to derive ID from '%s'", origin_uri)
+}
+
+// newOriginResolution returns a new OriginResolution for 'id'. The feature key is left empty so that it is derived
+// using the ReportProcessor's feature template.
+func newOriginResolution(id int64) (*OriginResolution, error) {
+
+	res := &OriginResolution{
+		ID: id,
+	}
+
+	return res, nil
+}
+
+// FeatureKey returns the key for the feature with ID 'id' in the pending bucket derived from 'template'. Valid
+// placeholders are:
+// * {id} – The WOF ID of the feature.
+// * {id_path} – The nested WOF path for the WOF ID (for example "101/736/545") as derived by whosonfirst/go-whosonfirst-uri.Id2Path.
+// If 'template' is empty then DEFAULT_FEATURE_KEY_TEMPLATE is used. These match the placeholders of the same name used
+// by the naming templates in the clone package.
+func FeatureKey(template string, id int64) (string, error) {
+
+	if template == "" {
+		template = DEFAULT_FEATURE_KEY_TEMPLATE
+	}
+
+	remaining := template
+
+	for {
+
+		start := strings.Index(remaining, "{")
+		end := strings.Index(remaining, "}")
+
+		if start == -1 && end == -1 {
+			break
+		}
+
+		if start == -1 || end == -1 || end < start {
+			return "", fmt.Errorf("Feature template '%s' has unbalanced braces", template)
+		}
+
+		name := remaining[start+1 : end]
+
+		switch name {
+		case "id", "id_path":
+			// pass
+		default:
+			return "", fmt.Errorf("Feature template '%s' has placeholder '{%s}' which can not be derived from a WOF ID", template, name)
+		}
+
+		remaining = remaining[end+1:]
+	}
+
+	id_path, err := uri.Id2Path(id)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to derive path for ID %d, %w", id, err)
+	}
+
+	r := strings.NewReplacer(
+		"{id}", strconv.FormatInt(id, 10),
+		"{id_path}", id_path,
+	)
+
+	return r.Replace(template), nil
+}
@@ -4,19 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"mime"
 	"net/url"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
 
-	iiifuri "github.com/go-iiif/go-iiif-uri"
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/filename"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"github.com/sfomuseum/go-whosonfirst-media/status"
 	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
 	"github.com/whosonfirst/go-ioutil"
 	"github.com/whosonfirst/go-whosonfirst-export/v3"
 	"github.com/whosonfirst/go-whosonfirst-uri"
@@ -24,19 +24,8 @@ import (
 	"gocloud.dev/blob"
 )
 
-// type MediaPropertiesSizes defines a struct containing properties about a media file
-type MediaPropertiesSize struct {
-	// The filename extension for the media file.
-	Extension string `json:"extension"`
-	// The pixel height of the media file.
-	Height int `json:"height"`
-	// The pixel width of the media file.
-	Width int `json:"width"`
-	// The mimetype of the media file.
-	Mimetype string `json:"mimetype"`
-	// A secret associated with the media file (typically appended to its URI).
-	Secret string `json:"secret"`
-}
+// type MediaPropertiesSizes defines a struct containing properties about a media file. It is an alias for properties.Size.
+type MediaPropertiesSize = properties.Size
 
 // IIIFProcessReport provides a struct mapping to the reports generate by the go-iiif/go-iiif 'iiif-process' functionality.
 // See also: https://github.com/go-iiif/go-iiif#report-files
@@ -58,15 +47,8 @@ type IIIFProcessReport struct {
 // IIIFProcessReportDimensions provides a data structure containing labels (for image sizes) mapped to their x (width) and y (height) pixel values.
 type IIIFProcessReportDimensions map[string][]int
 
-// IIIFProcessReportPalette provides a data structure containing colour palette information about an image file.
-type IIIFProcessReportPalette struct {
-	// The name (or label) for a colour.
-	Name string `json:"name"`
-	// The (6-character) hexidecimal value for a colour.
-	Hex string `json:"hex"`
-	// The reference (source) for a colour.
-	Reference string `json:"reference"`
-}
+// IIIFProcessReportPalette provides a data structure containing colour palette information about an image file. It is an alias for properties.Colour.
+type IIIFProcessReportPalette = properties.Colour
 
 // IIIFProcessReportURIs ...
 type IIIFProcessReportURIs map[string]string
@@ -77,6 +59,9 @@ type URITemplateFunc func([]byte) ([]byte, error)
 // ProcessReportCallback is a custom function for processing a IIIFProcessReport
 type ProcessReportCallback func(context.Context, *IIIFProcessReport, []byte, []byte) error
 
+// CALLBACK_HOOK_NAME is the name of the post-write Hook used to run ReportProcessor.Callback.
+const CALLBACK_HOOK_NAME string = "callback"
+
 // ReportProcessor provides a struct for managing and processing reports (produced by the go-iiif/go-iiif 'iiif-process' functionality).
 type ReportProcessor struct {
 	// A valid gocloud.dev/blob Bucket where reports are stored.
@@ -91,79 +76,91 @@ type ReportProcessor struct {
 	Prune bool
 	// ...
 	URITemplateFunc URITemplateFunc
-	// ...
+	// An optional ProcessReportCallback run after a feature has been written. It is run before any PostWriteHooks.
 	Callback ProcessReportCallback
+	// An optional, ordered, list of hooks run after a report has been applied to a feature, and the feature exported,
+	// but before it is written. Pre-write hooks are also run in "dry run" mode so they should not have any side effects
+	// other than modifying HookContext.NewFeature.
+	PreWriteHooks []*Hook
+	// An optional, ordered, list of hooks run after a feature has been written.
+	PostWriteHooks []*Hook
+	// An optional map of URI schemes to custom OriginResolver functions for deriving WOF IDs and pending feature keys from
+	// a report's origin_uri property. These take precedence over resolvers registered using RegisterOriginResolver.
+	OriginResolvers map[string]OriginResolver
+	// An optional template used to derive the key of the feature associated with a processed image in the pending
+	// bucket, when an OriginResolver does not assign one. This should match the feature template used to clone images
+	// (and their features) to the pending bucket. See FeatureKey for details. If empty then DEFAULT_FEATURE_KEY_TEMPLATE
+	// is used.
+	FeatureTemplate string
+	// The maximum number of reports to process concurrently. If 0 then common.DEFAULT_WORKERS is used.
+	Workers int
+	// A boolean flag indicating whether to process reports in "dry run" mode. Reports are applied to features, and the
+	// features are exported, but nothing is written, pruned or passed to Callback or PostWriteHooks. Instead a FeatureDiff
+	// describing the changes to each feature is written to DiffWriter.
+	Dryrun bool
+	// An optional io.Writer where FeatureDiff records are written, as JSON Lines, in "dry run" mode. If nil then diffs are logged.
+	DiffWriter io.Writer
+	// The policy to apply when a report's origin fingerprint does not match the feature's media:fingerprint property.
+	// If empty then FINGERPRINT_WARN is used.
+	FingerprintPolicy FingerprintPolicy
+	// An optional Journal used to record the progress of each report so that reports which are interrupted can be
+	// finished, or rolled back, by Recover.
+	Journal Journal
+	diff_mu sync.Mutex
 }
 
-// ProcessReports will process zero or more report URIs
+// ProcessReports will process zero or more report URIs, processing up to p.Workers reports concurrently.
 func (p *ReportProcessor) ProcessReports(ctx context.Context, reports ...string) error {
 
-	type ReportError struct {
-		Report string
-		Error  error
-	}
-
-	done_ch := make(chan bool)
-	err_ch := make(chan ReportError)
-
-	for _, report_uri := range reports {
+	err := p.validateHooks()
 
-		go func(report_uri string) {
+	if err != nil {
+		return err
+	}
 
-			defer func() {
-				done_ch <- true
-			}()
+	ex := common.NewExecutor(&common.ExecutorOptions{
+		Workers: p.Workers,
+	})
 
-			err := p.ProcessReport(ctx, report_uri)
+	process_func := func(ctx context.Context, idx int) error {
 
-			if err != nil {
-				err_ch <- ReportError{
-					Report: report_uri,
-					Error:  fmt.Errorf("Failed to process report '%s', %w", report_uri, err),
-				}
-			}
+		report_uri := reports[idx]
 
-		}(report_uri)
-	}
-
-	remaining := len(reports)
-	report_errors := make([]ReportError, 0)
+		err := p.ProcessReport(ctx, report_uri)
 
-	for remaining > 0 {
-		select {
-		case <-done_ch:
-			remaining -= 1
-		case err := <-err_ch:
-			report_errors = append(report_errors, err)
-		default:
-			// pass
+		if err != nil {
+			return fmt.Errorf("Failed to process report '%s', %w", report_uri, err)
 		}
-	}
 
-	if len(report_errors) > 0 {
-
-		error_msgs := make([]string, len(report_errors))
+		return nil
+	}
 
-		for i, e := range report_errors {
-			error_msgs[i] = fmt.Sprintf("%s: %v", e.Report, e.Error)
-		}
+	err = ex.Execute(ctx, len(reports), process_func)
 
-		return fmt.Errorf("One or more report errors: %s", strings.Join(error_msgs, ";"))
+	if err != nil {
+		return fmt.Errorf("One or more report errors: %w", err)
 	}
 
 	return nil
 }
 
-// ProcessReport will process a single report URI.
+// ProcessReport will process a single report URI. If 'ctx' has been cancelled the report is not processed and the
+// context's error is returned.
 func (p *ReportProcessor) ProcessReport(ctx context.Context, report_uri string) error {
 
 	select {
 	case <-ctx.Done():
-		return nil
+		return ctx.Err()
 	default:
 		// pass
 	}
 
+	err := p.validateHooks()
+
+	if err != nil {
+		return err
+	}
+
 	r, err := p.Reports.NewReader(ctx, report_uri, nil)
 
 	if err != nil {
@@ -190,32 +187,13 @@ func (p *ReportProcessor) ProcessReport(ctx context.Context, report_uri string)
 		return fmt.Errorf("Report (%s) is missing origin_uri. Not sure what to do with it...", report_uri)
 	}
 
-	ru, err := iiifuri.NewURI(ctx, process_report.OriginURI)
+	origin, err := resolveOrigin(ctx, process_report, p.OriginResolvers, p.FeatureTemplate)
 
 	if err != nil {
-		return fmt.Errorf("Failed to create new IIIF URI for report '%s' from '%s', %w", report_uri, process_report.OriginURI, err)
+		return fmt.Errorf("Failed to resolve origin for report '%s', %w", report_uri, err)
 	}
 
-	var wof_id int64
-
-	switch ru.Scheme() {
-	case "idsecret":
-
-		u, _ := url.Parse(process_report.OriginURI) // we've just parse
-		q := u.Query()
-
-		str_id := q.Get("id") // iiifuri.URI interface does not have an "ID" method
-		id, err := strconv.ParseInt(str_id, 10, 64)
-
-		if err != nil {
-			return fmt.Errorf("Failed to parse string ID '%s', %w", str_id, err)
-		}
-
-		wof_id = id
-
-	default:
-		return fmt.Errorf("Unsupported URI driver in report: %s", ru.Scheme())
-	}
+	wof_id := origin.ID
 
 	// START OF sudo wrap me in a function or something
 
@@ -225,7 +203,7 @@ func (p *ReportProcessor) ProcessReport(ctx context.Context, report_uri string)
 		return fmt.Errorf("Failed to derive rel path for ID %d, %w", wof_id, err)
 	}
 
-	wof_fname := filepath.Base(wof_path)
+	wof_fname := origin.FeatureKey
 
 	// note that we are reading from a *blob.Bucket rather than a
 	// reader.Reader because we need the bucket in order to prune
@@ -245,21 +223,45 @@ func (p *ReportProcessor) ProcessReport(ctx context.Context, report_uri string)
 		return fmt.Errorf("Failed to read feature %s, %w", wof_fname, err)
 	}
 
+	// Journal entries are not recorded in "dry run" mode since nothing is changed
+
+	var entry *JournalEntry
+
+	if !p.Dryrun {
+
+		entry = &JournalEntry{
+			ReportURI:  report_uri,
+			Report:     process_report,
+			ID:         wof_id,
+			FeatureKey: wof_fname,
+			Path:       wof_path,
+		}
+
+		err = p.recordStep(ctx, entry, JOURNAL_READ)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	new_feature, err := p.appendReport(old_feature, process_report)
 
 	if err != nil {
+		p.removeEntry(ctx, entry)
 		return fmt.Errorf("Failed to append report to feature %s, %w", wof_fname, err)
 	}
 
 	_, new_feature, err = p.Exporter.Export(ctx, new_feature)
 
 	if err != nil {
+		p.removeEntry(ctx, entry)
 		return fmt.Errorf("Failed to re-export feature %s, %w", wof_fname, err)
 	}
 
 	repo_rsp := gjson.GetBytes(new_feature, "properties.wof:repo")
 
 	if !repo_rsp.Exists() {
+		p.removeEntry(ctx, entry)
 		return fmt.Errorf("Missing properties.wof:repo")
 	}
 
@@ -268,16 +270,68 @@ func (p *ReportProcessor) ProcessReport(ctx context.Context, report_uri string)
 	writer_uri, err := url.QueryUnescape(p.WriterURI)
 
 	if err != nil {
+		p.removeEntry(ctx, entry)
 		return fmt.Errorf("Failed to unescape writer URI, %w", err)
 	}
 
-	if strings.Contains(writer_uri, "{repo}") {
-		writer_uri = strings.Replace(writer_uri, "{repo}", repo, 1)
+	writer_uri = expandRepo(writer_uri, repo)
+
+	if len(p.PreWriteHooks) > 0 {
+
+		hc := &HookContext{
+			ReportURI:  report_uri,
+			Report:     process_report,
+			ID:         wof_id,
+			Repo:       repo,
+			OldFeature: old_feature,
+			NewFeature: new_feature,
+			Path:       wof_path,
+			WriterURI:  writer_uri,
+		}
+
+		err = runHooks(ctx, HOOK_PRE_WRITE, p.PreWriteHooks, hc, nil, nil)
+
+		if err != nil {
+			p.removeEntry(ctx, entry)
+			return err
+		}
+
+		if !bytes.Equal(hc.NewFeature, new_feature) {
+
+			err = properties.ValidateFeature(hc.NewFeature)
+
+			if err != nil {
+				p.removeEntry(ctx, entry)
+				return fmt.Errorf("Feature updated by pre-write hooks has invalid media properties, %w", err)
+			}
+
+			_, new_feature, err = p.Exporter.Export(ctx, hc.NewFeature)
+
+			if err != nil {
+				p.removeEntry(ctx, entry)
+				return fmt.Errorf("Failed to re-export feature %s after pre-write hooks, %w", wof_fname, err)
+			}
+		}
+	}
+
+	if p.Dryrun {
+		return p.emitDiff(report_uri, wof_id, wof_path, writer_uri, old_feature, new_feature)
+	}
+
+	entry.WriterURI = writer_uri
+	entry.OldFeature = old_feature
+	entry.NewFeature = new_feature
+
+	err = p.recordStep(ctx, entry, JOURNAL_EXPORTED)
+
+	if err != nil {
+		return err
 	}
 
 	wr, err := writer.NewWriter(ctx, writer_uri)
 
 	if err != nil {
+		p.removeEntry(ctx, entry)
 		return fmt.Errorf("Failed to create writer for report '%s' from writer '%s', %w", report_uri, writer_uri, err)
 	}
 
@@ -285,76 +339,295 @@ func (p *ReportProcessor) ProcessReport(ctx context.Context, report_uri string)
 	feature_readcloser, err := ioutil.NewReadSeekCloser(feature_reader)
 
 	if err != nil {
+		p.removeEntry(ctx, entry)
 		return fmt.Errorf("Failed to create ReadSeekCloser from new feature, %w", err)
 	}
 
 	_, err = wr.Write(ctx, wof_path, feature_readcloser)
 
 	if err != nil {
+		// The write may have partially succeeded but the pending feature is untouched
+		// so the report can be processed again from scratch
+		p.removeEntry(ctx, entry)
 		return fmt.Errorf("Failed to write report to %s, %w", wof_path, err)
 	}
 
+	err = p.recordStep(ctx, entry, JOURNAL_WRITTEN)
+
+	if err != nil {
+		return err
+	}
+
 	// END OF sudo wrap me in a function or something
 
-	if p.Callback != nil {
+	return p.finishReport(ctx, entry)
+}
+
+// finishReport runs the report processing callback and post-write hooks and prunes the report, pending image and
+// pending feature for 'entry', whose feature has already been written, skipping any steps (and hooks) that 'entry'
+// records as done.
+func (p *ReportProcessor) finishReport(ctx context.Context, entry *JournalEntry) error {
+
+	if entry.Step() == JOURNAL_WRITTEN {
+
+		hooks := make([]*Hook, 0)
+
+		if p.Callback != nil {
+			hooks = append(hooks, NewCallbackHook(CALLBACK_HOOK_NAME, p.Callback))
+		}
+
+		hooks = append(hooks, p.PostWriteHooks...)
+
+		hc := &HookContext{
+			ReportURI:  entry.ReportURI,
+			Report:     entry.Report,
+			ID:         entry.ID,
+			Repo:       gjson.GetBytes(entry.NewFeature, "properties.wof:repo").String(),
+			OldFeature: entry.OldFeature,
+			NewFeature: entry.NewFeature,
+			Path:       entry.Path,
+			WriterURI:  entry.WriterURI,
+		}
+
+		done := func(name string) error {
+			entry.Hooks = append(entry.Hooks, name)
+			return p.recordEntry(ctx, entry)
+		}
 
-		err := p.Callback(ctx, process_report, old_feature, new_feature)
+		err := runHooks(ctx, HOOK_POST_WRITE, hooks, hc, entry.Hooks, done)
 
 		if err != nil {
-			return fmt.Errorf("Failed to execute report processing callback, %w", err)
+			return err
+		}
+
+		err = p.recordStep(ctx, entry, JOURNAL_CALLBACK)
+
+		if err != nil {
+			return err
 		}
 	}
 
 	if p.Prune {
 
-		wg := new(sync.WaitGroup)
+		err := p.prune(ctx, entry.ReportURI, entry.Report.Origin, entry.FeatureKey)
 
-		prune_func := func(ctx context.Context, wg *sync.WaitGroup, bucket *blob.Bucket, key string) {
+		if err != nil {
+			// The journal entry is left at the callback step so that pruning is retried by Recover
+			return fmt.Errorf("Failed to prune report '%s', %w", entry.ReportURI, err)
+		}
+	}
 
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				//
-			}
+	err := p.recordStep(ctx, entry, JOURNAL_PRUNED)
 
-			defer wg.Done()
+	if err != nil {
+		return err
+	}
 
-			logger := slog.Default()
-			logger = logger.With("key", key)
+	p.removeEntry(ctx, entry)
+	return nil
+}
 
-			logger.Debug("Prune key")
+// prune removes the report, the pending image and the pending feature associated with a report.
+func (p *ReportProcessor) prune(ctx context.Context, report_uri string, origin string, feature_key string) error {
 
-			exists, err := bucket.Exists(ctx, key)
+	wg := new(sync.WaitGroup)
 
-			if err != nil {
-				logger.Error("Failed to determine if key exists", "error", err)
-				return
-			}
+	errs := make([]error, 3)
 
-			if !exists {
-				return
-			}
+	prune_func := func(idx int, bucket *blob.Bucket, key string) {
+
+		defer wg.Done()
+
+		logger := slog.Default()
+		logger = logger.With("key", key)
+
+		logger.Debug("Prune key")
+
+		exists, err := bucket.Exists(ctx, key)
+
+		if err != nil {
+			errs[idx] = fmt.Errorf("Failed to determine if %s exists, %w", key, err)
+			return
+		}
+
+		if !exists {
+			return
+		}
+
+		err = bucket.Delete(ctx, key)
 
-			err = bucket.Delete(ctx, key)
+		if err != nil {
+			errs[idx] = fmt.Errorf("Failed to delete %s, %w", key, err)
+		}
+	}
+
+	wg.Add(3)
+
+	go prune_func(0, p.Reports, report_uri)  // the processing report
+	go prune_func(1, p.Pending, origin)      // the actual image that got processed
+	go prune_func(2, p.Pending, feature_key) // the corresponding image feature w/out image details
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// validateHooks returns an error if p.PreWriteHooks and p.PostWriteHooks contain invalid or duplicate hooks.
+func (p *ReportProcessor) validateHooks() error {
+
+	hooks := make([]*Hook, 0)
+	hooks = append(hooks, p.PreWriteHooks...)
+	hooks = append(hooks, p.PostWriteHooks...)
+
+	err := validateHooks(hooks...)
+
+	if err != nil {
+		return fmt.Errorf("Invalid hooks, %w", err)
+	}
+
+	return nil
+}
+
+// Recover will finish or roll back any reports that p.Journal records as partially processed, returning the list of
+// report URIs that were finished. Reports whose feature has not been written are rolled back, by removing their journal
+// entry, so that they can be processed again from scratch. Reports whose feature has been written are finished by running
+// the callback (if it has not already completed) and pruning. If p.Journal is nil then Recover does nothing.
+func (p *ReportProcessor) Recover(ctx context.Context) ([]string, error) {
+
+	finished := make([]string, 0)
+
+	if p.Journal == nil {
+		return finished, nil
+	}
+
+	err := p.validateHooks()
+
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, 0)
+
+	for entry, err := range p.Journal.Entries(ctx) {
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		logger := slog.Default()
+		logger = logger.With("report", entry.ReportURI)
+		logger = logger.With("step", entry.Step())
+
+		switch entry.Step() {
+		case JOURNAL_WRITTEN, JOURNAL_CALLBACK:
+
+			logger.Info("Finish partially processed report")
+
+			err := p.finishReport(ctx, entry)
 
 			if err != nil {
-				logger.Error("Failed to delete key", "error", err)
+				errs = append(errs, fmt.Errorf("Failed to finish report '%s', %w", entry.ReportURI, err))
+				continue
 			}
+
+			finished = append(finished, entry.ReportURI)
+
+		case JOURNAL_PRUNED:
+
+			p.removeEntry(ctx, entry)
+			finished = append(finished, entry.ReportURI)
+
+		default:
+
+			logger.Info("Roll back partially processed report")
+			p.removeEntry(ctx, entry)
 		}
+	}
 
-		wg.Add(3)
+	return finished, errors.Join(errs...)
+}
+
+// recordStep adds 's' to 'entry' and records it in p.Journal, if defined. Journal writes are not cancelled by 'ctx' so
+// that the journal reflects any work that has already been done.
+func (p *ReportProcessor) recordStep(ctx context.Context, entry *JournalEntry, s JournalStep) error {
 
-		go prune_func(ctx, wg, p.Reports, report_uri)            // the processing report
-		go prune_func(ctx, wg, p.Pending, process_report.Origin) // the actual image that got processed
-		go prune_func(ctx, wg, p.Pending, wof_fname)             // the corresponding image feature w/out image details
+	entry.AddStep(s)
 
-		wg.Wait()
+	err := p.recordEntry(ctx, entry)
+
+	if err != nil {
+		return fmt.Errorf("Failed to record %s step, %w", s, err)
 	}
 
 	return nil
 }
 
+// recordEntry records 'entry' in p.Journal, if defined. Journal writes are not cancelled by 'ctx' so that the journal
+// reflects any work that has already been done.
+func (p *ReportProcessor) recordEntry(ctx context.Context, entry *JournalEntry) error {
+
+	if p.Journal == nil {
+		return nil
+	}
+
+	err := p.Journal.Record(context.WithoutCancel(ctx), entry)
+
+	if err != nil {
+		return fmt.Errorf("Failed to record journal entry for report '%s', %w", entry.ReportURI, err)
+	}
+
+	return nil
+}
+
+// expandRepo replaces the string "{repo}" in 'uri' with 'repo'.
+func expandRepo(uri string, repo string) string {
+	return strings.Replace(uri, "{repo}", repo, 1)
+}
+
+// removeEntry removes 'entry' from p.Journal, if defined, logging any errors.
+func (p *ReportProcessor) removeEntry(ctx context.Context, entry *JournalEntry) {
+
+	if p.Journal == nil || entry == nil {
+		return
+	}
+
+	err := p.Journal.Remove(context.WithoutCancel(ctx), entry.ReportURI)
+
+	if err != nil {
+		slog.Error("Failed to remove journal entry", "report", entry.ReportURI, "error", err)
+	}
+}
+
+// emitDiff writes a FeatureDiff describing the changes between 'old_feature' and 'new_feature' to p.DiffWriter or, if it
+// is nil, logs it.
+func (p *ReportProcessor) emitDiff(report_uri string, wof_id int64, wof_path string, writer_uri string, old_feature []byte, new_feature []byte) error {
+
+	changes, err := DiffProperties(old_feature, new_feature)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive diff for %s, %w", wof_path, err)
+	}
+
+	diff := &FeatureDiff{
+		Report:    report_uri,
+		ID:        wof_id,
+		Path:      wof_path,
+		WriterURI: writer_uri,
+		Changes:   changes,
+	}
+
+	if p.DiffWriter == nil {
+		slog.Info("DRYRUN write feature here", "report", report_uri, "path", wof_path, "writer", writer_uri, "changes", changedProperties(changes))
+		return nil
+	}
+
+	p.diff_mu.Lock()
+	defer p.diff_mu.Unlock()
+
+	return writeFeatureDiff(p.DiffWriter, diff)
+}
+
 // appendReport will append properties from `report` to `body`.
 func (p *ReportProcessor) appendReport(body []byte, report *IIIFProcessReport) ([]byte, error) {
 
@@ -369,20 +642,10 @@ func (p *ReportProcessor) appendReport(body []byte, report *IIIFProcessReport) (
 
 	logger.Debug("Append report")
 
-	updates := map[string]interface{}{
-		"properties.media:fingerprint":        report.OriginFingerprint,
-		"properties.media:properties.colours": report.Palette,
-	}
-
-	var err error
+	mp, err := properties.Unmarshal(body)
 
-	for path, value := range updates {
-
-		body, err = sjson.SetBytes(body, path, value)
-
-		if err != nil {
-			return nil, fmt.Errorf("Failed to update %s property for record, %w", path, err)
-		}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive media properties, %w", err)
 	}
 
 	sizes := make(map[string]MediaPropertiesSize)
@@ -399,60 +662,54 @@ func (p *ReportProcessor) appendReport(body []byte, report *IIIFProcessReport) (
 			continue
 		}
 
-		fname := filepath.Base(u)
-		ext := filepath.Ext(fname)
-
-		mimetype := mime.TypeByExtension(ext)
+		fname, err := filename.Parse(u)
 
-		if mimetype == "" {
-			logger.Debug("Unknown mimetype, skipping", "filename", fname, "ext", ext)
-			continue
+		if err != nil {
+			return nil, fmt.Errorf("Report URI for '%s' has an invalid filename, %w", k, err)
 		}
 
-		ext = strings.TrimLeft(ext, ".")
-
-		// THIS IS DUMB... PLEASE STOP DOING THIS...
-		// USE A PROPER REGEXP OR FIGURE OUT HOW/WHERE
-		// TO STORE SECRETS IN THE _r FILE...
-		// (20190206/thisisaaronland)
+		mimetype, ok := properties.MimetypeForExtension(fname.Extension)
 
-		parts := strings.Split(fname, "_")
-		secret := parts[1]
+		if !ok {
+			logger.Debug("Unknown mimetype, skipping", "filename", fname.String(), "ext", fname.Extension)
+			continue
+		}
 
 		sz := MediaPropertiesSize{
 			Mimetype:  mimetype,
-			Extension: ext,
+			Extension: fname.Extension,
 			Width:     int(width),
 			Height:    int(height),
-			Secret:    secret,
+			Secret:    fname.Secret,
 		}
 
 		sizes[k] = sz
 	}
 
-	updates = map[string]interface{}{
-		"properties.media:properties.sizes": sizes,
-		"properties.media:status_id":        1,
-	}
+	err = applyOriginFingerprint(id_rsp.Int(), mp, report, p.FingerprintPolicy)
 
-	for path, value := range updates {
+	if err != nil {
+		return nil, err
+	}
 
-		body, err = sjson.SetBytes(body, path, value)
+	// Reports without a palette (for example because palette extraction was not enabled) leave existing colours alone
 
-		if err != nil {
-			return nil, fmt.Errorf("Failed to assign %s property, %w", path, err)
-		}
+	if len(report.Palette) > 0 {
+		mp.Details.Colours = report.Palette
 	}
 
-	source_rsp := gjson.GetBytes(body, "properties.media:source")
+	mp.ReplaceSizes(sizes, "process")
 
-	if !source_rsp.Exists() {
+	body, err = mp.Marshal(body)
 
-		body, err = sjson.SetBytes(body, "properties.media:source", "unknown")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to assign media properties, %w", err)
+	}
 
-		if err != nil {
-			return nil, fmt.Errorf("Failed to assign properties.media:source property, %w", err)
-		}
+	body, err = status.MarkProcessed(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update status, %w", err)
 	}
 
 	if p.URITemplateFunc != nil {
@@ -464,6 +721,12 @@ func (p *ReportProcessor) appendReport(body []byte, report *IIIFProcessReport) (
 		}
 	}
 
+	err = properties.ValidateFeature(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Updated feature has invalid media properties, %w", err)
+	}
+
 	logger.Debug("Finished appending report")
 	return body, nil
 }
@@ -0,0 +1,461 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gocloud.dev/blob"
+)
+
+// DEFAULT_POLL_INTERVAL is the default interval at which ReportSource implementations check for new reports.
+const DEFAULT_POLL_INTERVAL time.Duration = 30 * time.Second
+
+// ReportSource is an interface for discovering the URIs (keys) of reports, in a reports bucket, that are ready to be processed.
+type ReportSource interface {
+	// Reports returns an iterator of report URIs. The iterator blocks waiting for new reports until the context is cancelled.
+	// The same report URI may be yielded more than once; it is the responsibility of the caller to de-duplicate them.
+	Reports(context.Context) iter.Seq2[string, error]
+	// Close releases any resources used by the source.
+	Close() error
+}
+
+// ReportAcknowledger is an optional interface for ReportSource implementations that need to know when a report they have
+// yielded has been processed, and marked as such, for example in order to remove the notification it was read from.
+type ReportAcknowledger interface {
+	// Acknowledge records that the report URI has been processed.
+	Acknowledge(context.Context, string) error
+}
+
+// ReportSourceInitializeFunc is a function used to create a new ReportSource instance for a URI and the bucket where reports are stored.
+type ReportSourceInitializeFunc func(ctx context.Context, uri string, reports *blob.Bucket) (ReportSource, error)
+
+var report_sources = make(map[string]ReportSourceInitializeFunc)
+var report_sources_mu = new(sync.RWMutex)
+
+func init() {
+
+	ctx := context.Background()
+
+	err := RegisterReportSource(ctx, "poll", NewPollingReportSource)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = RegisterReportSource(ctx, "filequeue", NewFileQueueReportSource)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegisterReportSource will register 'init_func' for ReportSource URIs whose scheme is 'scheme'. It returns an error if
+// a ReportSource has already been registered for 'scheme'.
+func RegisterReportSource(ctx context.Context, scheme string, init_func ReportSourceInitializeFunc) error {
+
+	report_sources_mu.Lock()
+	defer report_sources_mu.Unlock()
+
+	scheme = strings.ToLower(scheme)
+
+	_, exists := report_sources[scheme]
+
+	if exists {
+		return fmt.Errorf("Report source for '%s' scheme already registered", scheme)
+	}
+
+	report_sources[scheme] = init_func
+	return nil
+}
+
+// ReportSourceSchemes returns the list of schemes that have registered ReportSource implementations.
+func ReportSourceSchemes() []string {
+
+	report_sources_mu.RLock()
+	defer report_sources_mu.RUnlock()
+
+	schemes := make([]string, 0)
+
+	for s := range report_sources {
+		schemes = append(schemes, fmt.Sprintf("%s://", s))
+	}
+
+	sort.Strings(schemes)
+	return schemes
+}
+
+// NewReportSource returns a new ReportSource instance for 'uri', whose scheme must have been registered using
+// RegisterReportSource, for reports stored in 'reports'.
+func NewReportSource(ctx context.Context, uri string, reports *blob.Bucket) (ReportSource, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse report source URI, %w", err)
+	}
+
+	report_sources_mu.RLock()
+	init_func, ok := report_sources[strings.ToLower(u.Scheme)]
+	report_sources_mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unsupported report source '%s'", u.Scheme)
+	}
+
+	return init_func(ctx, uri, reports)
+}
+
+// PollingReportSource is a ReportSource implementation that periodically lists the keys in a reports bucket.
+type PollingReportSource struct {
+	bucket   *blob.Bucket
+	prefix   string
+	suffix   string
+	interval time.Duration
+}
+
+// NewPollingReportSource returns a new PollingReportSource instance for 'reports' configured by 'uri', which is expected
+// to take the form of:
+//
+//	poll://?{PARAMETERS}
+//
+// Where {PARAMETERS} may be:
+// * `interval` – A time.Duration string for how often to list the bucket. Default is DEFAULT_POLL_INTERVAL.
+// * `prefix` – Only list keys with this prefix.
+// * `suffix` – Only yield keys with this suffix (for example "report.json").
+func NewPollingReportSource(ctx context.Context, uri string, reports *blob.Bucket) (ReportSource, error) {
+
+	if reports == nil {
+		return nil, fmt.Errorf("Missing reports bucket")
+	}
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	interval, err := parseInterval(q.Get("interval"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &PollingReportSource{
+		bucket:   reports,
+		prefix:   q.Get("prefix"),
+		suffix:   q.Get("suffix"),
+		interval: interval,
+	}
+
+	return s, nil
+}
+
+// Reports returns an iterator of the keys in the reports bucket, listing the bucket every 'interval' until 'ctx' is cancelled.
+func (s *PollingReportSource) Reports(ctx context.Context) iter.Seq2[string, error] {
+
+	return func(yield func(string, error) bool) {
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+
+			list_opts := &blob.ListOptions{
+				Prefix: s.prefix,
+			}
+
+			iter := s.bucket.List(list_opts)
+
+			for {
+
+				obj, err := iter.Next(ctx)
+
+				if err == io.EOF {
+					break
+				}
+
+				if err != nil {
+
+					if ctx.Err() != nil {
+						return
+					}
+
+					if !yield("", fmt.Errorf("Failed to list reports, %w", err)) {
+						return
+					}
+
+					break
+				}
+
+				if obj.IsDir {
+					continue
+				}
+
+				if s.suffix != "" && !strings.HasSuffix(obj.Key, s.suffix) {
+					continue
+				}
+
+				if !yield(obj.Key, nil) {
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// pass
+			}
+		}
+	}
+}
+
+// Close is a no-op; the reports bucket is owned by the caller.
+func (s *PollingReportSource) Close() error {
+	return nil
+}
+
+// FileQueueReportSource is a ReportSource implementation, intended for testing and local development, that reads report
+// URIs from files in a local directory. Each file contains one report URI per line and is removed once every report URI
+// it contains has been acknowledged (see ReportAcknowledger). Files are read again, each interval, until they are removed.
+type FileQueueReportSource struct {
+	root     string
+	interval time.Duration
+	// The report URIs in each file that have not been acknowledged yet, keyed by path
+	pending map[string]map[string]bool
+	mu      *sync.Mutex
+}
+
+// NewFileQueueReportSource returns a new FileQueueReportSource instance configured by 'uri', which is expected to take
+// the form of:
+//
+//	filequeue://{PATH}?{PARAMETERS}
+//
+// Where {PATH} is the directory to read notification files from and {PARAMETERS} may be:
+// * `interval` – A time.Duration string for how often to check the directory. Default is DEFAULT_POLL_INTERVAL.
+func NewFileQueueReportSource(ctx context.Context, uri string, reports *blob.Bucket) (ReportSource, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	root := filepath.Join(u.Host, u.Path)
+
+	if root == "" || root == "." {
+		return nil, fmt.Errorf("Missing file queue path")
+	}
+
+	info, err := os.Stat(root)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to stat %s, %w", root, err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	interval, err := parseInterval(u.Query().Get("interval"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileQueueReportSource{
+		root:     root,
+		interval: interval,
+		pending:  make(map[string]map[string]bool),
+		mu:       new(sync.Mutex),
+	}
+
+	return s, nil
+}
+
+// Reports returns an iterator of the report URIs read from files in the queue directory, checking the directory every
+// 'interval' until 'ctx' is cancelled. Files are read in lexical order.
+func (s *FileQueueReportSource) Reports(ctx context.Context) iter.Seq2[string, error] {
+
+	return func(yield func(string, error) bool) {
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+
+			entries, err := os.ReadDir(s.root)
+
+			if err != nil {
+
+				if !yield("", fmt.Errorf("Failed to read file queue, %w", err)) {
+					return
+				}
+			}
+
+			for _, e := range entries {
+
+				if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+					continue
+				}
+
+				path := filepath.Join(s.root, e.Name())
+
+				uris, err := s.readQueueFile(path)
+
+				if err != nil {
+
+					if !yield("", err) {
+						return
+					}
+
+					continue
+				}
+
+				for _, report_uri := range uris {
+
+					if !yield(report_uri, nil) {
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// pass
+			}
+		}
+	}
+}
+
+// readQueueFile returns the report URIs in 'path' and records them as pending. Files without any report URIs are removed.
+func (s *FileQueueReportSource) readQueueFile(path string) ([]string, error) {
+
+	r, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s, %w", path, err)
+	}
+
+	defer r.Close()
+
+	uris := make([]string, 0)
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		report_uri := strings.TrimSpace(scanner.Text())
+
+		if report_uri == "" {
+			continue
+		}
+
+		uris = append(uris, report_uri)
+	}
+
+	err = scanner.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s, %w", path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(uris) == 0 {
+
+		delete(s.pending, path)
+
+		err = os.Remove(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to remove %s, %w", path, err)
+		}
+
+		return uris, nil
+	}
+
+	pending := make(map[string]bool)
+
+	for _, report_uri := range uris {
+		pending[report_uri] = true
+	}
+
+	s.pending[path] = pending
+
+	slog.Debug("Read file queue notification", "path", path, "count", len(uris))
+	return uris, nil
+}
+
+// Acknowledge records that 'report_uri' has been processed. Files whose report URIs have all been acknowledged are removed.
+func (s *FileQueueReportSource) Acknowledge(ctx context.Context, report_uri string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for path, pending := range s.pending {
+
+		if !pending[report_uri] {
+			continue
+		}
+
+		delete(pending, report_uri)
+
+		if len(pending) > 0 {
+			continue
+		}
+
+		delete(s.pending, path)
+
+		err := os.Remove(path)
+
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove %s, %w", path, err)
+		}
+
+		slog.Debug("Removed file queue notification", "path", path)
+	}
+
+	return nil
+}
+
+// Close is a no-op.
+func (s *FileQueueReportSource) Close() error {
+	return nil
+}
+
+// parseInterval returns the time.Duration for 'str', or DEFAULT_POLL_INTERVAL if 'str' is empty.
+func parseInterval(str string) (time.Duration, error) {
+
+	if str == "" {
+		return DEFAULT_POLL_INTERVAL, nil
+	}
+
+	d, err := time.ParseDuration(str)
+
+	if err != nil {
+		return 0, fmt.Errorf("Invalid interval '%s', %w", str, err)
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("Invalid interval '%s', must be greater than zero", str)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,209 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+)
+
+// WatchOptions is a struct containing configuration details for watching a reports bucket.
+type WatchOptions struct {
+	// The ReportProcessor used to process new reports.
+	Processor *ReportProcessor
+	// The ReportSource used to discover new reports.
+	Source ReportSource
+	// The MarkerStore used to record which reports have been processed.
+	Markers MarkerStore
+	// The maximum number of reports to process concurrently. If 0 then common.DEFAULT_WORKERS is used.
+	Workers int
+}
+
+// Watch will process each new report yielded by opts.Source with opts.Processor until 'ctx' is cancelled. Reports that
+// opts.Markers records as processed are skipped and reports are marked as processed once they have been processed
+// successfully. Reports that fail to process are logged, not marked, and will be retried the next time they are yielded
+// by opts.Source. Reports are never marked as processed if opts.Processor is in "dry run" mode. If opts.Processor has a
+// Journal then any partially processed reports are recovered, and finished reports marked as processed, before watching
+// for new reports. Watch returns nil when 'ctx' is cancelled or opts.Source stops yielding reports.
+func Watch(ctx context.Context, opts *WatchOptions) error {
+
+	if opts.Processor == nil {
+		return fmt.Errorf("Missing report processor")
+	}
+
+	if opts.Source == nil {
+		return fmt.Errorf("Missing report source")
+	}
+
+	if opts.Markers == nil {
+		return fmt.Errorf("Missing marker store")
+	}
+
+	err := opts.Processor.validateHooks()
+
+	if err != nil {
+		return err
+	}
+
+	if opts.Processor.Journal != nil && !opts.Processor.Dryrun {
+
+		finished, err := opts.Processor.Recover(ctx)
+
+		if err != nil {
+			slog.Error("Failed to recover one or more reports", "error", err)
+		}
+
+		for _, report_uri := range finished {
+
+			err := opts.Markers.MarkProcessed(context.WithoutCancel(ctx), report_uri)
+
+			if err != nil {
+				slog.Error("Failed to mark recovered report as processed", "report", report_uri, "error", err)
+			}
+		}
+	}
+
+	workers := opts.Workers
+
+	if workers <= 0 {
+		workers = common.DEFAULT_WORKERS
+	}
+
+	// Report URIs that are currently being processed; sources may yield
+	// the same report again before it has finished being processed
+
+	in_flight := make(map[string]bool)
+	in_flight_mu := new(sync.Mutex)
+
+	// Reports processed in "dry run" mode are not marked as processed so
+	// remember them here to avoid emitting the same diff more than once
+
+	dryrun_done := make(map[string]bool)
+
+	throttle := make(chan bool, workers)
+	wg := new(sync.WaitGroup)
+
+	for report_uri, err := range opts.Source.Reports(ctx) {
+
+		if err != nil {
+			slog.Error("Report source returned an error", "error", err)
+			continue
+		}
+
+		logger := slog.Default()
+		logger = logger.With("report", report_uri)
+
+		in_flight_mu.Lock()
+
+		if in_flight[report_uri] || dryrun_done[report_uri] {
+			in_flight_mu.Unlock()
+			continue
+		}
+
+		in_flight[report_uri] = true
+		in_flight_mu.Unlock()
+
+		release := func() {
+			in_flight_mu.Lock()
+			delete(in_flight, report_uri)
+			in_flight_mu.Unlock()
+		}
+
+		processed, err := opts.Markers.IsProcessed(ctx, report_uri)
+
+		if err != nil {
+			logger.Error("Failed to determine if report has been processed", "error", err)
+			release()
+			continue
+		}
+
+		if processed {
+			logger.Debug("Report has already been processed")
+			acknowledge(ctx, opts.Source, report_uri)
+			release()
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			release()
+			continue
+		case throttle <- true:
+			// pass
+		}
+
+		wg.Add(1)
+
+		go func(report_uri string) {
+
+			defer func() {
+				release()
+				<-throttle
+				wg.Done()
+			}()
+
+			// ProcessReport returns the context's error (without doing anything) if
+			// the context has been cancelled so a nil response always means the
+			// report was processed and can be marked as such
+
+			err := opts.Processor.ProcessReport(ctx, report_uri)
+
+			if err != nil {
+
+				if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+					logger.Debug("Report not processed, context cancelled")
+					return
+				}
+
+				logger.Error("Failed to process report", "error", err)
+				return
+			}
+
+			// Reports processed in "dry run" mode have not actually been applied
+
+			if opts.Processor.Dryrun {
+				in_flight_mu.Lock()
+				dryrun_done[report_uri] = true
+				in_flight_mu.Unlock()
+				return
+			}
+
+			// Always record the marker, even if the context has been cancelled in the
+			// meantime, so that the report is not processed again after a restart
+
+			err = opts.Markers.MarkProcessed(context.WithoutCancel(ctx), report_uri)
+
+			if err != nil {
+				logger.Error("Failed to mark report as processed", "error", err)
+				return
+			}
+
+			acknowledge(ctx, opts.Source, report_uri)
+
+			logger.Info("Processed report")
+
+		}(report_uri)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// acknowledge will acknowledge 'report_uri' if 'source' implements the ReportAcknowledger interface.
+func acknowledge(ctx context.Context, source ReportSource, report_uri string) {
+
+	ack, ok := source.(ReportAcknowledger)
+
+	if !ok {
+		return
+	}
+
+	err := ack.Acknowledge(context.WithoutCancel(ctx), report_uri)
+
+	if err != nil {
+		slog.Error("Failed to acknowledge report", "report", report_uri, "error", err)
+	}
+}
@@ -8,11 +8,15 @@ import (
 	"io"
 	"log/slog"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/filename"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"github.com/sfomuseum/go-whosonfirst-media/status"
 	"github.com/tidwall/sjson"
 	"github.com/whosonfirst/go-ioutil"
 	"github.com/whosonfirst/go-whosonfirst-export/v3"
@@ -30,7 +34,9 @@ type Removal struct {
 	Exporter export.Exporter
 	// A boolean flag indicating whether to perform a removal in "dry run" mode.
 	Dryrun bool
-	mu     *sync.RWMutex
+	// The maximum number of removal requests to process concurrently. If 0 then common.DEFAULT_WORKERS is used.
+	Workers int
+	mu      *sync.RWMutex
 }
 
 // type RemovalRequest provides encapsulating data for removing a given media file.
@@ -57,61 +63,36 @@ func NewRemoval(ex export.Exporter) (*Removal, error) {
 	return c, nil
 }
 
-// Remove will process one or more RemovalRequest instances (to remove media files)
+// Remove will process one or more RemovalRequest instances (to remove media files), processing up to c.Workers requests concurrently.
 func (c *Removal) Remove(ctx context.Context, requests ...*RemovalRequest) error {
 
-	remaining := len(requests)
+	ex := common.NewExecutor(&common.ExecutorOptions{
+		Workers: c.Workers,
+	})
 
-	done_ch := make(chan bool)
-	removed_ch := make(chan int64)
-	err_ch := make(chan error)
+	remove_func := func(ctx context.Context, idx int) error {
 
-	for _, req := range requests {
+		req := requests[idx]
 
-		go func(req *RemovalRequest) {
+		err := c.remove(ctx, req)
 
-			defer func() {
-				done_ch <- true
-			}()
-
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				// pass
-			}
-
-			err := c.remove(ctx, req)
-
-			if err != nil {
-				err_ch <- fmt.Errorf("failed to remove %d because %s\n", req.Id, err)
-				return
-			}
-
-			removed_ch <- req.Id
-		}(req)
-	}
-
-	for remaining > 0 {
-
-		select {
-		case <-done_ch:
-			remaining -= 1
-		case id := <-removed_ch:
-			slog.Debug("Removed ID", "id", id)
-		case err := <-err_ch:
-			slog.Error("Remove channel received an error", "error", err)
-		default:
-			// pass
+		if err != nil {
+			return err
 		}
+
+		slog.Debug("Removed ID", "id", req.Id)
+		return nil
 	}
 
-	return nil
+	return ex.Execute(ctx, len(requests), remove_func)
 }
 
 func (c *Removal) remove(ctx context.Context, req *RemovalRequest) error {
 
-	err := c.deprecateMedia(ctx, req)
+	// The feature is only marked as REMOVED once its media files have been
+	// deleted so that, if deleting them fails, the removal can be retried
+
+	err := c.updateFeature(ctx, req, c.deprecateFeature)
 
 	if err != nil {
 		return fmt.Errorf("Failed to deprecate media for %d, %w", req.Id, err)
@@ -123,10 +104,17 @@ func (c *Removal) remove(ctx context.Context, req *RemovalRequest) error {
 		return fmt.Errorf("Failed to delete media files for %d, %w", req.Id, err)
 	}
 
+	err = c.updateFeature(ctx, req, status.MarkRemoved)
+
+	if err != nil {
+		return fmt.Errorf("Failed to mark media for %d as removed, %w", req.Id, err)
+	}
+
 	return nil
 }
 
-func (c *Removal) deprecateMedia(ctx context.Context, req *RemovalRequest) error {
+// updateFeature will read the feature for 'req', apply 'update_func' to it, export it and write it back.
+func (c *Removal) updateFeature(ctx context.Context, req *RemovalRequest, update_func func([]byte) ([]byte, error)) error {
 
 	id := req.Id
 
@@ -162,35 +150,43 @@ func (c *Removal) deprecateMedia(ctx context.Context, req *RemovalRequest) error
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	old, err := rdr.Read(ctx, rel_path)
+	r, err := rdr.Read(ctx, rel_path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read %s, %w", rel_path, err)
+	}
+
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
 
 	if err != nil {
 		return fmt.Errorf("Failed to read body for %s, %w", rel_path, err)
 	}
 
-	new, err := c.deprecateFeature(old)
+	body, err = update_func(body)
 
 	if err != nil {
-		return fmt.Errorf("Failed to deprecated %s, %w", rel_path, err)
+		return fmt.Errorf("Failed to update %s, %w", rel_path, err)
 	}
 
-	body, err := io.ReadAll(new)
+	err = properties.ValidateFeature(body)
 
 	if err != nil {
-		return fmt.Errorf("Failed to read body for deprecated feature (%s), %w", rel_path, err)
+		return fmt.Errorf("Updated feature (%s) has invalid media properties, %w", rel_path, err)
 	}
 
 	_, body, err = c.Exporter.Export(ctx, body)
 
 	if err != nil {
-		return fmt.Errorf("Failed to export deprecated feature (%s), %w", rel_path, err)
+		return fmt.Errorf("Failed to export updated feature (%s), %w", rel_path, err)
 	}
 
 	br := bytes.NewReader(body)
 	fh, err := ioutil.NewReadSeekCloser(br)
 
 	if err != nil {
-		return fmt.Errorf("Failed to create ReadSeekCloser for deprecated feature (%s), %w", rel_path, err)
+		return fmt.Errorf("Failed to create ReadSeekCloser for updated feature (%s), %w", rel_path, err)
 	}
 
 	if c.Dryrun {
@@ -199,7 +195,7 @@ func (c *Removal) deprecateMedia(ctx context.Context, req *RemovalRequest) error
 		_, err = wr.Write(ctx, rel_path, fh)
 
 		if err != nil {
-			return fmt.Errorf("Failed to write deprecated feature %s, %w", rel_path, err)
+			return fmt.Errorf("Failed to write updated feature %s, %w", rel_path, err)
 		}
 	}
 
@@ -224,12 +220,18 @@ func (c *Removal) deleteMediaFiles(ctx context.Context, req *RemovalRequest) err
 
 	root := filepath.Dir(rel_path)
 
+	// Include the trailing separator so that files belonging to IDs
+	// which share the same leading digits are not listed
+
 	list_opts := &blob.ListOptions{
-		Prefix: root,
+		Prefix: root + "/",
 	}
 
 	iter := bucket.List(list_opts)
 
+	str_id := strconv.FormatInt(req.Id, 10)
+	keys := make([]string, 0)
+
 	for {
 		obj, err := iter.Next(ctx)
 
@@ -241,13 +243,39 @@ func (c *Removal) deleteMediaFiles(ctx context.Context, req *RemovalRequest) err
 			return fmt.Errorf("Bucket iterator triggered an error, %w", err)
 		}
 
+		if obj.IsDir {
+			continue
+		}
+
+		// Ensure every file is a media file for this ID before anything is deleted. Temporary
+		// and backup files left behind by an interrupted write are removed along with the
+		// media file they belong to.
+
+		name, _ := filename.TrimTemporarySuffix(obj.Key)
+
+		fname, err := filename.Parse(name)
+
+		if err != nil {
+			slog.Warn("Skipping file which is not a media file", "id", req.Id, "key", obj.Key, "error", err)
+			continue
+		}
+
+		if fname.ID != str_id {
+			return fmt.Errorf("Unexpected file %s, ID does not match %d", obj.Key, req.Id)
+		}
+
+		keys = append(keys, obj.Key)
+	}
+
+	for _, key := range keys {
+
 		if c.Dryrun {
-			slog.Info("DRYRUN delete key", "key", obj.Key)
+			slog.Info("DRYRUN delete key", "key", key)
 		} else {
-			err = bucket.Delete(ctx, obj.Key)
+			err = bucket.Delete(ctx, key)
 
 			if err != nil {
-				return fmt.Errorf("Failed to delete %s, %w", obj.Key, err)
+				return fmt.Errorf("Failed to delete %s, %w", key, err)
 			}
 		}
 	}
@@ -258,13 +286,11 @@ func (c *Removal) deleteMediaFiles(ctx context.Context, req *RemovalRequest) err
 	return nil
 }
 
-func (c *Removal) deprecateFeature(r io.ReadCloser) (io.ReadCloser, error) {
+// deprecateFeature will mark the feature 'body' as deprecated, remove its derivative sizes and colours and move it to
+// the DEPRECATED state.
+func (c *Removal) deprecateFeature(body []byte) ([]byte, error) {
 
-	body, err := io.ReadAll(r)
-
-	if err != nil {
-		return nil, fmt.Errorf("Failed to read body from feature, %w", err)
-	}
+	var err error
 
 	now := time.Now()
 
@@ -283,20 +309,26 @@ func (c *Removal) deprecateFeature(r io.ReadCloser) (io.ReadCloser, error) {
 		}
 	}
 
-	remove := []string{
-		"properties.media:properties.sizes",
-		"properties.media:properties.colours",
+	mp, err := properties.Unmarshal(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive media properties, %w", err)
 	}
 
-	for _, path := range remove {
+	mp.ReplaceSizes(nil, "remove")
+	mp.Details.Colours = nil
 
-		body, err = sjson.DeleteBytes(body, path)
+	body, err = mp.Marshal(body)
 
-		if err != nil {
-			return nil, fmt.Errorf("Failed to remove %s property, %w", path, err)
-		}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to assign media properties, %w", err)
+	}
+
+	body, err = status.MarkDeprecated(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update status, %w", err)
 	}
 
-	new_r := bytes.NewReader(body)
-	return ioutil.NewReadSeekCloser(new_r)
+	return body, nil
 }
@@ -1,8 +1,6 @@
 // package rotate provides common methods for rotating image files.
 package rotate
 
-// THIS NEEDS TO BE UPDATED TO USE aws-sdk-go-v2
-
 import (
 	"bytes"
 	"context"
@@ -14,15 +12,15 @@ import (
 	"log"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/aaronland/go-image-tools/imaging"
 	"github.com/aaronland/go-image-tools/util"
 	"github.com/aaronland/go-string/random"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/sfomuseum/go-whosonfirst-media/common"
-	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
+	"github.com/sfomuseum/go-whosonfirst-media/filename"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"github.com/sfomuseum/go-whosonfirst-media/status"
 	"github.com/whosonfirst/go-ioutil"
 	"github.com/whosonfirst/go-whosonfirst-export/v3"
 	"github.com/whosonfirst/go-whosonfirst-uri"
@@ -35,10 +33,27 @@ type Rotation struct {
 	DataSource string
 	// MediaSource is a valid gocloud.dev/blob Bucket URI where media files are stored.
 	MediaSource string
+	// An optional gocloud.dev/blob Bucket instance where media files are stored. If set it is used instead of MediaSource,
+	// for example with gocloud.dev/blob/memblob buckets which can not be reopened by URI. It is not closed by Rotate.
+	MediaBucket *blob.Bucket
 	// A valid whosonfirst/go-whosonfirst-export Exporter for exporting Who's On First feature records.
 	Exporter export.Exporter
 	// A boolean flag indicating whether to perform a removal in "dry run" mode.
 	Dryrun bool
+	// A common.WritePolicy used to derive the options (content type, cache headers, metadata and driver-specific options
+	// like ACLs) for rotated media files. If nil then common.DefaultWritePolicy is used. NewRotation assigns the policy
+	// returned by NewPublicReadWritePolicy.
+	WritePolicy common.WritePolicy
+	// The maximum number of rotation requests, and derivatives for each request, to rotate concurrently. If 0 then
+	// common.DEFAULT_WORKERS is used.
+	Workers int
+	// A boolean flag indicating whether to rotate only the original ("o") media file and regenerate every other size from
+	// it, rather than rotating (and re-encoding) each size independently.
+	Regenerate bool
+	// The size rules used to regenerate derivatives when Regenerate is true. Sizes whose labels are not present are
+	// regenerated using the rules inferred from their existing dimensions: derivatives that are square, when the original
+	// is not, are cropped to a square and all other derivatives are resized to their existing maximum dimension.
+	Sizes []*common.GenerateSize
 }
 
 // type RotateRequest provides a struct encapsulating data for rotating a given media file.
@@ -79,24 +94,33 @@ func NewRotation(ex export.Exporter) (*Rotation, error) {
 		MediaSource: "",
 		Exporter:    ex,
 		Dryrun:      false,
+		WritePolicy: NewPublicReadWritePolicy(),
 	}
 
 	return r, nil
 }
 
-// Rotate will rotate one or more media files defined in 'requests'.
+// Rotate will rotate one or more media files defined in 'requests', processing up to r.Workers requests concurrently.
 func (r *Rotation) Rotate(ctx context.Context, requests ...*RotateRequest) error {
 
-	for _, req := range requests {
+	ex := common.NewExecutor(&common.ExecutorOptions{
+		Workers: r.Workers,
+	})
+
+	rotate_func := func(ctx context.Context, idx int) error {
+
+		req := requests[idx]
 
 		err := r.rotate(ctx, req)
 
 		if err != nil {
-			return err
+			return fmt.Errorf("Failed to rotate media for %d, %w", req.Id, err)
 		}
+
+		return nil
 	}
 
-	return nil
+	return ex.Execute(ctx, len(requests), rotate_func)
 }
 
 func (r *Rotation) rotate(ctx context.Context, req *RotateRequest) error {
@@ -142,13 +166,19 @@ func (r *Rotation) rotate(ctx context.Context, req *RotateRequest) error {
 		return err
 	}
 
-	bucket, err := blob.OpenBucket(ctx, r.MediaSource)
+	bucket := r.MediaBucket
 
-	if err != nil {
-		return err
-	}
+	if bucket == nil {
 
-	defer bucket.Close()
+		b, err := blob.OpenBucket(ctx, r.MediaSource)
+
+		if err != nil {
+			return err
+		}
+
+		defer b.Close()
+		bucket = b
+	}
 
 	fh, err := rdr.Read(ctx, rel_path)
 
@@ -164,20 +194,18 @@ func (r *Rotation) rotate(ctx context.Context, req *RotateRequest) error {
 		return err
 	}
 
-	sizes := gjson.GetBytes(body, "properties.media:properties.sizes")
+	mp, err := properties.Unmarshal(body)
+
+	if err != nil {
+		return err
+	}
 
-	if !sizes.Exists() {
+	if len(mp.Details.Sizes) == 0 {
 		return errors.New("Missing properties.media:properties.sizes")
 	}
 
 	wof_id := req.Id
 
-	remaining := 0
-
-	done_ch := make(chan bool)
-	err_ch := make(chan error)
-	rsp_ch := make(chan *RotateResponse)
-
 	rand_opts := random.DefaultOptions()
 	rand_opts.AlphaNumeric = true
 
@@ -193,75 +221,169 @@ func (r *Rotation) rotate(ctx context.Context, req *RotateRequest) error {
 		return err
 	}
 
-	for label, details := range sizes.Map() {
+	root, err := uri.Id2Path(wof_id)
+
+	if err != nil {
+		return err
+	}
+
+	// Derive the old and new paths for every derivative before anything is rotated
+
+	type rotateTask struct {
+		label     string
+		extension string
+		secret    string
+		old_path  string
+		new_path  string
+		size      *common.GenerateSize
+	}
 
-		secret_rsp := details.Get("secret")
+	var original *rotateTask
 
-		if !secret_rsp.Exists() {
+	tasks := make([]*rotateTask, 0)
+
+	for label, details := range mp.Details.Sizes {
+
+		if details.Secret == "" {
 			return errors.New("Missing secret")
 		}
 
-		extension_rsp := details.Get("extension")
-
-		if !extension_rsp.Exists() {
+		if details.Extension == "" {
 			return errors.New("Missing extension")
 		}
 
-		secret := secret_rsp.String()
-		extension := extension_rsp.String()
-
 		local_new_secret := new_secret
 
-		if label == "o" {
+		if label == filename.ORIGINAL_LABEL {
 			local_new_secret = new_secret_o
 		}
 
-		remaining += 1
+		old_fname, err := filename.NewFilename(wof_id, details.Secret, label, details.Extension)
 
-		go func(id int64, secret string, new_secret string, label string, extension string) {
+		if err != nil {
+			return fmt.Errorf("Invalid filename for %s derivative, %w", label, err)
+		}
 
-			defer func() {
-				done_ch <- true
-			}()
+		new_fname, err := filename.NewFilename(wof_id, local_new_secret, label, details.Extension)
 
-			root, err := uri.Id2Path(id)
+		if err != nil {
+			return fmt.Errorf("Invalid filename for rotated %s derivative, %w", label, err)
+		}
 
-			if err != nil {
-				err_ch <- err
-				return
-			}
+		t := &rotateTask{
+			label:     label,
+			extension: details.Extension,
+			secret:    local_new_secret,
+			old_path:  filepath.Join(root, old_fname.String()),
+			new_path:  filepath.Join(root, new_fname.String()),
+		}
 
-			old_fname := fmt.Sprintf("%d_%s_%s.%s", wof_id, secret, label, extension)
-			new_fname := fmt.Sprintf("%d_%s_%s.%s", wof_id, new_secret, label, extension)
+		if r.Regenerate {
 
-			old_path := filepath.Join(root, old_fname)
-			new_path := filepath.Join(root, new_fname)
+			if label == filename.ORIGINAL_LABEL {
+				original = t
+				continue
+			}
 
-			im, err := r.rotateImage(ctx, req, bucket, old_path, new_path)
+			sz, err := r.generateSize(label, details, mp.Details.Sizes[filename.ORIGINAL_LABEL])
 
 			if err != nil {
-				err_ch <- err
-				return
+				return err
 			}
 
-			rsp := &RotateResponse{
-				Id:        id,
-				Secret:    new_secret,
-				Label:     label,
-				Extension: extension,
-				Image:     im,
-				OldPath:   old_path,
-				NewPath:   new_path,
-			}
+			t.size = sz
+		}
+
+		tasks = append(tasks, t)
+	}
+
+	if r.Regenerate && original == nil {
+		return fmt.Errorf("Missing %s size, required to regenerate derivatives", filename.ORIGINAL_LABEL)
+	}
+
+	responses := make([]*RotateResponse, 0)
+	responses_mu := new(sync.Mutex)
+
+	ex := common.NewExecutor(&common.ExecutorOptions{
+		Workers:  r.Workers,
+		FailFast: true,
+	})
+
+	var rotated image.Image
+
+	// In regenerate mode the original is rotated first and every other size is derived from it
+
+	if original != nil {
+
+		im, err := r.rotateImage(ctx, req, bucket, original.old_path, original.new_path)
+
+		if err != nil {
+			return err
+		}
 
-			rsp_ch <- rsp
+		rotated = im
 
-		}(wof_id, secret, local_new_secret, label, extension)
+		rsp := &RotateResponse{
+			Id:        wof_id,
+			Secret:    original.secret,
+			Label:     original.label,
+			Extension: original.extension,
+			Image:     im,
+			OldPath:   original.old_path,
+			NewPath:   original.new_path,
+		}
+
+		responses = append(responses, rsp)
+	}
+
+	rotate_func := func(ctx context.Context, idx int) error {
+
+		t := tasks[idx]
+
+		var im image.Image
+		var err error
+
+		// Regenerated derivatives are encoded using their own filename extension, which may differ from the
+		// original's format, so that their bytes match the extension and mimetype recorded in their sizes entry
+
+		if t.size != nil {
+			im = common.ResizeImage(rotated, t.size)
+			err = r.writeImage(ctx, req, bucket, im, t.extension, t.new_path)
+		} else {
+			im, err = r.rotateImage(ctx, req, bucket, t.old_path, t.new_path)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		rsp := &RotateResponse{
+			Id:        wof_id,
+			Secret:    t.secret,
+			Label:     t.label,
+			Extension: t.extension,
+			Image:     im,
+			OldPath:   t.old_path,
+			NewPath:   t.new_path,
+		}
+
+		responses_mu.Lock()
+		responses = append(responses, rsp)
+		responses_mu.Unlock()
+
+		return nil
 	}
 
+	err = ex.Execute(ctx, len(tasks), rotate_func)
+
 	new_paths := make([]string, 0)
 	old_paths := make([]string, 0)
 
+	for _, rsp := range responses {
+		old_paths = append(old_paths, rsp.OldPath)
+		new_paths = append(new_paths, rsp.NewPath)
+	}
+
 	scrub := func(paths []string) {
 
 		for _, path := range paths {
@@ -270,39 +392,57 @@ func (r *Rotation) rotate(ctx context.Context, req *RotateRequest) error {
 
 	}
 
-	for remaining > 0 {
+	if err != nil {
+		scrub(new_paths)
+		return err
+	}
 
-		select {
-		case <-done_ch:
-			remaining -= 1
-		case rsp := <-rsp_ch:
+	// Build a new set of sizes, rather than updating them in place, so that the
+	// old sizes (and secrets) are archived in media:properties.history
 
-			old_paths = append(old_paths, rsp.OldPath)
-			new_paths = append(new_paths, rsp.NewPath)
+	sizes := make(map[string]properties.Size)
 
-			im := rsp.Image
-			label := rsp.Label
+	for label, sz := range mp.Details.Sizes {
+		sizes[label] = sz
+	}
 
-			bounds := im.Bounds()
-			dims := bounds.Max
+	for _, rsp := range responses {
 
-			root_path := fmt.Sprintf("properties.media:properties.sizes.%s", label)
+		im := rsp.Image
+		label := rsp.Label
 
-			secret_path := fmt.Sprintf("%s.secret", root_path)
-			height_path := fmt.Sprintf("%s.height", root_path)
-			width_path := fmt.Sprintf("%s.width", root_path)
+		bounds := im.Bounds()
+		dims := bounds.Max
 
-			body, _ = sjson.SetBytes(body, secret_path, rsp.Secret)
-			body, _ = sjson.SetBytes(body, width_path, dims.X)
-			body, _ = sjson.SetBytes(body, height_path, dims.Y)
+		sz := sizes[label]
+		sz.Secret = rsp.Secret
+		sz.Width = dims.X
+		sz.Height = dims.Y
 
-		case e := <-err_ch:
+		sizes[label] = sz
+	}
 
-			scrub(new_paths)
-			return e
-		default:
-			// pass
-		}
+	mp.ReplaceSizes(sizes, "rotate")
+
+	body, err = mp.Marshal(body)
+
+	if err != nil {
+		scrub(new_paths)
+		return err
+	}
+
+	body, err = status.MarkRotated(body)
+
+	if err != nil {
+		scrub(new_paths)
+		return fmt.Errorf("Failed to update status, %w", err)
+	}
+
+	err = properties.ValidateFeature(body)
+
+	if err != nil {
+		scrub(new_paths)
+		return fmt.Errorf("Rotated feature has invalid media properties, %w", err)
 	}
 
 	_, body, err = r.Exporter.Export(ctx, body)
@@ -343,6 +483,8 @@ func (r *Rotation) rotate(ctx context.Context, req *RotateRequest) error {
 	return nil
 }
 
+// rotateImage rotates the image at 'old_path' in 'bucket', encodes it using the format it was decoded from, and writes it
+// to 'new_path'. It returns the rotated image.
 func (r *Rotation) rotateImage(ctx context.Context, req *RotateRequest, bucket *blob.Bucket, old_path string, new_path string) (image.Image, error) {
 
 	if req.Degrees == 0 {
@@ -369,44 +511,100 @@ func (r *Rotation) rotateImage(ctx context.Context, req *RotateRequest, bucket *
 
 	im = imaging.Rotate(im, float64(req.Degrees), color.White)
 
+	err = r.writeImage(ctx, req, bucket, im, format, new_path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return im, nil
+}
+
+// writeImage encodes 'im' using 'format' and writes it to 'new_path' in 'bucket' using r.WritePolicy.
+func (r *Rotation) writeImage(ctx context.Context, req *RotateRequest, bucket *blob.Bucket, im image.Image, format string, new_path string) error {
+
 	if r.Dryrun {
 		log.Printf("[dryrun] write '%s' here\n", new_path)
-	} else {
+		return nil
+	}
 
-		before := func(asFunc func(interface{}) bool) error {
+	var buf bytes.Buffer
 
-			s3_req := &s3manager.UploadInput{}
-			ok := asFunc(&s3_req)
+	err := util.EncodeImage(im, format, &buf)
 
-			if ok {
-				s3_req.ACL = aws.String("public-read")
-			}
+	if err != nil {
+		return err
+	}
 
-			return nil
-		}
+	body := buf.Bytes()
 
-		wr_opts := &blob.WriterOptions{
-			BeforeWrite: before,
-		}
+	policy := r.WritePolicy
 
-		wr, err := bucket.NewWriter(ctx, new_path, wr_opts)
+	if policy == nil {
+		policy = common.NewDefaultWritePolicy()
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	attrs := &common.WriteAttributes{
+		Key:         new_path,
+		ContentType: common.SniffContentType(new_path, body),
+		ID:          req.Id,
+		Fingerprint: common.FingerprintBytes(body),
+	}
 
-		err = util.EncodeImage(im, format, wr)
+	wr_opts, err := policy.WriterOptions(ctx, attrs)
 
-		if err != nil {
-			return nil, err
-		}
+	if err != nil {
+		return fmt.Errorf("Failed to derive writer options for %s, %w", new_path, err)
+	}
 
-		err = wr.Close()
+	wr, err := bucket.NewWriter(ctx, new_path, wr_opts)
 
-		if err != nil {
-			return nil, err
+	if err != nil {
+		return err
+	}
+
+	_, err = wr.Write(body)
+
+	if err != nil {
+		wr.Close()
+		return err
+	}
+
+	return wr.Close()
+}
+
+// generateSize returns the common.GenerateSize used to regenerate the derivative 'label', whose existing details are
+// 'sz', from the original media file whose existing details are 'original'.
+func (r *Rotation) generateSize(label string, sz properties.Size, original properties.Size) (*common.GenerateSize, error) {
+
+	for _, gs := range r.Sizes {
+
+		if gs.Label == label {
+			return gs, nil
 		}
 	}
 
-	return im, nil
+	if sz.Width <= 0 || sz.Height <= 0 {
+		return nil, fmt.Errorf("Unable to derive dimensions for %s size", label)
+	}
+
+	gs := &common.GenerateSize{
+		Label:        label,
+		MaxDimension: max(sz.Width, sz.Height),
+		Square:       sz.Width == sz.Height && original.Width != original.Height,
+	}
+
+	return gs, nil
+}
+
+// NewPublicReadWritePolicy returns a common.ACLWritePolicy instance that assigns a "public-read" ACL to media files stored
+// in S3 buckets. This is the default WritePolicy for Rotation instances. The "s3" ACL driver is only used if it has been
+// registered by importing the github.com/sfomuseum/go-whosonfirst-media/common/acl/s3 package. Other drivers (for example
+// "gcs" or "file") are opt-in by appending their names to the policy's Drivers property.
+func NewPublicReadWritePolicy() *common.ACLWritePolicy {
+
+	p := common.NewACLWritePolicy(common.ACL_PUBLIC_READ)
+	p.Drivers = []string{"s3"}
+
+	return p
 }
@@ -0,0 +1,421 @@
+package rotate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sfomuseum/go-whosonfirst-media/common"
+	"github.com/sfomuseum/go-whosonfirst-media/filename"
+	"github.com/sfomuseum/go-whosonfirst-media/properties"
+	"github.com/whosonfirst/go-whosonfirst-export/v3"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
+	"gocloud.dev/blob/memblob"
+)
+
+const test_id int64 = 1511951011
+
+const test_secret string = "abc123"
+
+const test_secret_o string = "def456"
+
+// test_sizes are the derivatives, and their dimensions, written by writeFixtures.
+var test_sizes = map[string][2]int{
+	filename.ORIGINAL_LABEL: {40, 20},
+	"z":                     {20, 10},
+}
+
+// writeFixtures writes a media feature, in a new Who's On First repository, and its derivatives to 'bucket'. Derivatives
+// are encoded as JPEG images unless 'extensions' maps their label to "png". It returns the path to the repository.
+func writeFixtures(t *testing.T, bucket *blob.Bucket, extensions map[string]string) string {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	root, err := uri.Id2Path(test_id)
+
+	if err != nil {
+		t.Fatalf("Failed to derive path, %v", err)
+	}
+
+	sizes := make(map[string]any)
+
+	for label, dims := range test_sizes {
+
+		secret := test_secret
+
+		if label == filename.ORIGINAL_LABEL {
+			secret = test_secret_o
+		}
+
+		im := image.NewRGBA(image.Rect(0, 0, dims[0], dims[1]))
+
+		for x := 0; x < dims[0]; x++ {
+			for y := 0; y < dims[1]; y++ {
+				im.Set(x, y, color.RGBA{uint8(x * 6), uint8(y * 12), 128, 255})
+			}
+		}
+
+		ext := "jpg"
+		mimetype := "image/jpeg"
+
+		if extensions[label] == "png" {
+			ext = "png"
+			mimetype = "image/png"
+		}
+
+		var buf bytes.Buffer
+
+		switch ext {
+		case "png":
+			err = png.Encode(&buf, im)
+		default:
+			err = jpeg.Encode(&buf, im, nil)
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to encode %s image, %v", label, err)
+		}
+
+		fname, err := filename.NewFilename(test_id, secret, label, ext)
+
+		if err != nil {
+			t.Fatalf("Failed to derive filename for %s image, %v", label, err)
+		}
+
+		err = bucket.WriteAll(ctx, filepath.Join(root, fname.String()), buf.Bytes(), nil)
+
+		if err != nil {
+			t.Fatalf("Failed to write %s image, %v", label, err)
+		}
+
+		sizes[label] = map[string]any{
+			"extension": ext,
+			"mimetype":  mimetype,
+			"secret":    secret,
+			"width":     dims[0],
+			"height":    dims[1],
+		}
+	}
+
+	enc_sizes, err := json.Marshal(sizes)
+
+	if err != nil {
+		t.Fatalf("Failed to marshal sizes, %v", err)
+	}
+
+	// The "media" placetype is not part of the core placetypes validated by the whosonfirst:// exporter
+
+	feature := fmt.Sprintf(`{
+  "id": %d,
+  "type": "Feature",
+  "properties": {
+    "wof:id": %d,
+    "wof:name": "test",
+    "wof:parent_id": -1,
+    "wof:placetype": "venue",
+    "wof:repo": "sfomuseum-data-media",
+    "media:fingerprint": "018c9bc2cbfd25fdccb2fc29d0cce099d8df7596",
+    "media:medium": "image",
+    "media:mimetype": "image/jpeg",
+    "media:source": "test",
+    "media:status_id": 1,
+    "media:properties": {
+      "sizes": %s
+    }
+  },
+  "geometry": {"type": "Point", "coordinates": [0.0, 0.0]}
+}`, test_id, test_id, enc_sizes)
+
+	data_root := t.TempDir()
+
+	rel_path, err := uri.Id2RelPath(test_id)
+
+	if err != nil {
+		t.Fatalf("Failed to derive rel path, %v", err)
+	}
+
+	path := filepath.Join(data_root, "data", rel_path)
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+
+	if err != nil {
+		t.Fatalf("Failed to create data directory, %v", err)
+	}
+
+	err = os.WriteFile(path, []byte(feature), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write feature, %v", err)
+	}
+
+	return data_root
+}
+
+// testRotation rotates the fixture media feature, written to 'bucket' using 'extensions', by 90 degrees and verifies that
+// the feature and the rotated derivatives have been updated. It returns the media properties of the rotated feature.
+func testRotation(t *testing.T, bucket *blob.Bucket, r *Rotation, extensions map[string]string) *properties.MediaProperties {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	data_root := writeFixtures(t, bucket, extensions)
+
+	ex, err := export.NewExporter(ctx, "whosonfirst://")
+
+	if err != nil {
+		t.Fatalf("Failed to create exporter, %v", err)
+	}
+
+	r.DataSource = fmt.Sprintf("repo://%s", data_root)
+	r.MediaBucket = bucket
+	r.Exporter = ex
+
+	req := &RotateRequest{
+		Id:      test_id,
+		Degrees: 90,
+		Prune:   true,
+	}
+
+	err = r.Rotate(ctx, req)
+
+	if err != nil {
+		t.Fatalf("Failed to rotate, %v", err)
+	}
+
+	rel_path, _ := uri.Id2RelPath(test_id)
+
+	body, err := os.ReadFile(filepath.Join(data_root, "data", rel_path))
+
+	if err != nil {
+		t.Fatalf("Failed to read rotated feature, %v", err)
+	}
+
+	mp, err := properties.Unmarshal(body)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal rotated feature, %v", err)
+	}
+
+	root, _ := uri.Id2Path(test_id)
+
+	for label, dims := range test_sizes {
+
+		sz, exists := mp.Details.Sizes[label]
+
+		if !exists {
+			t.Fatalf("Rotated feature is missing %s size", label)
+		}
+
+		if sz.Secret == test_secret || sz.Secret == test_secret_o {
+			t.Fatalf("Expected new secret for %s size", label)
+		}
+
+		if sz.Width != dims[1] || sz.Height != dims[0] {
+			t.Fatalf("Unexpected dimensions for %s size, %dx%d", label, sz.Width, sz.Height)
+		}
+
+		new_fname, _ := filename.NewFilename(test_id, sz.Secret, label, sz.Extension)
+
+		exists, err = bucket.Exists(ctx, filepath.Join(root, new_fname.String()))
+
+		if err != nil {
+			t.Fatalf("Failed to determine whether rotated %s image exists, %v", label, err)
+		}
+
+		if !exists {
+			t.Fatalf("Rotated %s image does not exist", label)
+		}
+
+		old_secret := test_secret
+
+		if label == filename.ORIGINAL_LABEL {
+			old_secret = test_secret_o
+		}
+
+		old_fname, _ := filename.NewFilename(test_id, old_secret, label, sz.Extension)
+
+		exists, err = bucket.Exists(ctx, filepath.Join(root, old_fname.String()))
+
+		if err != nil {
+			t.Fatalf("Failed to determine whether old %s image exists, %v", label, err)
+		}
+
+		if exists {
+			t.Fatalf("Old %s image was not pruned", label)
+		}
+	}
+
+	return mp
+}
+
+func TestRotateMemBlob(t *testing.T) {
+
+	policies := map[string]common.WritePolicy{
+		// The default policy assigns a "public-read" ACL to objects in S3 buckets only
+		"default": NewPublicReadWritePolicy(),
+		// None of the registered drivers handle memblob's types so enabling all of them is still a no-op
+		"all": common.NewACLWritePolicy(common.ACL_PUBLIC_READ),
+	}
+
+	for name, policy := range policies {
+
+		t.Run(name, func(t *testing.T) {
+
+			bucket := memblob.OpenBucket(nil)
+			defer bucket.Close()
+
+			r, err := NewRotation(nil)
+
+			if err != nil {
+				t.Fatalf("Failed to create rotation, %v", err)
+			}
+
+			r.WritePolicy = policy
+
+			testRotation(t, bucket, r, nil)
+		})
+	}
+}
+
+func TestRotateFileBlob(t *testing.T) {
+
+	media_root := t.TempDir()
+
+	bucket, err := fileblob.OpenBucket(media_root, nil)
+
+	if err != nil {
+		t.Fatalf("Failed to open bucket, %v", err)
+	}
+
+	defer bucket.Close()
+
+	r, err := NewRotation(nil)
+
+	if err != nil {
+		t.Fatalf("Failed to create rotation, %v", err)
+	}
+
+	// Opt in to the "file" driver and verify that the ACL is mapped to file permissions
+
+	policy := NewPublicReadWritePolicy()
+	policy.ACL = common.ACL_PRIVATE
+	policy.Drivers = append(policy.Drivers, "file")
+
+	r.WritePolicy = policy
+
+	testRotation(t, bucket, r, nil)
+
+	root, _ := uri.Id2Path(test_id)
+
+	entries, err := os.ReadDir(filepath.Join(media_root, root))
+
+	if err != nil {
+		t.Fatalf("Failed to read media directory, %v", err)
+	}
+
+	count := 0
+
+	for _, e := range entries {
+
+		if filepath.Ext(e.Name()) != ".jpg" {
+			continue
+		}
+
+		info, err := e.Info()
+
+		if err != nil {
+			t.Fatalf("Failed to stat %s, %v", e.Name(), err)
+		}
+
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("Unexpected permissions for %s, %v", e.Name(), info.Mode().Perm())
+		}
+
+		count += 1
+	}
+
+	if count != len(test_sizes) {
+		t.Fatalf("Expected %d media files, got %d", len(test_sizes), count)
+	}
+}
+
+func TestRotateRegenerate(t *testing.T) {
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	r, err := NewRotation(nil)
+
+	if err != nil {
+		t.Fatalf("Failed to create rotation, %v", err)
+	}
+
+	r.Regenerate = true
+
+	testRotation(t, bucket, r, nil)
+}
+
+func TestRotateRegeneratePNG(t *testing.T) {
+
+	ctx := context.Background()
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	r, err := NewRotation(nil)
+
+	if err != nil {
+		t.Fatalf("Failed to create rotation, %v", err)
+	}
+
+	r.Regenerate = true
+
+	extensions := map[string]string{
+		filename.ORIGINAL_LABEL: "png",
+	}
+
+	mp := testRotation(t, bucket, r, extensions)
+
+	root, _ := uri.Id2Path(test_id)
+
+	expected := map[string]string{
+		filename.ORIGINAL_LABEL: "png",
+		"z":                     "jpeg",
+	}
+
+	for label, format := range expected {
+
+		sz := mp.Details.Sizes[label]
+
+		fname, _ := filename.NewFilename(test_id, sz.Secret, label, sz.Extension)
+
+		body, err := bucket.ReadAll(ctx, filepath.Join(root, fname.String()))
+
+		if err != nil {
+			t.Fatalf("Failed to read rotated %s image, %v", label, err)
+		}
+
+		_, decoded_format, err := image.DecodeConfig(bytes.NewReader(body))
+
+		if err != nil {
+			t.Fatalf("Failed to decode rotated %s image, %v", label, err)
+		}
+
+		if decoded_format != format {
+			t.Fatalf("Expected rotated %s image (%s) to be encoded as %s, got %s", label, fname.String(), format, decoded_format)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package properties
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sfomuseum/go-whosonfirst-media/filename"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+// SizesHistoryEntry is a struct recording a set of derivative sizes that has been replaced. It is stored in the
+// media:properties.history list.
+type SizesHistoryEntry struct {
+	// The Unix timestamp when the sizes were replaced.
+	Timestamp int64 `json:"timestamp"`
+	// The operation that replaced the sizes (for example "process", "rotate" or "remove").
+	Operation string `json:"operation"`
+	// The sizes that were replaced, including their (old) secrets.
+	Sizes map[string]Size `json:"sizes"`
+}
+
+// ReplaceSizes will assign 'sizes' to mp.Details.Sizes. If 'mp' already has a (non-empty) set of sizes that differs
+// from 'sizes' then it is appended to mp.Details.History, with 'operation', before being replaced.
+func (mp *MediaProperties) ReplaceSizes(sizes map[string]Size, operation string) {
+
+	if mp.Details == nil {
+		mp.Details = new(Details)
+	}
+
+	old_sizes := mp.Details.Sizes
+
+	if len(old_sizes) > 0 && !equalSizes(old_sizes, sizes) {
+
+		e := &SizesHistoryEntry{
+			Timestamp: time.Now().Unix(),
+			Operation: operation,
+			Sizes:     old_sizes,
+		}
+
+		mp.Details.History = append(mp.Details.History, e)
+	}
+
+	mp.Details.Sizes = sizes
+}
+
+// SupersededKeys returns the sorted list of derivative object keys, relative to the root of a media bucket, recorded in
+// mp.Details.History that are not also derivatives in mp.Details.Sizes. 'id' is the WOF ID of the media feature.
+func (mp *MediaProperties) SupersededKeys(id int64) ([]string, error) {
+
+	keys := make([]string, 0)
+
+	if mp.Details == nil || len(mp.Details.History) == 0 {
+		return keys, nil
+	}
+
+	root, err := uri.Id2Path(id)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive path for %d, %w", id, err)
+	}
+
+	current := make(map[string]bool)
+
+	for label, sz := range mp.Details.Sizes {
+
+		fname, err := filename.NewFilename(id, sz.Secret, label, sz.Extension)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid filename for %s derivative, %w", label, err)
+		}
+
+		current[filepath.Join(root, fname.String())] = true
+	}
+
+	seen := make(map[string]bool)
+
+	for _, e := range mp.Details.History {
+
+		for label, sz := range e.Sizes {
+
+			fname, err := filename.NewFilename(id, sz.Secret, label, sz.Extension)
+
+			if err != nil {
+				return nil, fmt.Errorf("Invalid filename for superseded %s derivative, %w", label, err)
+			}
+
+			key := filepath.Join(root, fname.String())
+
+			if current[key] || seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// equalSizes returns a boolean value indicating whether 'a' and 'b' contain the same sizes.
+func equalSizes(a map[string]Size, b map[string]Size) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for label, sz := range a {
+
+		other, ok := b[label]
+
+		if !ok || other != sz {
+			return false
+		}
+	}
+
+	return true
+}
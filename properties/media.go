@@ -0,0 +1,268 @@
+package properties
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// IMAGEHASH_PREFIX is the prefix for properties containing image hashes, where the suffix is the image hashing approach used.
+const IMAGEHASH_PREFIX string = "media:imagehash_"
+
+// DEFAULT_MEDIUM is the media:medium property assigned to records that do not define one.
+const DEFAULT_MEDIUM string = "image"
+
+// DEFAULT_SOURCE is the media:source property assigned to records that do not define one.
+const DEFAULT_SOURCE string = "unknown"
+
+// MediaProperties is a struct containing the media: properties of a Who's On First style media feature record.
+type MediaProperties struct {
+	// The SHA-1 hash of the original media file.
+	Fingerprint string `json:"media:fingerprint"`
+	// The mimetype of the original media file.
+	Mimetype string `json:"media:mimetype"`
+	// The medium of the media file (for example "image").
+	Medium string `json:"media:medium"`
+	// The source of the media file.
+	Source string `json:"media:source"`
+	// The numeric status of the media record.
+	StatusId int `json:"media:status_id"`
+	// The Unix timestamp when the media file was created (typically derived from EXIF data).
+	Created int64 `json:"media:created,omitempty"`
+	// Text extracted from the media file.
+	ImageText string `json:"media:imagetext,omitempty"`
+	// Image hashes for the media file, keyed by the approach used to derive them. These are stored as individual
+	// media:imagehash_{APPROACH} properties.
+	ImageHashes map[string]string `json:"-"`
+	// The media:properties dictionary containing details about derivative files.
+	Details *Details `json:"media:properties,omitempty"`
+	// Previous values of the media:fingerprint property, oldest first.
+	FingerprintHistory []*FingerprintHistoryEntry `json:"media:fingerprint_history,omitempty"`
+}
+
+// FingerprintHistoryEntry is a struct recording a previous value of the media:fingerprint property.
+type FingerprintHistoryEntry struct {
+	// The previous fingerprint.
+	Fingerprint string `json:"fingerprint"`
+	// The fingerprint that replaced it.
+	ReplacedBy string `json:"replaced_by"`
+	// The Unix timestamp when the fingerprint was replaced.
+	Timestamp int64 `json:"timestamp"`
+	// An optional string describing why the fingerprint was replaced.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Details is a struct containing the contents of a media feature's media:properties dictionary.
+type Details struct {
+	// A dictionary of derivative files keyed by their size label.
+	Sizes map[string]Size `json:"sizes,omitempty"`
+	// The colour palette for a media file.
+	Colours []Colour `json:"colours,omitempty"`
+	// Sets of derivative sizes that have been replaced, oldest first.
+	History []*SizesHistoryEntry `json:"history,omitempty"`
+}
+
+// type Size defines a struct containing properties about a media file
+type Size struct {
+	// The filename extension for the media file.
+	Extension string `json:"extension"`
+	// The pixel height of the media file.
+	Height int `json:"height"`
+	// The pixel width of the media file.
+	Width int `json:"width"`
+	// The mimetype of the media file.
+	Mimetype string `json:"mimetype"`
+	// A secret associated with the media file (typically appended to its URI).
+	Secret string `json:"secret"`
+}
+
+// Colour provides a data structure containing colour palette information about an image file.
+type Colour struct {
+	// The name (or label) for a colour.
+	Name string `json:"name"`
+	// The (6-character) hexidecimal value for a colour.
+	Hex string `json:"hex"`
+	// The reference (source) for a colour.
+	Reference string `json:"reference"`
+}
+
+// ReplaceFingerprint will assign 'fingerprint' to 'mp'. If 'mp' already has a different fingerprint then it is appended
+// to mp.FingerprintHistory, with 'reason', before being replaced.
+func (mp *MediaProperties) ReplaceFingerprint(fingerprint string, reason string) {
+
+	if mp.Fingerprint != "" && mp.Fingerprint != fingerprint {
+
+		e := &FingerprintHistoryEntry{
+			Fingerprint: mp.Fingerprint,
+			ReplacedBy:  fingerprint,
+			Timestamp:   time.Now().Unix(),
+			Reason:      reason,
+		}
+
+		mp.FingerprintHistory = append(mp.FingerprintHistory, e)
+	}
+
+	mp.Fingerprint = fingerprint
+}
+
+// Unmarshal will derive a new MediaProperties instance from the properties of the (GeoJSON) Feature 'body'. If the
+// media:medium or media:source properties are missing they are assigned DEFAULT_MEDIUM and DEFAULT_SOURCE respectively.
+func Unmarshal(body []byte) (*MediaProperties, error) {
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if !props_rsp.Exists() {
+		return nil, fmt.Errorf("Feature is missing properties")
+	}
+
+	var mp *MediaProperties
+
+	err := json.Unmarshal([]byte(props_rsp.Raw), &mp)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal media properties, %w", err)
+	}
+
+	mp.ImageHashes = make(map[string]string)
+
+	for k, v := range props_rsp.Map() {
+
+		if strings.HasPrefix(k, IMAGEHASH_PREFIX) {
+			approach := strings.Replace(k, IMAGEHASH_PREFIX, "", 1)
+			mp.ImageHashes[approach] = v.String()
+		}
+	}
+
+	if mp.Details == nil {
+		mp.Details = new(Details)
+	}
+
+	// Records created before media:medium and media:source were required
+	// are assigned the same defaults as new records
+
+	if mp.Medium == "" {
+		mp.Medium = DEFAULT_MEDIUM
+	}
+
+	if mp.Source == "" {
+		mp.Source = DEFAULT_SOURCE
+	}
+
+	return mp, nil
+}
+
+// Marshal will update the properties of the (GeoJSON) Feature 'body' with the values in 'mp'. Optional properties that
+// are empty in 'mp' are removed from 'body'. Properties in the media:properties dictionary that are not defined by the
+// Details struct are left as-is.
+func (mp *MediaProperties) Marshal(body []byte) ([]byte, error) {
+
+	updates := map[string]interface{}{
+		"properties.media:mimetype":  mp.Mimetype,
+		"properties.media:source":    mp.Source,
+		"properties.media:status_id": mp.StatusId,
+	}
+
+	remove := make([]string, 0)
+
+	// Legacy records may never have been assigned a fingerprint
+
+	if mp.Fingerprint != "" {
+		updates["properties.media:fingerprint"] = mp.Fingerprint
+	} else {
+		remove = append(remove, "properties.media:fingerprint")
+	}
+
+	if mp.Medium != "" {
+		updates["properties.media:medium"] = mp.Medium
+	}
+
+	if mp.Created != 0 {
+		updates["properties.media:created"] = mp.Created
+	} else {
+		remove = append(remove, "properties.media:created")
+	}
+
+	if mp.ImageText != "" {
+		updates["properties.media:imagetext"] = mp.ImageText
+	} else {
+		remove = append(remove, "properties.media:imagetext")
+	}
+
+	if len(mp.FingerprintHistory) > 0 {
+		updates["properties.media:fingerprint_history"] = mp.FingerprintHistory
+	} else {
+		remove = append(remove, "properties.media:fingerprint_history")
+	}
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	for k := range props_rsp.Map() {
+
+		if !strings.HasPrefix(k, IMAGEHASH_PREFIX) {
+			continue
+		}
+
+		approach := strings.Replace(k, IMAGEHASH_PREFIX, "", 1)
+
+		_, ok := mp.ImageHashes[approach]
+
+		if !ok {
+			remove = append(remove, fmt.Sprintf("properties.%s", k))
+		}
+	}
+
+	for approach, hash := range mp.ImageHashes {
+		path := fmt.Sprintf("properties.%s%s", IMAGEHASH_PREFIX, approach)
+		updates[path] = hash
+	}
+
+	details := mp.Details
+
+	if details == nil {
+		details = new(Details)
+	}
+
+	if len(details.Sizes) > 0 {
+		updates["properties.media:properties.sizes"] = details.Sizes
+	} else {
+		remove = append(remove, "properties.media:properties.sizes")
+	}
+
+	if len(details.History) > 0 {
+		updates["properties.media:properties.history"] = details.History
+	} else {
+		remove = append(remove, "properties.media:properties.history")
+	}
+
+	if details.Colours != nil {
+		updates["properties.media:properties.colours"] = details.Colours
+	} else {
+		remove = append(remove, "properties.media:properties.colours")
+	}
+
+	var err error
+
+	for _, path := range remove {
+
+		body, err = sjson.DeleteBytes(body, path)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to remove %s property, %w", path, err)
+		}
+	}
+
+	for path, value := range updates {
+
+		body, err = sjson.SetBytes(body, path, value)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s property, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
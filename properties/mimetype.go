@@ -0,0 +1,33 @@
+package properties
+
+import (
+	"strings"
+)
+
+// extension_mimetypes maps filename extensions to their mimetypes. A package-local table is used, rather than
+// mime.TypeByExtension, because Go's built-in table is incomplete (for example it has no entry for ".tif") and the
+// system tables it is supplemented with vary from host to host.
+var extension_mimetypes = map[string]string{
+	"bmp":  "image/bmp",
+	"gif":  "image/gif",
+	"heic": "image/heic",
+	"jp2":  "image/jp2",
+	"jpeg": "image/jpeg",
+	"jpg":  "image/jpeg",
+	"png":  "image/png",
+	"svg":  "image/svg+xml",
+	"tif":  "image/tiff",
+	"tiff": "image/tiff",
+	"webp": "image/webp",
+}
+
+// MimetypeForExtension returns the mimetype for the filename extension 'ext' (with or without a leading ".") and a
+// boolean value indicating whether the extension is known. It is the same table used to validate the mimetypes and
+// extensions of derivative sizes, so it should be used instead of mime.TypeByExtension when deriving their mimetypes.
+func MimetypeForExtension(ext string) (string, bool) {
+
+	ext = strings.ToLower(strings.TrimLeft(ext, "."))
+	mimetype, ok := extension_mimetypes[ext]
+
+	return mimetype, ok
+}
@@ -0,0 +1,3 @@
+// package properties provides a typed model for the media: properties of Who's On First style media feature records,
+// and methods for reading, writing and validating those properties.
+package properties
@@ -0,0 +1,149 @@
+package properties
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"regexp"
+	"sort"
+
+	"github.com/sfomuseum/go-whosonfirst-media/status"
+)
+
+// re_fingerprint matches a hex-encoded SHA-1 hash.
+var re_fingerprint = regexp.MustCompile(`^[a-f0-9]{40}$`)
+
+// re_label matches size labels, for example "o", "b", "z" or "sq".
+var re_label = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// re_secret matches the secrets appended to derivative filenames.
+var re_secret = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// ValidateFeature will validate the media: properties of the (GeoJSON) Feature 'body'.
+func ValidateFeature(body []byte) error {
+
+	mp, err := Unmarshal(body)
+
+	if err != nil {
+		return err
+	}
+
+	return Validate(mp)
+}
+
+// Validate will ensure that 'mp' contains all the required media: properties, that mimetypes and filename extensions
+// agree with one another, that size labels and secrets follow the expected conventions and that the status ID is valid.
+// All problems are reported together as a single error. Legacy records that have never been assigned a media:fingerprint
+// property (they have no media:fingerprint_history either) are allowed to omit it. Their fingerprint is backfilled the
+// next time a report with an origin fingerprint is processed for them.
+func Validate(mp *MediaProperties) error {
+
+	errs := make([]error, 0)
+
+	if mp.Fingerprint == "" {
+
+		if len(mp.FingerprintHistory) > 0 {
+			errs = append(errs, fmt.Errorf("Missing media:fingerprint property"))
+		}
+
+	} else if !re_fingerprint.MatchString(mp.Fingerprint) {
+		errs = append(errs, fmt.Errorf("Invalid media:fingerprint property '%s'", mp.Fingerprint))
+	}
+
+	if mp.Mimetype == "" {
+		errs = append(errs, fmt.Errorf("Missing media:mimetype property"))
+	} else {
+
+		_, _, err := mime.ParseMediaType(mp.Mimetype)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid media:mimetype property '%s', %w", mp.Mimetype, err))
+		}
+	}
+
+	if mp.Medium == "" {
+		errs = append(errs, fmt.Errorf("Missing media:medium property"))
+	}
+
+	if mp.Source == "" {
+		errs = append(errs, fmt.Errorf("Missing media:source property"))
+	}
+
+	if !status.IsValid(mp.StatusId) {
+		errs = append(errs, fmt.Errorf("Invalid media:status_id property '%d'", mp.StatusId))
+	}
+
+	if mp.Details != nil {
+
+		labels := make([]string, 0)
+
+		for label := range mp.Details.Sizes {
+			labels = append(labels, label)
+		}
+
+		sort.Strings(labels)
+
+		for _, label := range labels {
+
+			err := validateSize(label, mp.Details.Sizes[label])
+
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		for idx, c := range mp.Details.Colours {
+
+			if c.Hex == "" {
+				errs = append(errs, fmt.Errorf("Colour at offset %d is missing hex property", idx))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateSize(label string, sz Size) error {
+
+	if !re_label.MatchString(label) {
+		return fmt.Errorf("Invalid size label '%s'", label)
+	}
+
+	if sz.Secret == "" {
+		return fmt.Errorf("Size '%s' is missing secret", label)
+	}
+
+	if !re_secret.MatchString(sz.Secret) {
+		return fmt.Errorf("Size '%s' has invalid secret '%s'", label, sz.Secret)
+	}
+
+	if sz.Width <= 0 || sz.Height <= 0 {
+		return fmt.Errorf("Size '%s' has invalid dimensions (%d x %d)", label, sz.Width, sz.Height)
+	}
+
+	if sz.Extension == "" {
+		return fmt.Errorf("Size '%s' is missing extension", label)
+	}
+
+	if sz.Mimetype == "" {
+		return fmt.Errorf("Size '%s' is missing mimetype", label)
+	}
+
+	ext_mimetype, ok := MimetypeForExtension(sz.Extension)
+
+	if !ok {
+		return fmt.Errorf("Size '%s' has unknown extension '%s'", label, sz.Extension)
+	}
+
+	sz_mimetype, _, err := mime.ParseMediaType(sz.Mimetype)
+
+	if err != nil {
+		return fmt.Errorf("Size '%s' has invalid mimetype '%s', %w", label, sz.Mimetype, err)
+	}
+
+	if ext_mimetype != sz_mimetype {
+		return fmt.Errorf("Size '%s' has mimetype '%s' which does not match extension '%s' (%s)", label, sz.Mimetype, sz.Extension, ext_mimetype)
+	}
+
+	return nil
+}
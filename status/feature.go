@@ -0,0 +1,209 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// HistoryEntry is a struct recording a single state change for a media record. A list of these is stored in a media
+// feature's media:status_history property.
+type HistoryEntry struct {
+	// The numeric Status value that the media record moved to.
+	StatusId int `json:"status_id"`
+	// The name of the Status value that the media record moved to.
+	Status string `json:"status"`
+	// The Unix timestamp when the state change occurred.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// NewHistoryEntry returns a new HistoryEntry for 's' using the current time.
+func NewHistoryEntry(s Status) *HistoryEntry {
+
+	e := &HistoryEntry{
+		StatusId:  int(s),
+		Status:    s.String(),
+		Timestamp: time.Now().Unix(),
+	}
+
+	return e
+}
+
+// Current returns the Status of the media feature 'body'. Features without a media:status_id property are assumed to be GATHERED.
+func Current(body []byte) (Status, error) {
+
+	rsp := gjson.GetBytes(body, "properties.media:status_id")
+
+	if !rsp.Exists() {
+		return GATHERED, nil
+	}
+
+	id := int(rsp.Int())
+
+	if !IsValid(id) {
+		return GATHERED, fmt.Errorf("Invalid media:status_id property '%d'", id)
+	}
+
+	return Status(id), nil
+}
+
+// History returns the list of state changes recorded in the media:status_history property of the media feature 'body'.
+func History(body []byte) ([]*HistoryEntry, error) {
+
+	history := make([]*HistoryEntry, 0)
+
+	rsp := gjson.GetBytes(body, "properties.media:status_history")
+
+	if !rsp.Exists() {
+		return history, nil
+	}
+
+	err := json.Unmarshal([]byte(rsp.Raw), &history)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal media:status_history property, %w", err)
+	}
+
+	return history, nil
+}
+
+// Transition will move the media feature 'body' to the state 'to', updating its media:status_id property and appending
+// a new entry to its media:status_history property. An error is returned if the transition is not allowed. Transitions
+// from a state to itself leave 'body' unchanged.
+func Transition(body []byte, to Status) ([]byte, error) {
+
+	from, err := Current(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanTransition(from, to) {
+		return nil, fmt.Errorf("Invalid status transition from '%s' to '%s'", from, to)
+	}
+
+	if from == to {
+		return body, nil
+	}
+
+	history, err := History(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	history = append(history, NewHistoryEntry(to))
+
+	updates := map[string]interface{}{
+		"properties.media:status_id":      int(to),
+		"properties.media:status_history": history,
+	}
+
+	for path, value := range updates {
+
+		body, err = sjson.SetBytes(body, path, value)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s property, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
+
+// transitionAll will move the media feature 'body' through each of the states in 'steps' in order.
+func transitionAll(body []byte, steps ...Status) ([]byte, error) {
+
+	var err error
+
+	for _, s := range steps {
+
+		body, err = Transition(body, s)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return body, nil
+}
+
+// MarkCloned will move the media feature 'body' to the PENDING state. It is used when an image and its feature are
+// cloned to a location where they will be processed.
+func MarkCloned(body []byte) ([]byte, error) {
+	return Transition(body, PENDING)
+}
+
+// MarkProcessed will move the media feature 'body' to the PUBLISHED state. It is used when a processing report has
+// been applied to a feature. Processing a HIDDEN media record does not change its state, the same as MarkRotated; use
+// Transition to explicitly publish a hidden record.
+func MarkProcessed(body []byte) ([]byte, error) {
+
+	current, err := Current(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if current == HIDDEN {
+		return body, nil
+	}
+
+	return Transition(body, PUBLISHED)
+}
+
+// MarkRotated will move the media feature 'body' through the PROCESSING state and back to the PUBLISHED state. It is
+// used when the media files for a feature have been rotated (and their derivatives replaced). Rotating a HIDDEN media
+// record does not change its state.
+func MarkRotated(body []byte) ([]byte, error) {
+
+	current, err := Current(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if current == HIDDEN {
+		return body, nil
+	}
+
+	return transitionAll(body, PROCESSING, PUBLISHED)
+}
+
+// MarkDeprecated will move the media feature 'body' to the DEPRECATED state. It is used when a feature is deprecated
+// before its media files are removed. Media records that are already REMOVED are left as-is.
+func MarkDeprecated(body []byte) ([]byte, error) {
+
+	current, err := Current(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if current == REMOVED {
+		return body, nil
+	}
+
+	return Transition(body, DEPRECATED)
+}
+
+// MarkRemoved will move the media feature 'body' through the DEPRECATED state to the REMOVED state. It is used when a
+// feature has been deprecated and its media files have been removed. Media records that are already REMOVED are left
+// as-is.
+func MarkRemoved(body []byte) ([]byte, error) {
+
+	current, err := Current(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if current == REMOVED {
+		return body, nil
+	}
+
+	return transitionAll(body, DEPRECATED, REMOVED)
+}
@@ -0,0 +1,123 @@
+// package status defines the lifecycle states for media records, the allowed transitions between those states and
+// methods for recording those transitions in the media:status_id and media:status_history properties of a media feature.
+package status
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// type Status is a numeric value describing the state of a media record. It is stored in a media feature's media:status_id property.
+type Status int
+
+const (
+	// GATHERED is the state of a media record that has been created (gathered) but not yet cloned for processing.
+	// It is also the state assumed for media records without a media:status_id property.
+	GATHERED Status = 0
+	// PUBLISHED is the state of a media record whose derivatives have been processed and published. For historical
+	// reasons this is the value assigned by the report processor before lifecycle states were defined.
+	PUBLISHED Status = 1
+	// PENDING is the state of a media record that has been cloned to a "pending" location to be processed.
+	PENDING Status = 2
+	// PROCESSING is the state of a media record whose derivatives are being (re)processed.
+	PROCESSING Status = 3
+	// HIDDEN is the state of a published media record that should not be displayed.
+	HIDDEN Status = 4
+	// DEPRECATED is the state of a media record that has been deprecated.
+	DEPRECATED Status = 5
+	// REMOVED is the state of a deprecated media record whose media files have been removed.
+	REMOVED Status = 6
+)
+
+var names = map[Status]string{
+	GATHERED:   "gathered",
+	PUBLISHED:  "published",
+	PENDING:    "pending",
+	PROCESSING: "processing",
+	HIDDEN:     "hidden",
+	DEPRECATED: "deprecated",
+	REMOVED:    "removed",
+}
+
+// transitions maps each state to the set of states it is allowed to move to. Transitions from a state to itself are
+// always allowed (and treated as a no-op) and are not listed here.
+var transitions = map[Status][]Status{
+	GATHERED:   {PENDING, PROCESSING, PUBLISHED, DEPRECATED},
+	PENDING:    {PROCESSING, PUBLISHED, DEPRECATED},
+	PROCESSING: {PUBLISHED, PENDING, DEPRECATED},
+	PUBLISHED:  {PENDING, PROCESSING, HIDDEN, DEPRECATED},
+	HIDDEN:     {PUBLISHED, PENDING, DEPRECATED},
+	DEPRECATED: {REMOVED},
+	REMOVED:    {},
+}
+
+// String returns the name of 's'.
+func (s Status) String() string {
+
+	name, ok := names[s]
+
+	if !ok {
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+
+	return name
+}
+
+// IsValid returns a boolean value indicating whether 'id' is a known Status value.
+func IsValid(id int) bool {
+	_, ok := names[Status(id)]
+	return ok
+}
+
+// Statuses returns the list of all known Status values.
+func Statuses() []Status {
+
+	statuses := make([]Status, 0)
+
+	for s := range names {
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i] < statuses[j]
+	})
+
+	return statuses
+}
+
+// FromString returns the Status whose name matches 'name'.
+func FromString(name string) (Status, error) {
+
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	for s, n := range names {
+
+		if n == name {
+			return s, nil
+		}
+	}
+
+	return GATHERED, fmt.Errorf("Unknown status '%s'", name)
+}
+
+// CanTransition returns a boolean value indicating whether a media record is allowed to move from 'from' to 'to'.
+func CanTransition(from Status, to Status) bool {
+
+	if !IsValid(int(from)) || !IsValid(int(to)) {
+		return false
+	}
+
+	if from == to {
+		return true
+	}
+
+	for _, s := range transitions[from] {
+
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,271 @@
+package status
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+
+	allowed := map[Status][]Status{
+		GATHERED:   {GATHERED, PENDING, PROCESSING, PUBLISHED, DEPRECATED},
+		PENDING:    {PENDING, PROCESSING, PUBLISHED, DEPRECATED},
+		PROCESSING: {PROCESSING, PUBLISHED, PENDING, DEPRECATED},
+		PUBLISHED:  {PUBLISHED, PENDING, PROCESSING, HIDDEN, DEPRECATED},
+		HIDDEN:     {HIDDEN, PUBLISHED, PENDING, DEPRECATED},
+		DEPRECATED: {DEPRECATED, REMOVED},
+		REMOVED:    {REMOVED},
+	}
+
+	for _, from := range Statuses() {
+
+		for _, to := range Statuses() {
+
+			expected := false
+
+			for _, s := range allowed[from] {
+
+				if s == to {
+					expected = true
+					break
+				}
+			}
+
+			t.Run(from.String()+"-"+to.String(), func(t *testing.T) {
+
+				if CanTransition(from, to) != expected {
+					t.Fatalf("Expected transition from %s to %s to be %t", from, to, expected)
+				}
+
+				_, err := Transition(feature(from), to)
+
+				if expected && err != nil {
+					t.Fatalf("Failed to transition from %s to %s, %v", from, to, err)
+				}
+
+				if !expected && err == nil {
+					t.Fatalf("Expected transition from %s to %s to fail", from, to)
+				}
+			})
+		}
+	}
+
+	invalid := Status(99)
+
+	if CanTransition(GATHERED, invalid) || CanTransition(invalid, GATHERED) || CanTransition(invalid, invalid) {
+		t.Fatalf("Expected transitions involving unknown states to be rejected")
+	}
+}
+
+func TestTransition(t *testing.T) {
+
+	body, err := Transition(feature(GATHERED), PENDING)
+
+	if err != nil {
+		t.Fatalf("Failed to transition to pending, %v", err)
+	}
+
+	body, err = Transition(body, PUBLISHED)
+
+	if err != nil {
+		t.Fatalf("Failed to transition to published, %v", err)
+	}
+
+	assertStatus(t, body, PUBLISHED)
+	assertHistory(t, body, PENDING, PUBLISHED)
+
+	same, err := Transition(body, PUBLISHED)
+
+	if err != nil {
+		t.Fatalf("Failed to transition to the same state, %v", err)
+	}
+
+	if !bytes.Equal(same, body) {
+		t.Fatalf("Expected transition to the same state to leave feature unchanged")
+	}
+}
+
+func TestMark(t *testing.T) {
+
+	tests := []struct {
+		Name     string
+		Mark     func([]byte) ([]byte, error)
+		From     Status
+		Expected Status
+		History  []Status
+	}{
+		{"cloned", MarkCloned, GATHERED, PENDING, []Status{PENDING}},
+		{"processed", MarkProcessed, PENDING, PUBLISHED, []Status{PUBLISHED}},
+		{"processed hidden", MarkProcessed, HIDDEN, HIDDEN, []Status{}},
+		{"rotated", MarkRotated, PUBLISHED, PUBLISHED, []Status{PROCESSING, PUBLISHED}},
+		{"rotated hidden", MarkRotated, HIDDEN, HIDDEN, []Status{}},
+		{"deprecated", MarkDeprecated, PUBLISHED, DEPRECATED, []Status{DEPRECATED}},
+		{"deprecated removed", MarkDeprecated, REMOVED, REMOVED, []Status{}},
+		{"removed", MarkRemoved, PUBLISHED, REMOVED, []Status{DEPRECATED, REMOVED}},
+		{"removed deprecated", MarkRemoved, DEPRECATED, REMOVED, []Status{REMOVED}},
+		{"removed removed", MarkRemoved, REMOVED, REMOVED, []Status{}},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			body, err := test.Mark(feature(test.From))
+
+			if err != nil {
+				t.Fatalf("Failed to mark feature, %v", err)
+			}
+
+			assertStatus(t, body, test.Expected)
+			assertHistory(t, body, test.History...)
+		})
+	}
+}
+
+func TestMarkIdempotent(t *testing.T) {
+
+	tests := map[string]func([]byte) ([]byte, error){
+		"rotated": MarkRotated,
+		"removed": MarkRemoved,
+	}
+
+	for name, mark := range tests {
+
+		t.Run(name, func(t *testing.T) {
+
+			body, err := mark(feature(PUBLISHED))
+
+			if err != nil {
+				t.Fatalf("Failed to mark feature, %v", err)
+			}
+
+			expected, err := Current(body)
+
+			if err != nil {
+				t.Fatalf("Failed to derive status, %v", err)
+			}
+
+			history, err := History(body)
+
+			if err != nil {
+				t.Fatalf("Failed to derive history, %v", err)
+			}
+
+			body, err = mark(body)
+
+			if err != nil {
+				t.Fatalf("Failed to mark feature a second time, %v", err)
+			}
+
+			assertStatus(t, body, expected)
+
+			again, err := History(body)
+
+			if err != nil {
+				t.Fatalf("Failed to derive history, %v", err)
+			}
+
+			// Rotating a published record again is a new round of processing so it is recorded, removing a removed record is not
+
+			switch expected {
+			case REMOVED:
+
+				if len(again) != len(history) {
+					t.Fatalf("Expected history to be unchanged, got %d entries", len(again))
+				}
+
+			default:
+
+				if len(again) != len(history)+2 {
+					t.Fatalf("Expected 2 new history entries, got %d", len(again)-len(history))
+				}
+			}
+		})
+	}
+}
+
+func TestCurrent(t *testing.T) {
+
+	s, err := Current([]byte(`{"properties": {}}`))
+
+	if err != nil {
+		t.Fatalf("Failed to derive status, %v", err)
+	}
+
+	if s != GATHERED {
+		t.Fatalf("Expected features without a status to be gathered, got %s", s)
+	}
+
+	_, err = Current([]byte(`{"properties": {"media:status_id": 99}}`))
+
+	if err == nil {
+		t.Fatalf("Expected unknown status to be rejected")
+	}
+}
+
+func TestFromString(t *testing.T) {
+
+	for _, s := range Statuses() {
+
+		parsed, err := FromString(" " + s.String() + " ")
+
+		if err != nil {
+			t.Fatalf("Failed to parse %s, %v", s, err)
+		}
+
+		if parsed != s {
+			t.Fatalf("Expected %s, got %s", s, parsed)
+		}
+	}
+
+	_, err := FromString("unknown")
+
+	if err == nil {
+		t.Fatalf("Expected unknown status name to be rejected")
+	}
+}
+
+// feature returns a media feature, without any status history, in the state 's'.
+func feature(s Status) []byte {
+	return []byte(fmt.Sprintf(`{"type": "Feature", "properties": {"media:status_id": %d}}`, int(s)))
+}
+
+// assertStatus fails the test if the media feature 'body' is not in the state 'expected'.
+func assertStatus(t *testing.T, body []byte, expected Status) {
+
+	t.Helper()
+
+	s, err := Current(body)
+
+	if err != nil {
+		t.Fatalf("Failed to derive status, %v", err)
+	}
+
+	if s != expected {
+		t.Fatalf("Expected status to be %s, got %s", expected, s)
+	}
+}
+
+// assertHistory fails the test if the media:status_history property of 'body' does not record the states in 'expected', in order.
+func assertHistory(t *testing.T, body []byte, expected ...Status) {
+
+	t.Helper()
+
+	history, err := History(body)
+
+	if err != nil {
+		t.Fatalf("Failed to derive history, %v", err)
+	}
+
+	if len(history) != len(expected) {
+		t.Fatalf("Expected %d history entries, got %d", len(expected), len(history))
+	}
+
+	for i, e := range history {
+
+		if e.StatusId != int(expected[i]) || e.Status != expected[i].String() {
+			t.Fatalf("Unexpected history entry %d, %s (%d)", i, e.Status, e.StatusId)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+)
+
+// ConvertToJPEG is a Transformation that converts images in one or more source formats to JPEG. Transparent pixels are
+// flattened against a white background.
+type ConvertToJPEG struct {
+	// The JPEG quality (1-100) to use when encoding the converted image.
+	Quality int
+	// The list of source formats to convert. If empty then "tiff" and "png" images are converted.
+	Formats []string
+}
+
+// NewConvertToJPEG returns a new ConvertToJPEG Transformation that will encode images using 'quality'.
+func NewConvertToJPEG(quality int, formats ...string) (*ConvertToJPEG, error) {
+
+	if quality < 1 || quality > 100 {
+		return nil, fmt.Errorf("Invalid JPEG quality '%d'", quality)
+	}
+
+	if len(formats) == 0 {
+		formats = []string{"tiff", "png"}
+	}
+
+	t := &ConvertToJPEG{
+		Quality: quality,
+		Formats: formats,
+	}
+
+	return t, nil
+}
+
+// Transform applies the ConvertToJPEG transformation to 'im'.
+func (t *ConvertToJPEG) Transform(ctx context.Context, im *Image) (*Image, error) {
+
+	formats := t.Formats
+
+	if len(formats) == 0 {
+		formats = []string{"tiff", "png"}
+	}
+
+	convert := false
+
+	for _, f := range formats {
+
+		if f == im.Format {
+			convert = true
+			break
+		}
+	}
+
+	if !convert {
+		return im, nil
+	}
+
+	bounds := im.Image.Bounds()
+
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, im.Image, bounds.Min, draw.Over)
+
+	quality := t.Quality
+
+	if quality == 0 {
+		quality = jpeg.DefaultQuality
+	}
+
+	im.Image = flat
+	im.Format = "jpeg"
+	im.Quality = quality
+	im.Modified = true
+
+	return im, nil
+}
@@ -0,0 +1,46 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nfnt/resize"
+)
+
+// Downscale is a Transformation that resizes an image so that neither its width nor its height exceeds a maximum
+// pixel dimension, preserving its aspect ratio. Images that are already small enough are left untouched.
+type Downscale struct {
+	// The maximum pixel dimension (width or height) of the image.
+	MaxDimension int
+}
+
+// NewDownscale returns a new Downscale Transformation for 'max_dimension'.
+func NewDownscale(max_dimension int) (*Downscale, error) {
+
+	if max_dimension <= 0 {
+		return nil, fmt.Errorf("Invalid maximum dimension '%d'", max_dimension)
+	}
+
+	t := &Downscale{
+		MaxDimension: max_dimension,
+	}
+
+	return t, nil
+}
+
+// Transform applies the Downscale transformation to 'im'.
+func (t *Downscale) Transform(ctx context.Context, im *Image) (*Image, error) {
+
+	bounds := im.Image.Bounds()
+
+	if bounds.Dx() <= t.MaxDimension && bounds.Dy() <= t.MaxDimension {
+		return im, nil
+	}
+
+	max := uint(t.MaxDimension)
+
+	im.Image = resize.Thumbnail(max, max, im.Image, resize.Lanczos3)
+	im.Modified = true
+
+	return im, nil
+}
@@ -0,0 +1,170 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// JPEG markers and the EXIF identifier code, see also: https://www.media.mit.edu/pia/Research/deepview/exif.html
+
+var jpeg_soi = []byte{0xFF, 0xD8}
+
+var exif_header = []byte("Exif\x00\x00")
+
+const jpeg_app1 byte = 0xE1
+const jpeg_sos byte = 0xDA
+
+const exif_tag_orientation uint16 = 0x0112
+
+// extractJPEGExif returns the body of the first APP1 segment containing EXIF data in the JPEG-encoded 'body' or nil if
+// there is no EXIF data.
+func extractJPEGExif(body []byte) []byte {
+
+	if !bytes.HasPrefix(body, jpeg_soi) {
+		return nil
+	}
+
+	offset := len(jpeg_soi)
+
+	for offset+4 <= len(body) {
+
+		if body[offset] != 0xFF {
+			return nil
+		}
+
+		marker := body[offset+1]
+
+		if marker == jpeg_sos {
+			return nil
+		}
+
+		length := int(binary.BigEndian.Uint16(body[offset+2 : offset+4]))
+
+		if length < 2 || offset+2+length > len(body) {
+			return nil
+		}
+
+		segment := body[offset+4 : offset+2+length]
+
+		if marker == jpeg_app1 && bytes.HasPrefix(segment, exif_header) {
+			exif := make([]byte, len(segment))
+			copy(exif, segment)
+			return exif
+		}
+
+		offset = offset + 2 + length
+	}
+
+	return nil
+}
+
+// insertJPEGExif returns a copy of the JPEG-encoded 'body' with an APP1 segment containing 'exif' inserted immediately
+// after the start of image marker.
+func insertJPEGExif(body []byte, exif []byte) ([]byte, error) {
+
+	if !bytes.HasPrefix(body, jpeg_soi) {
+		return nil, fmt.Errorf("Body is not a JPEG image")
+	}
+
+	length := len(exif) + 2
+
+	if length > 0xFFFF {
+		return nil, fmt.Errorf("EXIF data is too large (%d bytes)", len(exif))
+	}
+
+	var buf bytes.Buffer
+
+	buf.Write(jpeg_soi)
+	buf.Write([]byte{0xFF, jpeg_app1})
+	binary.Write(&buf, binary.BigEndian, uint16(length))
+	buf.Write(exif)
+	buf.Write(body[len(jpeg_soi):])
+
+	return buf.Bytes(), nil
+}
+
+// exifOrientation returns the value of the Orientation tag in the first image file directory (IFD0) of 'exif' or 0
+// if it is not present.
+func exifOrientation(exif []byte) int {
+
+	offset, order, ok := exifOrientationOffset(exif)
+
+	if !ok {
+		return 0
+	}
+
+	return int(order.Uint16(exif[offset : offset+2]))
+}
+
+// resetExifOrientation returns a copy of 'exif' with the Orientation tag (if present) set to 1 (upright).
+func resetExifOrientation(exif []byte) []byte {
+
+	offset, order, ok := exifOrientationOffset(exif)
+
+	if !ok {
+		return exif
+	}
+
+	new_exif := make([]byte, len(exif))
+	copy(new_exif, exif)
+
+	order.PutUint16(new_exif[offset:offset+2], 1)
+	return new_exif
+}
+
+// exifOrientationOffset returns the offset (in 'exif') of the value of the Orientation tag in the first image file
+// directory (IFD0) and the byte order used to encode it.
+func exifOrientationOffset(exif []byte) (int, binary.ByteOrder, bool) {
+
+	if !bytes.HasPrefix(exif, exif_header) {
+		return 0, nil, false
+	}
+
+	tiff := exif[len(exif_header):]
+
+	if len(tiff) < 8 {
+		return 0, nil, false
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, nil, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+
+	if ifd+2 > len(tiff) {
+		return 0, nil, false
+	}
+
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+
+	for i := 0; i < count; i++ {
+
+		entry := ifd + 2 + (i * 12)
+
+		if entry+12 > len(tiff) {
+			return 0, nil, false
+		}
+
+		tag := order.Uint16(tiff[entry : entry+2])
+
+		if tag != exif_tag_orientation {
+			continue
+		}
+
+		// The orientation value is a SHORT stored in the first two bytes of the value field
+
+		offset := len(exif_header) + entry + 8
+		return offset, order, true
+	}
+
+	return 0, nil, false
+}
@@ -0,0 +1,138 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/tiff"
+)
+
+// DEFAULT_JPEG_QUALITY is the quality used to encode JPEG images when an explicit quality has not been set.
+const DEFAULT_JPEG_QUALITY int = 90
+
+// Image is a struct wrapping a decoded image.Image along with details about how it was, and will be, encoded.
+type Image struct {
+	// The decoded image.
+	Image image.Image
+	// The format used to encode the image ("jpeg", "png", "gif" or "tiff").
+	Format string
+	// The quality to use when encoding JPEG images. If 0 then DEFAULT_JPEG_QUALITY is used.
+	Quality int
+	// The raw EXIF data (the body of the JPEG APP1 segment) associated with the image, if present.
+	Exif []byte
+	// A boolean flag indicating whether Exif data should be removed when the image is encoded. Exif data is only ever
+	// included when encoding JPEG images.
+	StripMetadata bool
+	// A boolean flag indicating whether the image has been modified since it was decoded.
+	Modified bool
+	// The original (encoded) body of the image.
+	source []byte
+}
+
+// Decode will decode the body of 'r' in to a new Image instance.
+func Decode(r io.Reader) (*Image, error) {
+
+	body, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read image, %w", err)
+	}
+
+	im, format, err := image.Decode(bytes.NewReader(body))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode image, %w", err)
+	}
+
+	t_im := &Image{
+		Image:  im,
+		Format: format,
+		source: body,
+	}
+
+	if format == "jpeg" {
+		t_im.Exif = extractJPEGExif(body)
+	}
+
+	return t_im, nil
+}
+
+// Extension returns the canonical filename extension (including the leading ".") for the image's format.
+func (im *Image) Extension() string {
+
+	switch im.Format {
+	case "jpeg":
+		return ".jpg"
+	case "tiff":
+		return ".tif"
+	default:
+		return fmt.Sprintf(".%s", im.Format)
+	}
+}
+
+// Mimetype returns the mimetype for the image's format.
+func (im *Image) Mimetype() string {
+	return fmt.Sprintf("image/%s", im.Format)
+}
+
+// Encode will write the encoded image to 'wr'. If the image has not been modified since it was decoded the original
+// body of the image is written as-is.
+func (im *Image) Encode(wr io.Writer) error {
+
+	if !im.Modified && im.source != nil {
+		_, err := wr.Write(im.source)
+		return err
+	}
+
+	var err error
+
+	switch im.Format {
+	case "jpeg":
+
+		quality := im.Quality
+
+		if quality == 0 {
+			quality = DEFAULT_JPEG_QUALITY
+		}
+
+		var buf bytes.Buffer
+
+		err = jpeg.Encode(&buf, im.Image, &jpeg.Options{Quality: quality})
+
+		if err != nil {
+			break
+		}
+
+		body := buf.Bytes()
+
+		if !im.StripMetadata && len(im.Exif) > 0 {
+			body, err = insertJPEGExif(body, im.Exif)
+
+			if err != nil {
+				break
+			}
+		}
+
+		_, err = wr.Write(body)
+
+	case "png":
+		err = png.Encode(wr, im.Image)
+	case "gif":
+		err = gif.Encode(wr, im.Image, &gif.Options{})
+	case "tiff":
+		err = tiff.Encode(wr, im.Image, &tiff.Options{Compression: tiff.Deflate})
+	default:
+		err = fmt.Errorf("Unsupported format '%s'", im.Format)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode image, %w", err)
+	}
+
+	return nil
+}
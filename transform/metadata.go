@@ -0,0 +1,39 @@
+package transform
+
+import (
+	"context"
+)
+
+// Metadata is a Transformation that determines whether an image's EXIF metadata is kept or stripped when it is
+// re-encoded. Metadata is kept by default and is only retained for JPEG images. Stripping is applied when the image is
+// encoded, rather than when the transformation is applied, so the EXIF data remains available to transformations (like
+// AutoOrient) later in the chain.
+type Metadata struct {
+	// A boolean flag indicating whether metadata should be kept.
+	Keep bool
+}
+
+// NewKeepMetadata returns a new Metadata Transformation that keeps metadata.
+func NewKeepMetadata() *Metadata {
+	return &Metadata{Keep: true}
+}
+
+// NewStripMetadata returns a new Metadata Transformation that strips metadata.
+func NewStripMetadata() *Metadata {
+	return &Metadata{Keep: false}
+}
+
+// Transform applies the Metadata transformation to 'im'.
+func (t *Metadata) Transform(ctx context.Context, im *Image) (*Image, error) {
+
+	im.StripMetadata = !t.Keep
+
+	// Stripping metadata from an image that has some requires that
+	// it be re-encoded, rather than copied as-is.
+
+	if im.StripMetadata && len(im.Exif) > 0 {
+		im.Modified = true
+	}
+
+	return im, nil
+}
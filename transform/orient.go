@@ -0,0 +1,63 @@
+package transform
+
+import (
+	"context"
+	"image"
+
+	"github.com/aaronland/go-image-tools/imaging"
+)
+
+// AutoOrient is a Transformation that rotates and flips an image so that it is upright, as determined by the
+// Orientation tag in its EXIF data. If the EXIF data is retained its Orientation tag is reset to 1 (upright).
+type AutoOrient struct {
+}
+
+// NewAutoOrient returns a new AutoOrient Transformation.
+func NewAutoOrient() *AutoOrient {
+	return &AutoOrient{}
+}
+
+// Transform applies the AutoOrient transformation to 'im'.
+func (t *AutoOrient) Transform(ctx context.Context, im *Image) (*Image, error) {
+
+	if len(im.Exif) == 0 {
+		return im, nil
+	}
+
+	orientation := exifOrientation(im.Exif)
+
+	if orientation <= 1 {
+		return im, nil
+	}
+
+	im.Image = orient(im.Image, orientation)
+	im.Exif = resetExifOrientation(im.Exif)
+	im.Modified = true
+
+	return im, nil
+}
+
+// orient will rotate and flip 'im' according to the EXIF Orientation value 'orientation'.
+func orient(im image.Image, orientation int) image.Image {
+
+	// Note that go-image-tools/imaging rotates images counter-clockwise
+
+	switch orientation {
+	case 2:
+		return imaging.FlipH(im)
+	case 3:
+		return imaging.Rotate180(im)
+	case 4:
+		return imaging.FlipV(im)
+	case 5:
+		return imaging.Transpose(im)
+	case 6:
+		return imaging.Rotate270(im)
+	case 7:
+		return imaging.Transverse(im)
+	case 8:
+		return imaging.Rotate90(im)
+	default:
+		return im
+	}
+}
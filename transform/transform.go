@@ -0,0 +1,51 @@
+// package transform provides methods for decoding, transforming and re-encoding images, for example to normalise source
+// images before they are processed.
+package transform
+
+import (
+	"context"
+	"fmt"
+)
+
+// Transformation is an interface for transforming an Image.
+type Transformation interface {
+	// Transform applies the transformation to an Image and returns the (possibly new) transformed Image.
+	Transform(context.Context, *Image) (*Image, error)
+}
+
+var _ Transformation = (*AutoOrient)(nil)
+var _ Transformation = (*ConvertToJPEG)(nil)
+var _ Transformation = (*Downscale)(nil)
+var _ Transformation = (*Metadata)(nil)
+
+// TransformationFunc is a function that implements the Transformation interface.
+type TransformationFunc func(context.Context, *Image) (*Image, error)
+
+// Transform applies 'f' to 'im'.
+func (f TransformationFunc) Transform(ctx context.Context, im *Image) (*Image, error) {
+	return f(ctx, im)
+}
+
+// Apply will apply each Transformation in 'transformations', in order, to 'im'.
+func Apply(ctx context.Context, im *Image, transformations ...Transformation) (*Image, error) {
+
+	for idx, t := range transformations {
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			// pass
+		}
+
+		new_im, err := t.Transform(ctx, im)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to apply transformation at offset %d, %w", idx, err)
+		}
+
+		im = new_im
+	}
+
+	return im, nil
+}